@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"telegram-dm-bot/storage"
+)
+
+type activityKey struct {
+	ChannelID int64
+	Hour      time.Time
+}
+
+type subscriberKey struct {
+	ChannelID int64
+	UserID    int64
+}
+
+// ActivityCounter mengumpulkan aktivitas DM per channel per jam dan daftar
+// subscriber yang terlihat, lalu di-flush bersama statistik trigger.
+type ActivityCounter struct {
+	mu          sync.Mutex
+	activity    map[activityKey]storage.ChannelActivity
+	subscribers map[subscriberKey]storage.Subscriber
+	flushMu     sync.Mutex // hanya satu flush yang boleh berjalan
+}
+
+func NewActivityCounter() *ActivityCounter {
+	return &ActivityCounter{
+		activity:    make(map[activityKey]storage.ChannelActivity),
+		subscribers: make(map[subscriberKey]storage.Subscriber),
+	}
+}
+
+func (a *ActivityCounter) add(channelID int64, at time.Time, apply func(*storage.ChannelActivity)) {
+	key := activityKey{channelID, at.UTC().Truncate(time.Hour)}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	activity, found := a.activity[key]
+	if !found {
+		activity = storage.ChannelActivity{ChannelID: channelID, Hour: key.Hour}
+	}
+	apply(&activity)
+	a.activity[key] = activity
+}
+
+// RecordDM mencatat satu DM masuk beserta pengirim dan topiknya sebagai subscriber.
+// Identitas diambil dari pemilik topik DM, dilengkapi dari msg.From.
+func (a *ActivityCounter) RecordDM(channelID int64, msg *Message, at time.Time) {
+	a.add(channelID, at, func(c *storage.ChannelActivity) { c.DMs++ })
+
+	user := msg.DirectMessagesTopic.User
+	if user.ID == 0 {
+		user = msg.From
+	}
+	if user.FirstName == "" {
+		user.FirstName = msg.From.FirstName
+	}
+	if user.Username == "" {
+		user.Username = msg.From.Username
+	}
+	if user.LangCode == "" {
+		user.LangCode = msg.From.LangCode
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := subscriberKey{channelID, user.ID}
+	a.subscribers[key] = storage.Subscriber{
+		ChannelID:    channelID,
+		UserID:       user.ID,
+		ChatID:       msg.Chat.ID,
+		TopicID:      msg.DirectMessagesTopic.TopicID,
+		FirstName:    user.FirstName,
+		Username:     user.Username,
+		LangCode:     user.LangCode,
+		LastSeen:     at,
+		MessageCount: a.subscribers[key].MessageCount + 1,
+	}
+}
+
+func (a *ActivityCounter) RecordMatched(channelID int64, at time.Time) {
+	a.add(channelID, at, func(c *storage.ChannelActivity) { c.Matched++ })
+}
+
+func (a *ActivityCounter) RecordUnmatched(channelID int64, at time.Time) {
+	a.add(channelID, at, func(c *storage.ChannelActivity) { c.Unmatched++ })
+}
+
+func (a *ActivityCounter) RecordFailedSend(channelID int64, at time.Time) {
+	a.add(channelID, at, func(c *storage.ChannelActivity) { c.FailedSends++ })
+}
+
+func (a *ActivityCounter) drain() (map[activityKey]storage.ChannelActivity, map[subscriberKey]storage.Subscriber) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	activity, subscribers := a.activity, a.subscribers
+	a.activity = make(map[activityKey]storage.ChannelActivity)
+	a.subscribers = make(map[subscriberKey]storage.Subscriber)
+	return activity, subscribers
+}
+
+// requeue mengembalikan aktivitas yang gagal disimpan agar dicoba lagi.
+func (a *ActivityCounter) requeue(key activityKey, failed storage.ChannelActivity) {
+	a.add(key.ChannelID, key.Hour, func(c *storage.ChannelActivity) {
+		c.DMs += failed.DMs
+		c.Matched += failed.Matched
+		c.Unmatched += failed.Unmatched
+		c.FailedSends += failed.FailedSends
+	})
+}
+
+func (a *ActivityCounter) requeueSubscribers(subscribers map[subscriberKey]storage.Subscriber) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, sub := range subscribers {
+		// Data yang masuk selama flush lebih baru, jadi hanya jumlah pesannya yang digabung
+		if newer, found := a.subscribers[key]; found {
+			newer.MessageCount += sub.MessageCount
+			a.subscribers[key] = newer
+			continue
+		}
+		a.subscribers[key] = sub
+	}
+}
+
+func (b *Bot) flushActivity(ctx context.Context) {
+	b.activity.flushMu.Lock()
+	defer b.activity.flushMu.Unlock()
+
+	activity, subscribers := b.activity.drain()
+	failed := 0
+	for key, counts := range activity {
+		if err := b.store.AddChannelActivity(ctx, counts); err != nil {
+			b.activity.requeue(key, counts)
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Printf("failed to flush %d of %d channel activity buckets, will retry", failed, len(activity))
+	}
+
+	if len(subscribers) == 0 {
+		return
+	}
+	var rows []storage.Subscriber
+	for _, sub := range subscribers {
+		rows = append(rows, sub)
+	}
+	if err := b.store.UpsertSubscribers(ctx, rows); err != nil {
+		log.Printf("failed to flush subscribers, will retry: %v", err)
+		b.activity.requeueSubscribers(subscribers)
+	}
+}
@@ -2,92 +2,254 @@ package bot
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+
+	"telegram-dm-bot/config"
 )
 
 // ... (NewAPI, GetUpdates, SendMessage, GetChatAdministrators, GetChat tetap sama) ...
 type API struct {
-	token      string
-	baseURL    string
-	httpClient *http.Client
+	token       string
+	baseURL     string
+	fileURL     string
+	pollTimeout time.Duration
+	httpClient  *http.Client
+	pacer       *SendPacer
 }
 
-func NewAPI(token string) *API {
+// NewAPI membuat klien Bot API dari konfigurasi. Nilai yang kosong diisi
+// default, sehingga config.Config{BotToken: ...} saja sudah cukup.
+func NewAPI(cfg *config.Config) *API {
+	apiURL := strings.TrimRight(cfg.TelegramAPIURL, "/")
+	if apiURL == "" {
+		apiURL = config.DefaultTelegramAPIURL
+	}
+	requestTimeout := cfg.RequestTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = 60 * time.Second
+	}
+	pollTimeout := cfg.PollTimeout
+	if pollTimeout <= 0 {
+		pollTimeout = 30 * time.Second
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: requestTimeout}
+	}
 	return &API{
-		token:   token,
-		baseURL: fmt.Sprintf("https://api.telegram.org/bot%s", token),
-		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
-		},
+		token:       cfg.BotToken,
+		baseURL:     fmt.Sprintf("%s/bot%s", apiURL, cfg.BotToken),
+		fileURL:     fmt.Sprintf("%s/file/bot%s", apiURL, cfg.BotToken),
+		pollTimeout: pollTimeout,
+		httpClient:  httpClient,
+		pacer:       NewSendPacer(),
 	}
 }
 
-func (a *API) sendPostRequest(method string, payload interface{}) error {
+// Close menutup koneksi idle ke server Telegram saat bot dihentikan.
+func (a *API) Close() {
+	a.httpClient.CloseIdleConnections()
+}
+
+// QueueDepth adalah jumlah pesan keluar yang sedang menunggu giliran karena
+// batas kecepatan Telegram.
+func (a *API) QueueDepth() int {
+	return a.pacer.Depth()
+}
+
+// sendPostRequest mengirim payload JSON. chat dipakai untuk mengatur
+// kecepatan kirim per chat; chatKey kosong berarti permintaan tidak dibatasi.
+func (a *API) sendPostRequest(ctx context.Context, method string, chat chatKey, payload interface{}) error {
 	url := fmt.Sprintf("%s/%s", a.baseURL, method)
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal %s payload: %w", method, err)
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		return fmt.Errorf("failed to create new request for %s: %w", method, err)
+	return a.send(ctx, method, chat, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payloadBytes))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+}
+
+// send menjalankan permintaan buatan newRequest sesuai jadwal pacer. Jawaban
+// 429 ditunggu sesuai retry_after selama total tunggunya tidak melewati
+// sendRetryAfterMax, karena send berjalan di worker yang juga melayani user
+// lain. 5xx dan koneksi yang gagal dibuka dicoba ulang dengan backoff;
+// kesalahan lain langsung dikembalikan.
+func (a *API) send(ctx context.Context, method string, chat chatKey, newRequest func() (*http.Request, error)) error {
+	var lastErr error
+	var rateLimited time.Duration
+	for attempt := 1; attempt <= sendMaxAttempts; attempt++ {
+		if chat.ChatID != 0 {
+			if err := a.pacer.Wait(ctx, chat); err != nil {
+				return fmt.Errorf("failed to schedule %s for chat %d: %w", method, chat.ChatID, err)
+			}
+		}
+		req, err := newRequest()
+		if err != nil {
+			return fmt.Errorf("failed to create new request for %s: %w", method, err)
+		}
+
+		resp, err := a.httpClient.Do(req)
+		if err != nil {
+			// Permintaan yang mungkin sudah sampai ke Telegram (misalnya timeout
+			// saat menunggu jawaban) tidak dikirim ulang agar pesan tidak ganda
+			if ctx.Err() != nil || !isDialError(err) {
+				return fmt.Errorf("failed to send %s request: %w", method, err)
+			}
+			lastErr = fmt.Errorf("failed to send %s request: %w", method, err)
+			if err := sleepContext(ctx, retryBackoff(attempt)); err != nil {
+				return lastErr
+			}
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			log.Printf("successfully sent %s", method)
+			return nil
+		}
+		apiErr := newAPIError(method, resp.StatusCode, body)
+		switch {
+		case apiErr.ErrorCode == http.StatusTooManyRequests:
+			lastErr = apiErr
+			wait := apiErr.RetryAfter
+			if wait <= 0 {
+				wait = time.Second
+			}
+			// Tunggu yang lebih lama diserahkan ke pemanggil
+			if rateLimited+wait > sendRetryAfterMax {
+				return apiErr
+			}
+			rateLimited += wait
+			log.Printf("rate limited on %s for chat %d, retrying in %s", method, chat.ChatID, wait)
+			if chat.ChatID != 0 {
+				a.pacer.Pause(chat, time.Now().Add(wait))
+			} else if err := sleepContext(ctx, wait); err != nil {
+				return lastErr
+			}
+		case apiErr.ErrorCode >= http.StatusInternalServerError:
+			lastErr = apiErr
+			if err := sleepContext(ctx, retryBackoff(attempt)); err != nil {
+				return lastErr
+			}
+		default:
+			return apiErr
+		}
 	}
-	req.Header.Set("Content-Type", "application/json")
+	return fmt.Errorf("giving up on %s after %d attempts: %w", method, sendMaxAttempts, lastErr)
+}
 
-	resp, err := a.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send %s request: %w", method, err)
+// isDialError berarti koneksi ke server gagal dibuka (DNS atau dial), jadi
+// permintaan pasti belum terkirim dan aman diulang.
+func isDialError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
 	}
-	defer resp.Body.Close()
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("received non-ok status code on %s (%d): %s", method, resp.StatusCode, string(body))
+// get mengirim permintaan GET yang ikut batal ketika ctx selesai.
+func (a *API) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
 	}
-	log.Printf("successfully sent %s", method)
-	return nil
+	return a.httpClient.Do(req)
+}
+
+func (a *API) SendMessage(ctx context.Context, payload SendMessagePayload) error {
+	return a.sendPostRequest(ctx, "sendMessage", chatKey{payload.ChatID, payload.DirectMessagesTopicID}, payload)
+}
+
+func (a *API) SendSticker(ctx context.Context, payload SendStickerPayload) error {
+	return a.sendPostRequest(ctx, "sendSticker", chatKey{payload.ChatID, payload.DirectMessagesTopicID}, payload)
+}
+
+func (a *API) SendDocument(ctx context.Context, payload SendDocumentPayload) error {
+	return a.sendPostRequest(ctx, "sendDocument", chatKey{payload.ChatID, payload.DirectMessagesTopicID}, payload)
 }
 
-func (a *API) SendMessage(payload SendMessagePayload) error {
-	return a.sendPostRequest("sendMessage", payload)
+func (a *API) SendAnimation(ctx context.Context, payload SendAnimationPayload) error {
+	return a.sendPostRequest(ctx, "sendAnimation", chatKey{payload.ChatID, payload.DirectMessagesTopicID}, payload)
 }
 
-func (a *API) SendSticker(payload SendStickerPayload) error {
-	return a.sendPostRequest("sendSticker", payload)
+func (a *API) SendAudio(ctx context.Context, payload SendAudioPayload) error {
+	return a.sendPostRequest(ctx, "sendAudio", chatKey{payload.ChatID, payload.DirectMessagesTopicID}, payload)
 }
 
-func (a *API) SendDocument(payload SendDocumentPayload) error {
-	return a.sendPostRequest("sendDocument", payload)
+func (a *API) EditMessageText(ctx context.Context, payload EditMessageTextPayload) error {
+	return a.sendPostRequest(ctx, "editMessageText", chatKey{ChatID: payload.ChatID}, payload)
 }
 
-func (a *API) SendAnimation(payload SendAnimationPayload) error {
-	return a.sendPostRequest("sendAnimation", payload)
+func (a *API) AnswerCallbackQuery(ctx context.Context, payload AnswerCallbackQueryPayload) error {
+	return a.sendPostRequest(ctx, "answerCallbackQuery", chatKey{}, payload)
 }
 
-func (a *API) SendAudio(payload SendAudioPayload) error {
-	return a.sendPostRequest("sendAudio", payload)
+func (a *API) SetWebhook(ctx context.Context, payload SetWebhookPayload) error {
+	return a.sendPostRequest(ctx, "setWebhook", chatKey{}, payload)
 }
 
-func (a *API) EditMessageText(payload EditMessageTextPayload) error {
-	return a.sendPostRequest("editMessageText", payload)
+func (a *API) DeleteWebhook(ctx context.Context, payload DeleteWebhookPayload) error {
+	return a.sendPostRequest(ctx, "deleteWebhook", chatKey{}, payload)
 }
 
-func (a *API) AnswerCallbackQuery(payload AnswerCallbackQueryPayload) error {
-	return a.sendPostRequest("answerCallbackQuery", payload)
+func (a *API) SendPhoto(ctx context.Context, payload SendPhotoPayload) error {
+	return a.sendPostRequest(ctx, "sendPhoto", chatKey{payload.ChatID, payload.DirectMessagesTopicID}, payload)
 }
 
-func (a *API) SendPhoto(payload SendPhotoPayload) error {
-	return a.sendPostRequest("sendPhoto", payload)
+// SendDocumentFile mengunggah file dari memori (misalnya hasil ekspor)
+// lewat multipart/form-data, bukan dengan file_id.
+func (a *API) SendDocumentFile(ctx context.Context, chatID int64, filename string, content []byte, caption string) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("chat_id", strconv.FormatInt(chatID, 10))
+	if caption != "" {
+		writer.WriteField("caption", caption)
+	}
+	part, err := writer.CreateFormFile("document", filename)
+	if err != nil {
+		return fmt.Errorf("failed to create form file for sendDocument: %w", err)
+	}
+	if _, err := part.Write(content); err != nil {
+		return fmt.Errorf("failed to write document content: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finalize multipart body: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/sendDocument", a.baseURL)
+	return a.send(ctx, "sendDocument", chatKey{ChatID: chatID}, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return req, nil
+	})
 }
 
-func (a *API) GetUpdates(offset int) ([]Update, error) {
-	url := fmt.Sprintf("%s/getUpdates?offset=%d&timeout=30", a.baseURL, offset)
-	resp, err := a.httpClient.Get(url)
+func (a *API) GetUpdates(ctx context.Context, offset int) ([]Update, error) {
+	url := fmt.Sprintf("%s/getUpdates?offset=%d&timeout=%d", a.baseURL, offset, int(a.pollTimeout/time.Second))
+	resp, err := a.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get updates: %w", err)
 	}
@@ -104,7 +266,7 @@ func (a *API) GetUpdates(offset int) ([]Update, error) {
 	}
 
 	if !apiResp.Ok {
-		return nil, fmt.Errorf("telegram API returned an error: %s", string(body))
+		return nil, newAPIError("getUpdates", resp.StatusCode, body)
 	}
 
 	var updates []Update
@@ -117,9 +279,9 @@ func (a *API) GetUpdates(offset int) ([]Update, error) {
 
 
 
-func (a *API) GetChatAdministrators(chatID int64) ([]ChatMember, error) {
+func (a *API) GetChatAdministrators(ctx context.Context, chatID int64) ([]ChatMember, error) {
 	url := fmt.Sprintf("%s/getChatAdministrators?chat_id=%d", a.baseURL, chatID)
-	resp, err := a.httpClient.Get(url)
+	resp, err := a.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get chat administrators: %w", err)
 	}
@@ -136,7 +298,7 @@ func (a *API) GetChatAdministrators(chatID int64) ([]ChatMember, error) {
 	}
 
 	if !apiResp.Ok {
-		return nil, fmt.Errorf("telegram API returned an error on getChatAdministrators: %s", string(body))
+		return nil, newAPIError("getChatAdministrators", resp.StatusCode, body)
 	}
 
 	var admins []ChatMember
@@ -147,9 +309,9 @@ func (a *API) GetChatAdministrators(chatID int64) ([]ChatMember, error) {
 	return admins, nil
 }
 
-func (a *API) GetChat(chatID interface{}) (*GetChatResponse, error) {
+func (a *API) GetChat(ctx context.Context, chatID interface{}) (*GetChatResponse, error) {
 	url := fmt.Sprintf("%s/getChat?chat_id=%v", a.baseURL, chatID)
-	resp, err := a.httpClient.Get(url)
+	resp, err := a.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get chat: %w", err)
 	}
@@ -166,7 +328,7 @@ func (a *API) GetChat(chatID interface{}) (*GetChatResponse, error) {
 	}
 
 	if !apiResp.Ok {
-		return nil, fmt.Errorf("telegram API returned an error on getChat: %s", string(body))
+		return nil, newAPIError("getChat", resp.StatusCode, body)
 	}
 
 	var chatInfo GetChatResponse
@@ -180,9 +342,9 @@ func (a *API) GetChat(chatID interface{}) (*GetChatResponse, error) {
 // --- AWAL PERUBAHAN ---
 // Tambahkan fungsi baru ini bersama fungsi "Get" lainnya
 
-func (a *API) GetMe() (*User, error) {
+func (a *API) GetMe(ctx context.Context) (*User, error) {
 	url := fmt.Sprintf("%s/getMe", a.baseURL)
-	resp, err := a.httpClient.Get(url)
+	resp, err := a.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call getMe: %w", err)
 	}
@@ -198,13 +360,13 @@ func (a *API) GetMe() (*User, error) {
 		// Coba unmarshal sebagai error biasa jika getMe gagal
 		var baseResp ApiResponse
 		if json.Unmarshal(body, &baseResp) == nil && !baseResp.Ok {
-			return nil, fmt.Errorf("telegram API error on getMe: %s", string(body))
+			return nil, newAPIError("getMe", resp.StatusCode, body)
 		}
 		return nil, fmt.Errorf("failed to unmarshal getMe response: %w", err)
 	}
 
 	if !apiResp.Ok {
-		return nil, fmt.Errorf("telegram API returned not ok on getMe: %s", string(body))
+		return nil, newAPIError("getMe", resp.StatusCode, body)
 	}
 
 	return &apiResp.Result, nil
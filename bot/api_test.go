@@ -0,0 +1,102 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"telegram-dm-bot/config"
+)
+
+// fakeBotAPI adalah server Bot API palsu yang mencatat path dan query setiap
+// permintaan lalu menjawab dengan result.
+func fakeBotAPI(t *testing.T, result string) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.RequestURI())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":` + result + `}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requests...)
+	}
+}
+
+func TestNewAPIDefaults(t *testing.T) {
+	api := NewAPI(&config.Config{BotToken: "123:abc"})
+	if want := config.DefaultTelegramAPIURL + "/bot123:abc"; api.baseURL != want {
+		t.Errorf("baseURL = %q, want %q", api.baseURL, want)
+	}
+	if api.pollTimeout != 30*time.Second {
+		t.Errorf("pollTimeout = %s, want 30s", api.pollTimeout)
+	}
+	if api.httpClient.Timeout != 60*time.Second {
+		t.Errorf("request timeout = %s, want 60s", api.httpClient.Timeout)
+	}
+}
+
+func TestAPICustomURL(t *testing.T) {
+	server, requests := fakeBotAPI(t, `{"id":1,"is_bot":true,"username":"test_bot"}`)
+	api := NewAPI(&config.Config{BotToken: "123:abc", TelegramAPIURL: server.URL + "/"})
+
+	me, err := api.GetMe(context.Background())
+	if err != nil {
+		t.Fatalf("GetMe: %v", err)
+	}
+	if me.Username != "test_bot" {
+		t.Errorf("username = %q, want test_bot", me.Username)
+	}
+	if err := api.SendMessage(context.Background(), SendMessagePayload{ChatID: 42, Text: "hi"}); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	got := requests()
+	want := []string{"/bot123:abc/getMe", "/bot123:abc/sendMessage"}
+	if len(got) != len(want) {
+		t.Fatalf("requests = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("request %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestAPIPollTimeout(t *testing.T) {
+	server, requests := fakeBotAPI(t, `[]`)
+	api := NewAPI(&config.Config{BotToken: "123:abc", TelegramAPIURL: server.URL, PollTimeout: 5 * time.Second})
+
+	if _, err := api.GetUpdates(context.Background(), 10); err != nil {
+		t.Fatalf("GetUpdates: %v", err)
+	}
+	if got := requests(); len(got) != 1 || got[0] != "/bot123:abc/getUpdates?offset=10&timeout=5" {
+		t.Errorf("requests = %v, want one getUpdates with timeout=5", got)
+	}
+}
+
+func TestAPIRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Jawaban ditahan sampai klien menyerah
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	api := NewAPI(&config.Config{BotToken: "123:abc", TelegramAPIURL: server.URL, RequestTimeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	if _, err := api.GetMe(context.Background()); err == nil {
+		t.Fatal("GetMe succeeded against a server that never answers")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("GetMe returned after %s, want about the 50ms request timeout", elapsed)
+	}
+}
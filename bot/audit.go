@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+const auditPageSize = 10
+
+// recordAudit mencatat satu tindakan admin. Kegagalan hanya dicatat di log
+// agar tidak menggagalkan tindakan yang sudah berhasil.
+func (b *Bot) recordAudit(ctx context.Context, channelID, actorID int64, action, target, before, after string) {
+	event := storage.AuditEvent{
+		ChannelID: channelID,
+		ActorID:   actorID,
+		Action:    action,
+		Target:    target,
+		Before:    before,
+		After:     after,
+	}
+	if err := b.store.AddAuditEvent(ctx, event); err != nil {
+		log.Printf("failed to record audit event %s on channel %d: %v", action, channelID, err)
+	}
+}
+
+// recordSettingsAudit mencatat satu event untuk setiap pengaturan yang berubah.
+func (b *Bot) recordSettingsAudit(ctx context.Context, actorID int64, before, after storage.ChannelSettings) {
+	changes := []struct {
+		Field         string
+		Before, After string
+	}{
+		{"auto_reply", strconv.FormatBool(before.AutoReply), strconv.FormatBool(after.AutoReply)},
+		{"parse_mode", before.ParseMode, after.ParseMode},
+		{"match_mode", before.MatchMode, after.MatchMode},
+		{"fallback_reply", before.FallbackReply, after.FallbackReply},
+		{"notify_unmatched", strconv.FormatBool(before.NotifyUnmatched), strconv.FormatBool(after.NotifyUnmatched)},
+		{"timezone", before.Timezone, after.Timezone},
+		{"digest_schedule", before.DigestSchedule, after.DigestSchedule},
+	}
+	for _, change := range changes {
+		if change.Before != change.After {
+			b.recordAudit(ctx, after.ChannelID, actorID, storage.AuditSettings, change.Field, change.Before, change.After)
+		}
+	}
+}
+
+// auditTriggerValue meringkas isi balasan trigger untuk kolom before/after.
+func auditTriggerValue(record storage.TriggerRecord) string {
+	value := record.ResponseText
+	if record.ResponseFileID != "" {
+		value = strings.TrimSpace(record.ResponseFileID + " " + value)
+	}
+	return fmt.Sprintf("[%s] %s", record.ResponseType, value)
+}
+
+func (b *Bot) handleAuditCommand(ctx context.Context, msg *Message, lang string) error {
+	return b.sendChannelPicker(ctx, msg, lang, "audit", storage.RoleEditor, "audit_prompt")
+}
+
+func (b *Bot) handleAuditCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	return b.sendAuditLog(ctx, cb.Message.Chat.ID, cb.Message.ID, lang, p.ChannelID, p.Page)
+}
+
+// sendAuditLog menampilkan satu halaman log audit, yang terbaru lebih dulu.
+func (b *Bot) sendAuditLog(ctx context.Context, chatID int64, messageID int, lang string, channelID int64, page int) error {
+	if page < 1 {
+		page = 1
+	}
+	// Ambil satu event lebih banyak untuk mengetahui apakah ada halaman berikutnya
+	events, err := b.store.GetAuditEvents(ctx, channelID, (page-1)*auditPageSize, auditPageSize+1)
+	if err != nil {
+		log.Printf("error getting audit events for channel %d: %v", channelID, err)
+		return err
+	}
+	hasNext := len(events) > auditPageSize
+	if hasNext {
+		events = events[:auditPageSize]
+	}
+
+	var textBuilder strings.Builder
+	textBuilder.WriteString(i18n.GetMessage(lang, "audit_title", struct {
+		ChannelTitle string
+		Page         int
+	}{b.channelTitle(ctx, channelID), page}))
+	textBuilder.WriteString("\n\n")
+	if len(events) == 0 {
+		textBuilder.WriteString(i18n.GetMessage(lang, "audit_empty", nil))
+	}
+	for _, event := range events {
+		entryData := struct {
+			Date    string
+			Action  string
+			Target  string
+			ActorID int64
+			Before  string
+			After   string
+		}{
+			Date:    event.CreatedAt.Format("2006-01-02 15:04"),
+			Action:  i18n.GetMessage(lang, "audit_action_"+event.Action, nil),
+			Target:  event.Target,
+			ActorID: event.ActorID,
+			Before:  auditPreview(event.Before),
+			After:   auditPreview(event.After),
+		}
+		textBuilder.WriteString(i18n.GetMessage(lang, "audit_entry", entryData))
+		textBuilder.WriteString("\n\n")
+	}
+
+	var keyboard [][]InlineKeyboardButton
+	var navRow []InlineKeyboardButton
+	if page > 1 {
+		navRow = append(navRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "prev_button", nil), CallbackData: b.callbackData("audit", callbackParams{ChannelID: channelID, Page: page - 1})})
+	}
+	if hasNext {
+		navRow = append(navRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "next_button", nil), CallbackData: b.callbackData("audit", callbackParams{ChannelID: channelID, Page: page + 1})})
+	}
+	if len(navRow) > 0 {
+		keyboard = append(keyboard, navRow)
+	}
+	keyboard = append(keyboard, []InlineKeyboardButton{
+		{Text: i18n.GetMessage(lang, "audit_export_button", nil), CallbackData: b.callbackData("audit_export", callbackParams{ChannelID: channelID})},
+	})
+
+	return b.sendPlainText(ctx, chatID, messageID, textBuilder.String(), &InlineKeyboardMarkup{InlineKeyboard: keyboard})
+}
+
+// handleAuditExportCallback mengirim seluruh log audit channel sebagai file CSV.
+func (b *Bot) handleAuditExportCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	events, err := b.store.GetAuditEvents(ctx, p.ChannelID, 0, 0)
+	if err != nil {
+		log.Printf("error exporting audit events for channel %d: %v", p.ChannelID, err)
+		return b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{CallbackQueryID: cb.ID, Text: "An error occurred.", ShowAlert: true})
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"id", "created_at", "channel_id", "actor_user_id", "action", "target", "before", "after"})
+	for _, event := range events {
+		writer.Write([]string{
+			strconv.FormatInt(event.ID, 10),
+			event.CreatedAt.UTC().Format(time.RFC3339),
+			strconv.FormatInt(event.ChannelID, 10),
+			strconv.FormatInt(event.ActorID, 10),
+			event.Action,
+			event.Target,
+			event.Before,
+			event.After,
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write audit csv: %w", err)
+	}
+
+	b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{CallbackQueryID: cb.ID})
+	filename := fmt.Sprintf("audit_%d_%s.csv", p.ChannelID, time.Now().Format("20060102"))
+	caption := i18n.GetMessage(lang, "audit_export_caption", struct {
+		ChannelTitle string
+		Count        int
+	}{b.channelTitle(ctx, p.ChannelID), len(events)})
+	return b.api.SendDocumentFile(ctx, cb.Message.Chat.ID, filename, buf.Bytes(), caption)
+}
+
+// auditPreview memotong nilai before/after agar muat di tampilan log.
+func auditPreview(value string) string {
+	value = strings.ReplaceAll(value, "\n", " ")
+	runes := []rune(value)
+	if len(runes) > 60 {
+		return string(runes[:57]) + "..."
+	}
+	return value
+}
@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"context"
+	"log"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+// roleRank menentukan urutan hak akses; peran yang lebih tinggi
+// mencakup semua hak peran di bawahnya.
+var roleRank = map[string]int{
+	storage.RoleViewer: 1,
+	storage.RoleEditor: 2,
+	storage.RoleOwner:  3,
+}
+
+func roleAtLeast(role, required string) bool {
+	return roleRank[role] >= roleRank[required] && roleRank[role] > 0
+}
+
+// effectiveRole menentukan peran user di sebuah channel terdaftar:
+//   - pemilik adalah user yang mendaftarkan channel,
+//   - peran eksplisit dari undangan berlaku berikutnya,
+//   - admin Telegram tanpa peran eksplisit dianggap editor.
+//
+// explicitRole dan isAdmin hanya dipanggil jika dibutuhkan, karena keduanya
+// bisa berarti query ke storage atau Bot API. String kosong berarti user tidak
+// punya akses sama sekali.
+func effectiveRole(channel storage.RegisteredChannel, userID int64, explicitRole func() (string, bool, error), isAdmin func() (bool, error)) (string, error) {
+	if channel.OwnerID == userID {
+		return storage.RoleOwner, nil
+	}
+
+	role, found, err := explicitRole()
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return role, nil
+	}
+
+	admin, err := isAdmin()
+	if err != nil {
+		return "", err
+	}
+	if admin {
+		return storage.RoleEditor, nil
+	}
+	return "", nil
+}
+
+// channelRole mengembalikan peran user di channelID menurut effectiveRole.
+func (b *Bot) channelRole(ctx context.Context, channelID, userID int64) (string, error) {
+	channel, found, err := b.store.GetRegisteredChannel(ctx, channelID)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", nil
+	}
+	return effectiveRole(channel, userID,
+		func() (string, bool, error) { return b.store.GetChannelRole(ctx, channelID, userID) },
+		func() (bool, error) { return b.isUserAdmin(ctx, channelID, userID) },
+	)
+}
+
+// authorize adalah satu-satunya pintu pemeriksaan hak akses channel.
+func (b *Bot) authorize(ctx context.Context, channelID, userID int64, required string) bool {
+	role, err := b.channelRole(ctx, channelID, userID)
+	if err != nil {
+		log.Printf("could not resolve role of user %d in channel %d: %v", userID, channelID, err)
+		return false
+	}
+	if !roleAtLeast(role, required) {
+		log.Printf("user %d with role '%s' denied %s access to channel %d", userID, role, required, channelID)
+		return false
+	}
+	return true
+}
+
+// getChannelsWithRole mengembalikan channel terdaftar di mana user punya
+// setidaknya peran required, memakai daftar admin dari cache.
+func (b *Bot) getChannelsWithRole(ctx context.Context, userID int64, required string) ([]storage.RegisteredChannel, error) {
+	adminChannels, err := b.getAdminChannels(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	allChannels, err := b.store.GetRegisteredChannels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	explicitRoles, err := b.store.GetUserChannelRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	isAdmin := make(map[int64]bool)
+	for _, ch := range adminChannels {
+		isAdmin[ch.ChannelID] = true
+	}
+	roles := make(map[int64]string)
+	for _, r := range explicitRoles {
+		roles[r.ChannelID] = r.Role
+	}
+
+	var channels []storage.RegisteredChannel
+	for _, ch := range allChannels {
+		channelID := ch.ChannelID
+		role, _ := effectiveRole(ch, userID,
+			func() (string, bool, error) {
+				role, found := roles[channelID]
+				return role, found, nil
+			},
+			func() (bool, error) { return isAdmin[channelID], nil },
+		)
+		if roleAtLeast(role, required) {
+			channels = append(channels, ch)
+		}
+	}
+	return channels, nil
+}
+
+// sendChannelPicker menampilkan channel di mana user punya setidaknya peran
+// minRole, masing-masing dengan tombol action untuk halaman pertamanya.
+func (b *Bot) sendChannelPicker(ctx context.Context, msg *Message, lang, action, minRole, promptKey string) error {
+	channels, err := b.getChannelsWithRole(ctx, msg.From.ID, minRole)
+	if err != nil {
+		return err
+	}
+	if len(channels) == 0 {
+		text := i18n.GetMessage(lang, "learn_no_channels_found", nil)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text, ParseMode: "Markdown"})
+	}
+
+	var keyboard [][]InlineKeyboardButton
+	for _, channel := range channels {
+		keyboard = append(keyboard, []InlineKeyboardButton{
+			{Text: channel.Title, CallbackData: b.callbackData(action, callbackParams{ChannelID: channel.ChannelID, Page: 1})},
+		})
+	}
+
+	text := i18n.GetMessage(lang, promptKey, nil)
+	return b.api.SendMessage(ctx, SendMessagePayload{
+		ChatID:      msg.Chat.ID,
+		Text:        text,
+		ReplyMarkup: &InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+}
+
+// denyCallback menjawab callback dengan pesan "tidak berwenang".
+func (b *Bot) denyCallback(ctx context.Context, cb *CallbackQuery, lang string) error {
+	return b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{
+		CallbackQueryID: cb.ID, Text: i18n.GetMessage(lang, "unauthorized", nil), ShowAlert: true,
+	})
+}
@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+const blocklistPageSize = 8
+
+// BlockList menyimpan daftar blokir per channel di memori agar DM dari user
+// yang diblokir bisa diabaikan tanpa query ke database.
+type BlockList struct {
+	mu       sync.RWMutex
+	channels map[int64]map[int64]bool
+}
+
+func NewBlockList() *BlockList {
+	return &BlockList{channels: make(map[int64]map[int64]bool)}
+}
+
+func (l *BlockList) get(channelID int64) (map[int64]bool, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	users, found := l.channels[channelID]
+	return users, found
+}
+
+func (l *BlockList) set(channelID int64, users map[int64]bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.channels[channelID] = users
+}
+
+// Invalidate membuang daftar blokir channel agar dimuat ulang dari database.
+func (l *BlockList) Invalidate(channelID int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.channels, channelID)
+}
+
+// isBlocked memeriksa daftar blokir channel, memuatnya sekali dari database
+// jika belum ada di memori. Jika gagal dimuat, user dianggap tidak diblokir.
+func (b *Bot) isBlocked(ctx context.Context, channelID, userID int64) bool {
+	users, found := b.blocklist.get(channelID)
+	if !found {
+		blocked, err := b.store.GetBlockedUsers(ctx, channelID)
+		if err != nil {
+			log.Printf("could not load blocklist for channel %d: %v", channelID, err)
+			return false
+		}
+		users = make(map[int64]bool)
+		for _, u := range blocked {
+			users[u.UserID] = true
+		}
+		b.blocklist.set(channelID, users)
+	}
+	return users[userID]
+}
+
+// userLabel adalah nama yang ditampilkan untuk user di daftar blokir.
+func userLabel(user User) string {
+	label := user.FirstName
+	if user.Username != "" {
+		label = strings.TrimSpace(label + " @" + user.Username)
+	}
+	return label
+}
+
+func (b *Bot) blockUser(ctx context.Context, channelID, actorID, userID int64, name string) error {
+	blocked := storage.BlockedUser{ChannelID: channelID, UserID: userID, Name: name, BlockedBy: actorID}
+	if err := b.store.BlockUser(ctx, blocked); err != nil {
+		return err
+	}
+	b.blocklist.Invalidate(channelID)
+	b.recordAudit(ctx, channelID, actorID, storage.AuditBlock, blockedTarget(userID, name), "", "")
+	log.Printf("user %d blocked user %d in channel %d", actorID, userID, channelID)
+	return nil
+}
+
+func blockedTarget(userID int64, name string) string {
+	if name == "" {
+		return strconv.FormatInt(userID, 10)
+	}
+	return fmt.Sprintf("%s (%d)", name, userID)
+}
+
+func (b *Bot) handleBlocklistCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	// Kembali dari prompt blokir membatalkan sesi yang menunggu user
+	b.states.ClearState(cb.From.ID)
+	return b.sendBlocklist(ctx, cb.Message.Chat.ID, cb.Message.ID, lang, p.ChannelID, p.Page)
+}
+
+// handleBlockPromptCallback meminta admin meneruskan pesan dari user atau mengirim ID-nya.
+func (b *Bot) handleBlockPromptCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	b.states.SetState(cb.From.ID, &UserState{Step: "awaiting_block_user", ChannelID: p.ChannelID})
+	text := i18n.GetMessage(lang, "block_awaiting_user", struct{ ChannelTitle string }{b.channelTitle(ctx, p.ChannelID)})
+	keyboard := InlineKeyboardMarkup{
+		InlineKeyboard: [][]InlineKeyboardButton{
+			{{Text: i18n.GetMessage(lang, "back_button", nil), CallbackData: b.callbackData("blocklist", callbackParams{ChannelID: p.ChannelID, Page: 1})}},
+		},
+	}
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: cb.Message.Chat.ID, MessageID: cb.Message.ID, Text: text, ReplyMarkup: &keyboard})
+}
+
+func (b *Bot) handleBlockUserMessage(ctx context.Context, msg *Message, state *UserState, lang string) error {
+	var userID int64
+	var name string
+	origin := msg.ForwardOrigin
+	switch {
+	case origin != nil && origin.SenderUser != nil:
+		userID, name = origin.SenderUser.ID, userLabel(*origin.SenderUser)
+	case msg.ForwardFrom != nil:
+		userID, name = msg.ForwardFrom.ID, userLabel(*msg.ForwardFrom)
+	case origin != nil && origin.Type == "hidden_user":
+		// Pengirim menyembunyikan akunnya saat diteruskan
+		text := i18n.GetMessage(lang, "block_hidden_sender", nil)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+	default:
+		id, err := strconv.ParseInt(strings.TrimSpace(msg.Text), 10, 64)
+		if err != nil || id <= 0 {
+			text := i18n.GetMessage(lang, "block_invalid_user", nil)
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+		}
+		userID = id
+	}
+
+	if err := b.blockUser(ctx, state.ChannelID, msg.From.ID, userID, name); err != nil {
+		log.Printf("failed to block user %d in channel %d: %v", userID, state.ChannelID, err)
+		b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: "An error occurred."})
+		return err
+	}
+	b.states.ClearState(msg.From.ID)
+
+	text := i18n.GetMessage(lang, "block_success", struct{ User string }{blockedTarget(userID, name)})
+	b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+	return b.sendBlocklist(ctx, msg.Chat.ID, 0, lang, state.ChannelID, 1)
+}
+
+// handleBlockUserCallback dipakai tombol blokir pada pesan yang diteruskan ke admin.
+func (b *Bot) handleBlockUserCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	if err := b.blockUser(ctx, p.ChannelID, cb.From.ID, p.UserID, p.Value); err != nil {
+		log.Printf("failed to block user %d in channel %d: %v", p.UserID, p.ChannelID, err)
+		return b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{CallbackQueryID: cb.ID, Text: "An error occurred.", ShowAlert: true})
+	}
+	text := i18n.GetMessage(lang, "block_success", struct{ User string }{blockedTarget(p.UserID, p.Value)})
+	return b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{CallbackQueryID: cb.ID, Text: text, ShowAlert: true})
+}
+
+func (b *Bot) handleUnblockCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	if err := b.store.UnblockUser(ctx, p.ChannelID, p.UserID); err != nil {
+		log.Printf("failed to unblock user %d in channel %d: %v", p.UserID, p.ChannelID, err)
+		return err
+	}
+	b.blocklist.Invalidate(p.ChannelID)
+	b.recordAudit(ctx, p.ChannelID, cb.From.ID, storage.AuditUnblock, blockedTarget(p.UserID, p.Value), "", "")
+	log.Printf("user %d unblocked user %d in channel %d", cb.From.ID, p.UserID, p.ChannelID)
+	return b.sendBlocklist(ctx, cb.Message.Chat.ID, cb.Message.ID, lang, p.ChannelID, p.Page)
+}
+
+// sendBlocklist menampilkan user yang diblokir beserta tombol buka blokir.
+// messageID 0 berarti kirim sebagai pesan baru.
+func (b *Bot) sendBlocklist(ctx context.Context, chatID int64, messageID int, lang string, channelID int64, page int) error {
+	blocked, err := b.store.GetBlockedUsers(ctx, channelID)
+	if err != nil {
+		log.Printf("error getting blocklist for channel %d: %v", channelID, err)
+		return err
+	}
+
+	totalPages := (len(blocked) + blocklistPageSize - 1) / blocklistPageSize
+	if totalPages == 0 {
+		totalPages = 1
+	}
+	if page < 1 || page > totalPages {
+		page = 1
+	}
+	start := (page - 1) * blocklistPageSize
+	end := start + blocklistPageSize
+	if end > len(blocked) {
+		end = len(blocked)
+	}
+
+	var textBuilder strings.Builder
+	textBuilder.WriteString(i18n.GetMessage(lang, "blocklist_title", struct {
+		ChannelTitle string
+		Count        int
+	}{b.channelTitle(ctx, channelID), len(blocked)}))
+	textBuilder.WriteString("\n\n")
+	if len(blocked) == 0 {
+		textBuilder.WriteString(i18n.GetMessage(lang, "blocklist_empty", nil))
+	}
+
+	var keyboard [][]InlineKeyboardButton
+	for i, user := range blocked[start:end] {
+		number := start + i + 1
+		textBuilder.WriteString(i18n.GetMessage(lang, "blocklist_entry", struct {
+			Number int
+			User   string
+			Date   string
+		}{number, blockedTarget(user.UserID, user.Name), user.CreatedAt.Format("2006-01-02")}))
+		textBuilder.WriteString("\n")
+
+		keyboard = append(keyboard, []InlineKeyboardButton{
+			{Text: i18n.GetMessage(lang, "unblock_button", struct{ Number int }{number}), CallbackData: b.callbackData("unblock", callbackParams{ChannelID: channelID, UserID: user.UserID, Value: user.Name, Page: page})},
+		})
+	}
+
+	var navRow []InlineKeyboardButton
+	if page > 1 {
+		navRow = append(navRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "prev_button", nil), CallbackData: b.callbackData("blocklist", callbackParams{ChannelID: channelID, Page: page - 1})})
+	}
+	if page < totalPages {
+		navRow = append(navRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "next_button", nil), CallbackData: b.callbackData("blocklist", callbackParams{ChannelID: channelID, Page: page + 1})})
+	}
+	if len(navRow) > 0 {
+		keyboard = append(keyboard, navRow)
+	}
+	keyboard = append(keyboard,
+		[]InlineKeyboardButton{{Text: i18n.GetMessage(lang, "block_add_button", nil), CallbackData: b.callbackData("block_prompt", callbackParams{ChannelID: channelID})}},
+		[]InlineKeyboardButton{{Text: i18n.GetMessage(lang, "back_to_manage_button", nil), CallbackData: b.callbackData("manage", callbackParams{ChannelID: channelID, Page: 1})}},
+	)
+
+	return b.sendPlainText(ctx, chatID, messageID, textBuilder.String(), &InlineKeyboardMarkup{InlineKeyboard: keyboard})
+}
@@ -1,78 +1,255 @@
 package bot
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strconv"
 	"strings" 
+	"sync"
 	"text/template"
+	"time"
 
 	"telegram-dm-bot/config"
 	"telegram-dm-bot/i18n"
 	"telegram-dm-bot/storage"
 )
 
+const (
+	// Batas waktu menunggu update yang sedang diproses saat bot dihentikan
+	shutdownTimeout   = 20 * time.Second
+	finalFlushTimeout = 10 * time.Second
+)
+
 type Bot struct {
-	api    *API
+	api    TelegramClient
 	store  storage.Storage
 	states *StateManager
 	cache  *AdminCache 
 	botUsername string // <-- Tambahkan field baru untuk menyimpan username
+	callbacks *CallbackRegistry
+	routes    map[string]callbackRoute
+	hits      *HitCounter
+	unanswered *UnansweredBuffer
+	activity   *ActivityCounter
+	broadcasts *BroadcastRunner
+	blocklist  *BlockList
+	flood      *FloodDetector
+	triggers   *TriggerCache
+	parents    *ParentChatCache
+	notifier   *UnmatchedNotifier
+	cfg        *config.Config
+	updates    *UpdatePool
+	tracker    *UpdateTracker
+	health     *HealthState
+	inflight   sync.WaitGroup // digest, broadcast dan goroutine latar yang sedang berjalan
 }
 
-func NewBot(cfg *config.Config, store storage.Storage) *Bot {
-	api := NewAPI(cfg.BotToken)
+func NewBot(ctx context.Context, cfg *config.Config, store storage.Storage) *Bot {
+	return NewBotWithClient(ctx, cfg, store, NewAPI(cfg))
+}
 
+// NewBotWithClient membuat bot yang berbicara dengan Telegram lewat api,
+// misalnya client palsu di test.
+func NewBotWithClient(ctx context.Context, cfg *config.Config, store storage.Storage, api TelegramClient) *Bot {
 	// 1. Declare botInfo by calling api.GetMe()
-	botInfo, err := api.GetMe()
+	botInfo, err := api.GetMe(ctx)
 	if err != nil {
 		// If getMe fails, stop the bot immediately (Fatal error)
 		log.Fatalf("FATAL: Could not get bot info (getMe failed): %v", err)
 	}
-	return &Bot{
-		api:    NewAPI(cfg.BotToken),
+	b := &Bot{
+		api:    api,
 		store:  store,
 		states: NewStateManager(),
 		cache:  NewAdminCache(), 
 		botUsername: botInfo.Username, // <-- Simpan username di sini
+		callbacks: NewCallbackRegistry(callbackTokenTTL),
+		hits:      NewHitCounter(),
+		unanswered: NewUnansweredBuffer(),
+		activity:   NewActivityCounter(),
+		broadcasts: NewBroadcastRunner(broadcastRate),
+		blocklist:  NewBlockList(),
+		flood:      NewFloodDetector(),
+		triggers:   NewTriggerCache(),
+		parents:    NewParentChatCache(),
+		notifier:   NewUnmatchedNotifier(),
+		cfg:        cfg,
+		updates:    NewUpdatePool(cfg.WorkerCount, cfg.UpdateQueueLength),
+		tracker:    NewUpdateTracker(),
+		health:     NewHealthState(),
 	}
+	b.registerCallbackRoutes()
+	return b
 }
 
-func (b *Bot) Start() {
+// Start menjalankan bot sampai ctx selesai (SIGINT/SIGTERM dari main). Setelah
+// itu pengambilan update berhenti, update yang sedang diproses diberi waktu
+// hingga shutdownTimeout, lalu buffer statistik disimpan untuk terakhir kali.
+// Error dikembalikan jika bot berhenti karena kesalahan fatal, misalnya token
+// yang dicabut.
+func (b *Bot) Start(ctx context.Context) error {
 	log.Println("bot is starting...")
-	var offset int
+	// Handler memakai context sendiri agar tidak langsung batal saat sinyal
+	// masuk; context ini baru dibatalkan jika batas waktu drain terlewati.
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+	// runCtx juga dibatalkan ketika polling atau webhook berhenti karena error
+	runCtx, stopRun := context.WithCancel(ctx)
+	defer stopRun()
+
+	// Goroutine latar juga dihitung di inflight agar shutdown menunggu
+	// keduanya berhenti sebelum penyimpanan terakhir
+	b.inflight.Add(2)
+	go func() {
+		defer b.inflight.Done()
+		b.runStatsFlusher(runCtx, statsFlushInterval)
+	}()
+	go func() {
+		defer b.inflight.Done()
+		b.runDigestScheduler(runCtx, handlerCtx)
+	}()
+	if b.cfg.HealthListenAddr != "" {
+		go b.runHealthServer(runCtx)
+	}
+	b.updates.Run(func(update Update) {
+		b.processUpdate(handlerCtx, update)
+	})
+
+	var err error
+	if b.cfg.UpdateMode == config.UpdateModeWebhook {
+		err = b.runWebhook(runCtx)
+	} else {
+		err = b.runPolling(runCtx)
+	}
+	if err != nil {
+		log.Printf("bot stopped receiving updates: %v", err)
+		b.health.stop(err)
+	}
+	stopRun()
+	b.shutdown(cancelHandlers)
+	return err
+}
+
+// runPolling mengambil update dengan long polling sampai ctx selesai, mulai
+// dari offset yang tersimpan. Webhook yang masih terdaftar dihapus dulu karena
+// Telegram menolak getUpdates selama webhook aktif. Kegagalan sementara dicoba
+// ulang dengan backoff; token yang ditolak atau instance lain yang sedang
+// polling menghentikan bot.
+//
+// Telegram menganggap semua update di bawah offset getUpdates berikutnya sudah
+// diterima dan tidak mengirimnya lagi. Karena itu update yang masih di antrean
+// worker pool hilang jika proses mati mendadak (crash atau SIGKILL); offset
+// yang disimpan hanya melindungi update yang belum sempat diambil. Berhenti
+// dengan SIGINT/SIGTERM tetap memproses seluruh antrean.
+func (b *Bot) runPolling(ctx context.Context) error {
+	if err := b.api.DeleteWebhook(ctx, DeleteWebhookPayload{}); err != nil {
+		log.Printf("could not delete webhook before polling: %v", err)
+	}
+	offset, err := b.store.GetUpdateOffset(ctx)
+	if err != nil {
+		log.Printf("could not load stored update offset, starting from the oldest pending update: %v", err)
+	}
+	b.tracker.reset(offset)
 	for {
-		updates, err := b.api.GetUpdates(offset)
+		updates, err := b.api.GetUpdates(ctx, offset)
+		if ctx.Err() != nil {
+			return nil
+		}
 		if err != nil {
-			log.Printf("error getting updates: %v", err)
+			switch {
+			case IsUnauthorized(err):
+				return fmt.Errorf("bot token was rejected: %w", err)
+			case IsWebhookConflict(err):
+				// Webhook didaftarkan lagi dari luar; hapus dan lanjutkan polling
+				log.Printf("webhook is active, removing it to continue polling")
+				if err := b.api.DeleteWebhook(ctx, DeleteWebhookPayload{}); err != nil {
+					log.Printf("could not delete webhook: %v", err)
+				}
+			case IsConflict(err):
+				return fmt.Errorf("another instance is polling with the same token: %w", err)
+			}
+
+			failures := b.health.pollFailed(err)
+			delay := jitteredBackoff(failures, pollBackoffBase, pollBackoffMax)
+			log.Printf("error getting updates (%d in a row), retrying in %s: %v", failures, delay.Round(time.Millisecond), err)
+			if sleepContext(ctx, delay) != nil {
+				return nil
+			}
 			continue
 		}
+		b.health.pollSucceeded(time.Now())
+
 		for _, update := range updates {
+			// Offset hanya maju untuk update yang sudah masuk antrean; sisanya
+			// dikirim ulang oleh Telegram setelah bot dijalankan kembali
+			if !b.dispatch(ctx, update) {
+				return nil
+			}
 			offset = update.ID + 1
-			// Jalankan handleUpdate di goroutine baru.
-			// Kata kunci 'go' adalah inti dari perubahan ini.
-			go func(u Update) {
-				if err := b.handleUpdate(u); err != nil {
-					log.Printf("error handling update %d: %v", u.ID, err)
-				}
-			}(update)
 		}
+		b.commitOffset(ctx)
 	}
 }
 
+// dispatch memasukkan update ke antrean worker pool. Dipakai oleh mode polling
+// maupun webhook. Menunggu selama antrean penuh; false berarti ctx selesai
+// sebelum update masuk antrean.
+func (b *Bot) dispatch(ctx context.Context, update Update) bool {
+	// Update yang gagal masuk antrean tetap tercatat tertunda agar offset yang
+	// disimpan tidak melewatinya
+	b.tracker.begin(update.ID)
+	return b.updates.Submit(ctx, update)
+}
+
+// shutdown menunggu handler yang masih berjalan, membatalkannya jika melewati
+// shutdownTimeout, lalu menyimpan buffer yang tersisa dan menutup koneksi.
+func (b *Bot) shutdown(cancelHandlers context.CancelFunc) {
+	log.Println("bot is stopping, waiting for in-flight updates...")
+	b.broadcasts.cancelAll()
+
+	drained := make(chan struct{})
+	go func() {
+		b.updates.Close()
+		b.inflight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(shutdownTimeout):
+		log.Printf("in-flight updates did not finish within %s, cancelling them", shutdownTimeout)
+		cancelHandlers()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), finalFlushTimeout)
+	defer cancel()
+	b.flushStats(ctx)
+	b.flushUnanswered(ctx)
+	b.flushActivity(ctx)
+	b.flushCallbacks(ctx)
+	if b.cfg.UpdateMode == config.UpdateModePolling {
+		b.commitOffset(ctx)
+	}
+	b.api.Close()
+	log.Println("bot stopped")
+}
+
 // handleUpdate sekarang menjadi router utama
-func (b *Bot) handleUpdate(update Update) error {
+func (b *Bot) handleUpdate(ctx context.Context, update Update) error {
 	if update.CallbackQuery != nil {
-		return b.handleCallbackQuery(update.CallbackQuery)
+		return b.handleCallbackQuery(ctx, update.CallbackQuery)
 	}
 	if update.Message != nil {
-		return b.handleMessage(update.Message)
+		return b.handleMessage(ctx, update.Message)
+	}
+	if update.MyChatMember != nil {
+		return b.handleMyChatMember(ctx, update.MyChatMember)
 	}
 	return nil
 }
 
-func (b *Bot) getUserLang(userID int64, defaultLang string) string {
-	lang, found, err := b.store.GetUserLanguage(userID)
+func (b *Bot) getUserLang(ctx context.Context, userID int64, defaultLang string) string {
+	lang, found, err := b.store.GetUserLanguage(ctx, userID)
 	if err != nil {
 		log.Printf("error getting user language: %v", err)
 		return defaultLang // Fallback ke default jika ada error
@@ -84,40 +261,56 @@ func (b *Bot) getUserLang(userID int64, defaultLang string) string {
 }
 
 // Menangani semua pesan teks
-func (b *Bot) handleMessage(msg *Message) error {
+func (b *Bot) handleMessage(ctx context.Context, msg *Message) error {
 	log.Printf("received message from user %d in chat %d: '%s'", msg.From.ID, msg.Chat.ID, msg.Text)
-	userLang := b.getUserLang(msg.From.ID, msg.From.LangCode)
+	userLang := b.getUserLang(ctx, msg.From.ID, msg.From.LangCode)
 
 	// Perintah non-sesi
 	switch {
 	case strings.HasPrefix(msg.Text, "/start"):
-		return b.handleStartCommand(msg, userLang)
+		return b.handleStartCommand(ctx, msg, userLang)
 	case strings.HasPrefix(msg.Text, "/help"):
-		return b.sendHelpMenu(msg.Chat.ID, userLang)
+		return b.sendHelpMenu(ctx, msg.Chat.ID, userLang)
 	case strings.HasPrefix(msg.Text, "/register"):
-		return b.handleRegisterCommand(msg, userLang)
+		return b.handleRegisterCommand(ctx, msg, userLang)
 	case strings.HasPrefix(msg.Text, "/manage"): // Tambahkan perintah baru
-		return b.handleManageCommand(msg, userLang)
+		return b.handleManageCommand(ctx, msg, userLang)
 	case strings.HasPrefix(msg.Text, "/lang"):
-		return b.handleLangCommand(msg, userLang)
+		return b.handleLangCommand(ctx, msg, userLang)
 	case strings.HasPrefix(msg.Text, "/cancel"):
-		return b.handleCancelCommand(msg, userLang)
+		return b.handleCancelCommand(ctx, msg, userLang)
+	case strings.HasPrefix(msg.Text, "/test"):
+		return b.handleTestCommand(ctx, msg, userLang)
+	case strings.HasPrefix(msg.Text, "/settings"):
+		return b.handleSettingsCommand(ctx, msg, userLang)
+	case strings.HasPrefix(msg.Text, "/stats"):
+		return b.handleStatsCommand(ctx, msg, userLang)
+	case strings.HasPrefix(msg.Text, "/unanswered"):
+		return b.handleUnansweredCommand(ctx, msg, userLang)
+	case strings.HasPrefix(msg.Text, "/subscribers"):
+		return b.handleSubscribersCommand(ctx, msg, userLang)
+	case strings.HasPrefix(msg.Text, "/broadcast"):
+		return b.handleBroadcastCommand(ctx, msg, userLang)
+	case strings.HasPrefix(msg.Text, "/audit"):
+		return b.handleAuditCommand(ctx, msg, userLang)
+	case strings.HasPrefix(msg.Text, "/unregister"):
+		return b.handleUnregisterCommand(ctx, msg, userLang)
 	}
 
 	// Cek apakah pengguna sedang dalam sesi interaktif
 	state, inSession := b.states.GetState(msg.From.ID)
 	if inSession {
-		return b.handleSessionMessage(msg, state, userLang)
+		return b.handleSessionMessage(ctx, msg, state, userLang)
 	}
 
 	// Perintah /learn hanya bisa dimulai jika tidak ada sesi
 	if strings.HasPrefix(msg.Text, "/learn") {
-		return b.handleLearnCommand(msg, userLang)
+		return b.handleLearnCommand(ctx, msg, userLang)
 	}
 
 	// Terakhir, logika balasan otomatis
 	if msg.Chat.IsDirectMessages && msg.DirectMessagesTopic.TopicID != 0 {
-		return b.handleAutoReply(msg)
+		return b.handleAutoReply(ctx, msg)
 	}
 
 	return nil
@@ -125,7 +318,12 @@ func (b *Bot) handleMessage(msg *Message) error {
 
 // ----- FUNGSI-FUNGSI COMMAND BARU -----
 
-func (b *Bot) handleStartCommand(msg *Message, lang string) error {
+func (b *Bot) handleStartCommand(ctx context.Context, msg *Message, lang string) error {
+	// Deep link undangan kolaborator: /start inv_<token>
+	if parts := strings.Fields(msg.Text); len(parts) == 2 && strings.HasPrefix(parts[1], invitePrefix) {
+		return b.handleInviteStart(ctx, msg, lang, strings.TrimPrefix(parts[1], invitePrefix))
+	}
+
 	text := i18n.GetMessage(lang, "start_message", nil)
 	addToChannelURL := fmt.Sprintf("https://t.me/%s?startgroup=start&admin=post_messages", b.botUsername)
 	keyboard := InlineKeyboardMarkup{
@@ -139,7 +337,7 @@ func (b *Bot) handleStartCommand(msg *Message, lang string) error {
 			},
 		},
 	}
-	return b.api.SendMessage(SendMessagePayload{
+	return b.api.SendMessage(ctx, SendMessagePayload{
 		ChatID:      msg.Chat.ID,
 		Text:        text,
 		ParseMode:   "Markdown",
@@ -149,25 +347,17 @@ func (b *Bot) handleStartCommand(msg *Message, lang string) error {
 
 // --- AWAL PERUBAHAN ---
 // FUNGSI BARU
-func (b *Bot) handleManageCommand(msg *Message, lang string) error {
-	// Logikanya mirip dengan /learn: ambil channel terdaftar dimana user adalah admin
-	registeredChannels, err := b.store.GetRegisteredChannels()
+func (b *Bot) handleManageCommand(ctx context.Context, msg *Message, lang string) error {
+	// Logikanya mirip dengan /learn, tapi cukup peran viewer untuk melihat dasbor
+	userAdminChannels, err := b.getChannelsWithRole(ctx, msg.From.ID, storage.RoleViewer)
 	if err != nil {
 		log.Printf("error getting registered channels: %v", err)
 		return err
 	}
 
-	var userAdminChannels []storage.RegisteredChannel
-	for _, channel := range registeredChannels {
-		isAdmin, _ := b.isUserAdmin(channel.ChannelID, msg.From.ID)
-		if isAdmin {
-			userAdminChannels = append(userAdminChannels, channel)
-		}
-	}
-
 	if len(userAdminChannels) == 0 {
 		text := i18n.GetMessage(lang, "learn_no_channels_found", nil)
-		return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text, ParseMode: "Markdown"})
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text, ParseMode: "Markdown"})
 	}
 
 	// Buat tombol, tapi dengan callback data yang berbeda
@@ -175,13 +365,13 @@ func (b *Bot) handleManageCommand(msg *Message, lang string) error {
 	for _, channel := range userAdminChannels {
 		button := InlineKeyboardButton{
 			Text:         channel.Title,
-			CallbackData: fmt.Sprintf("manage_ch_%d_page_1", channel.ChannelID), // Arahkan ke halaman 1
+			CallbackData: b.callbackData("manage", callbackParams{ChannelID: channel.ChannelID, Page: 1}), // Arahkan ke halaman 1
 		}
 		keyboard = append(keyboard, []InlineKeyboardButton{button})
 	}
 
 	text := i18n.GetMessage(lang, "manage_prompt", nil)
-	return b.api.SendMessage(SendMessagePayload{
+	return b.api.SendMessage(ctx, SendMessagePayload{
 		ChatID:      msg.Chat.ID,
 		Text:        text,
 		ReplyMarkup: &InlineKeyboardMarkup{InlineKeyboard: keyboard},
@@ -189,7 +379,7 @@ func (b *Bot) handleManageCommand(msg *Message, lang string) error {
 }
 // --- AKHIR PERUBAHAN ---
 
-func (b *Bot) sendHelpMenu(chatID int64, lang string) error {
+func (b *Bot) sendHelpMenu(ctx context.Context, chatID int64, lang string) error {
 	text := i18n.GetMessage(lang, "help_main_text", nil)
 	keyboard := InlineKeyboardMarkup{
 		InlineKeyboard: [][]InlineKeyboardButton{
@@ -207,7 +397,7 @@ func (b *Bot) sendHelpMenu(chatID int64, lang string) error {
 			},
 		},
 	}
-	return b.api.SendMessage(SendMessagePayload{
+	return b.api.SendMessage(ctx, SendMessagePayload{
 		ChatID:      chatID,
 		Text:        text,
 		ParseMode:   "Markdown",
@@ -215,7 +405,7 @@ func (b *Bot) sendHelpMenu(chatID int64, lang string) error {
 	})
 }
 
-func (b *Bot) handleLangCommand(msg *Message, lang string) error {
+func (b *Bot) handleLangCommand(ctx context.Context, msg *Message, lang string) error {
 	text := i18n.GetMessage(lang, "lang_prompt", nil)
 	keyboard := InlineKeyboardMarkup{
 		InlineKeyboard: [][]InlineKeyboardButton{
@@ -224,7 +414,7 @@ func (b *Bot) handleLangCommand(msg *Message, lang string) error {
 			{{Text: "🇷🇺 Русский", CallbackData: "lang_ru"}},
 		},
 	}
-	return b.api.SendMessage(SendMessagePayload{
+	return b.api.SendMessage(ctx, SendMessagePayload{
 		ChatID:      msg.Chat.ID,
 		Text:        text,
 		ReplyMarkup: &keyboard,
@@ -235,51 +425,46 @@ func (b *Bot) handleLangCommand(msg *Message, lang string) error {
 // FUNGSI BARU
 // --- AWAL PERUBAHAN ---
 // FUNGSI LENGKAP YANG DIPERBARUI
-func (b *Bot) handleRegisterCommand(msg *Message, lang string) error {
+func (b *Bot) handleRegisterCommand(ctx context.Context, msg *Message, lang string) error {
 	parts := strings.Split(msg.Text, " ")
 
 	if len(parts) == 1 {
 		b.states.SetState(msg.From.ID, &UserState{Step: "awaiting_registration_forward"})
 		text := i18n.GetMessage(lang, "register_prompt_forward", nil)
-		return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text, ParseMode: "Markdown"})
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text, ParseMode: "Markdown"})
 	}
 
 	if len(parts) == 2 {
-		var chatIdentifier interface{}
-		arg := parts[1]
-
-		if chatID, err := strconv.ParseInt(arg, 10, 64); err == nil {
-			chatIdentifier = chatID
-		} else if strings.HasPrefix(arg, "@") {
-			chatIdentifier = arg
-		} else {
+		chatIdentifier, ok := parseChatIdentifier(parts[1])
+		if !ok {
 			text := i18n.GetMessage(lang, "register_usage", nil)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
 		}
 
-		channelInfo, err := b.api.GetChat(chatIdentifier)
+		channelInfo, err := b.api.GetChat(ctx, chatIdentifier)
 		if err != nil {
 			log.Printf("register failed for %v: could not get chat info: %v", chatIdentifier, err)
 			text := i18n.GetMessage(lang, "register_fail_not_found", nil)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
 		}
 
-		isAdmin, err := b.isUserAdmin(channelInfo.ID, msg.From.ID)
+		isAdmin, err := b.isUserAdmin(ctx, channelInfo.ID, msg.From.ID)
 		if err != nil {
 			log.Printf("error checking admin status for %v: %v", chatIdentifier, err)
 			errorText := fmt.Sprintf("❌ Failed to verify admin status. Make sure I am an administrator in '%s' and try again in a few seconds. (API Error: %v)", channelInfo.Title, err)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: errorText})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: errorText})
 		}
 		if !isAdmin {
 			log.Printf("register failed for %v: user %d is not admin.", chatIdentifier, msg.From.ID)
 			text := i18n.GetMessage(lang, "register_fail_not_admin", nil)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
 		}
 
-		if err := b.store.RegisterChannel(channelInfo.ID, channelInfo.Title, msg.From.ID); err != nil {
+		if err := b.store.RegisterChannel(ctx, channelInfo.ID, channelInfo.Title, msg.From.ID); err != nil {
 			log.Printf("register failed for %v: could not save to storage: %v", chatIdentifier, err)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: "An internal error occurred."})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: "An internal error occurred."})
 		}
+		b.recordAudit(ctx, channelInfo.ID, msg.From.ID, storage.AuditRegister, channelInfo.Title, "", "")
 
 		// BEFORE
 		// b.cache.Set(msg.From.ID, nil) // Invalidate cache after successful direct registration
@@ -289,260 +474,270 @@ func (b *Bot) handleRegisterCommand(msg *Message, lang string) error {
 
 		data := struct{ ChannelTitle string }{ChannelTitle: channelInfo.Title}
 		text := i18n.GetMessage(lang, "register_success", data)
-		return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text, ParseMode: "Markdown"})
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text, ParseMode: "Markdown"})
 	}
 
 	text := i18n.GetMessage(lang, "register_usage", nil)
-	return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+	return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
 }
 // --- AKHIR PERUBAHAN ---
 
-func (b *Bot) handleCancelCommand(msg *Message, lang string) error {
+// parseChatIdentifier menerima "@username" atau chat ID numerik.
+func parseChatIdentifier(arg string) (interface{}, bool) {
+	if chatID, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return chatID, true
+	}
+	if strings.HasPrefix(arg, "@") {
+		return arg, true
+	}
+	return nil, false
+}
+
+func (b *Bot) handleCancelCommand(ctx context.Context, msg *Message, lang string) error {
 	_, inSession := b.states.GetState(msg.From.ID)
 	if inSession {
 		b.states.ClearState(msg.From.ID)
 		text := i18n.GetMessage(lang, "cancel_message", nil)
-		return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
 	}
 
 	text := i18n.GetMessage(lang, "cancel_fail", nil)
-	return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+	return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
 }
 
 // Menangani klik tombol
 // --- AWAL PERUBAHAN ---
 // FUNGSI LENGKAP YANG DIPERBARUI
-func (b *Bot) handleCallbackQuery(cb *CallbackQuery) error {
+func (b *Bot) handleCallbackQuery(ctx context.Context, cb *CallbackQuery) error {
 	userID := cb.From.ID
-	lang := b.getUserLang(userID, cb.From.LangCode)
-	data := cb.Data
+	lang := b.getUserLang(ctx, userID, cb.From.LangCode)
+
+	log.Printf("received callback from user %d with data: %s", userID, cb.Data)
+
+	entry, found := b.resolveCallback(ctx, cb.Data)
+	route, known := b.routes[entry.Action]
+	if !found || !known {
+		return b.expiredCallback(ctx, cb, lang)
+	}
+
+	// Semua callback yang terikat channel diperiksa di satu tempat
+	if !b.guardCallback(ctx, cb, route, entry.Params) {
+		return b.denyCallback(ctx, cb, lang)
+	}
+
+	err := route.Handle(ctx, cb, lang, entry.Params)
+	if IsMessageNotModified(err) {
+		// Tombol yang sama ditekan lagi tanpa ada perubahan, cukup hentikan loading tombol
+		return b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{CallbackQueryID: cb.ID})
+	}
+	return err
+}
+
+func (b *Bot) handleLearnTypeCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
 	chatID := cb.Message.Chat.ID
 	messageID := cb.Message.ID
+	responseType := p.Value
+	state, found := b.states.GetState(cb.From.ID)
+	if !found { // Sesi hilang, batalkan
+		b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: chatID, MessageID: messageID, Text: "Session expired."})
+		return nil
+	}
+	
+	state.Step = fmt.Sprintf("awaiting_%s", responseType) // misal: "awaiting_sticker"
+	state.ResponseType = responseType
+	b.states.SetState(cb.From.ID, state)
+	
+	promptTextKey := fmt.Sprintf("learn_awaiting_%s", responseType) // misal: "learn_awaiting_sticker"
+	promptText := i18n.GetMessage(lang, promptTextKey, nil)
+	
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{
+		ChatID: chatID, MessageID: messageID, Text: promptText, ParseMode: "Markdown",
+	})
+}
 
-	log.Printf("received callback from user %d with data: %s", userID, data)
+func (b *Bot) handleDeletePromptCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	// Ambil info trigger dari database untuk mendapatkan teksnya
+	triggerRecord, found, err := b.store.GetTriggerByID(ctx, p.TriggerID)
+	if err != nil || !found {
+		// Handle error jika trigger tidak ditemukan
+		return nil
+	}
 
-	// Jawab callback-nya dulu agar tidak loading
-	if data == "noop" {
-		return b.api.AnswerCallbackQuery(AnswerCallbackQueryPayload{CallbackQueryID: cb.ID})
+	textData := struct{ Trigger string }{Trigger: triggerRecord.TriggerText}
+	text := i18n.GetMessage(lang, "confirm_delete_prompt", textData)
+	keyboard := InlineKeyboardMarkup{
+		InlineKeyboard: [][]InlineKeyboardButton{
+			{
+				{Text: i18n.GetMessage(lang, "confirm_delete_button", nil), CallbackData: b.callbackData("del_confirm", p)},
+				{Text: i18n.GetMessage(lang, "cancel_delete_button", nil), CallbackData: b.callbackData("manage", callbackParams{ChannelID: p.ChannelID, Page: p.Page})},
+			},
+		},
 	}
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{
+		ChatID: cb.Message.Chat.ID, MessageID: cb.Message.ID, Text: text, ParseMode: "Markdown", ReplyMarkup: &keyboard,
+	})
+}
 
-	if strings.HasPrefix(data, "learn_type_") {
-		responseType := strings.TrimPrefix(data, "learn_type_")
-		state, found := b.states.GetState(userID)
-		if !found { // Sesi hilang, batalkan
-			b.api.EditMessageText(EditMessageTextPayload{ChatID: chatID, MessageID: messageID, Text: "Session expired."})
-			return nil
-		}
-		
-		state.Step = fmt.Sprintf("awaiting_%s", responseType) // misal: "awaiting_sticker"
-		state.ResponseType = responseType
-		b.states.SetState(userID, state)
-		
-		promptTextKey := fmt.Sprintf("learn_awaiting_%s", responseType) // misal: "learn_awaiting_sticker"
-		promptText := i18n.GetMessage(lang, promptTextKey, nil)
-		
-		return b.api.EditMessageText(EditMessageTextPayload{
-			ChatID: chatID, MessageID: messageID, Text: promptText, ParseMode: "Markdown",
-		})
+func (b *Bot) handleDeleteConfirmCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	// Ambil record dulu untuk dapatkan teksnya sebelum dihapus
+	triggerRecord, found, _ := b.store.GetTriggerByID(ctx, p.TriggerID)
+
+	if err := b.store.DeleteTriggerByID(ctx, p.TriggerID); err != nil {
+		log.Printf("failed to delete trigger %d: %v", p.TriggerID, err)
+	} else if found {
+		b.triggers.Invalidate(triggerRecord.ChannelID)
+		b.recordAudit(ctx, p.ChannelID, cb.From.ID, storage.AuditDelete, triggerRecord.TriggerText, auditTriggerValue(triggerRecord), "")
+
+		// Tampilkan notifikasi pop-up dengan teks trigger
+		alertData := struct{ Trigger string }{Trigger: triggerRecord.TriggerText}
+		alertText := i18n.GetMessage(lang, "delete_success_alert", alertData)
+		b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{CallbackQueryID: cb.ID, Text: alertText, ShowAlert: true})
 	}
+	// Segarkan kembali dasbor
+	return b.sendManagementDashboard(ctx, cb.Message.Chat.ID, cb.Message.ID, cb.From.ID, lang, p.ChannelID, p.Page)
+}
 
-	if strings.HasPrefix(data, "del_prompt_") {
-		parts := strings.Split(data, "_")
-		triggerID, _ := strconv.ParseInt(parts[2], 10, 64)
-		channelID, _ := strconv.ParseInt(parts[4], 10, 64)
-		page, _ := strconv.Atoi(parts[6])
+func (b *Bot) handleManageCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	// Kembali ke dasbor (Batal/Kembali dari salin trigger, blokir user, dll.)
+	// berarti sesi yang sedang berjalan ditinggalkan
+	b.states.ClearState(cb.From.ID)
+	return b.sendManagementDashboard(ctx, cb.Message.Chat.ID, cb.Message.ID, cb.From.ID, lang, p.ChannelID, p.Page)
+}
 
-		// Ambil info trigger dari database untuk mendapatkan teksnya
-		triggerRecord, found, err := b.store.GetTriggerByID(triggerID)
-		if err != nil || !found {
-			// Handle error jika trigger tidak ditemukan
-			return nil
-		}
+// handleHelpMainCallback menampilkan menu bantuan utama (dari /start)
+func (b *Bot) handleHelpMainCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	text := i18n.GetMessage(lang, "help_main_text", nil)
+	keyboard := InlineKeyboardMarkup{
+		InlineKeyboard: [][]InlineKeyboardButton{
+			{
+				{Text: i18n.GetMessage(lang, "help_register_button", nil), CallbackData: "help_register"},
+				{Text: i18n.GetMessage(lang, "help_learn_button", nil), CallbackData: "help_learn"},
+			},
+			{
+				{Text: i18n.GetMessage(lang, "help_manage_button", nil), CallbackData: "help_manage"},
+				{Text: i18n.GetMessage(lang, "help_formatting_button", nil), CallbackData: "help_formatting"},
+			},
+			{
+				{Text: i18n.GetMessage(lang, "help_lang_button", nil), CallbackData: "help_lang"},
+				{Text: i18n.GetMessage(lang, "help_cancel_button", nil), CallbackData: "help_cancel"},
+			},
+		},
+	}
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{
+		ChatID: cb.Message.Chat.ID, MessageID: cb.Message.ID, Text: text, ParseMode: "Markdown", ReplyMarkup: &keyboard,
+	})
+}
 
-		textData := struct{ Trigger string }{Trigger: triggerRecord.TriggerText}
-		text := i18n.GetMessage(lang, "confirm_delete_prompt", textData)
+// helpDetailCallback menampilkan satu halaman bantuan dengan tombol kembali.
+func (b *Bot) helpDetailCallback(helpDetailKey string) callbackHandler {
+	return func(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+		text := i18n.GetMessage(lang, helpDetailKey, nil)
 		keyboard := InlineKeyboardMarkup{
 			InlineKeyboard: [][]InlineKeyboardButton{
-				{
-					{Text: i18n.GetMessage(lang, "confirm_delete_button", nil), CallbackData: fmt.Sprintf("del_confirm_%d_ch_%d_pg_%d", triggerID, channelID, page)},
-					{Text: i18n.GetMessage(lang, "cancel_delete_button", nil), CallbackData: fmt.Sprintf("manage_ch_%d_page_%d", channelID, page)},
-				},
+				{{Text: i18n.GetMessage(lang, "back_button", nil), CallbackData: "help_main"}},
 			},
 		}
-		return b.api.EditMessageText(EditMessageTextPayload{
-			ChatID: chatID, MessageID: messageID, Text: text, ParseMode: "Markdown", ReplyMarkup: &keyboard,
+		return b.api.EditMessageText(ctx, EditMessageTextPayload{
+			ChatID: cb.Message.Chat.ID, MessageID: cb.Message.ID, Text: text, ParseMode: "Markdown", ReplyMarkup: &keyboard,
 		})
 	}
-	if strings.HasPrefix(data, "del_confirm_") {
-		parts := strings.Split(data, "_")
-		triggerID, _ := strconv.ParseInt(parts[2], 10, 64)
-		channelID, _ := strconv.ParseInt(parts[4], 10, 64)
-		page, _ := strconv.Atoi(parts[6])
-
-		// Ambil record dulu untuk dapatkan teksnya sebelum dihapus
-		triggerRecord, found, _ := b.store.GetTriggerByID(triggerID)
-
-		if err := b.store.DeleteTriggerByID(triggerID); err != nil {
-			log.Printf("failed to delete trigger %d: %v", triggerID, err)
-		} else if found {
-			// Tampilkan notifikasi pop-up dengan teks trigger
-			alertData := struct{ Trigger string }{Trigger: triggerRecord.TriggerText}
-			alertText := i18n.GetMessage(lang, "delete_success_alert", alertData)
-			b.api.AnswerCallbackQuery(AnswerCallbackQueryPayload{CallbackQueryID: cb.ID, Text: alertText, ShowAlert: true})
-		}
-		// Segarkan kembali dasbor
-		return b.sendManagementDashboard(chatID, messageID, lang, channelID, page)
-	}
-
-
-	if strings.HasPrefix(data, "manage_ch_") {
-		parts := strings.Split(data, "_")
-		channelID, _ := strconv.ParseInt(parts[2], 10, 64)
-		page, _ := strconv.Atoi(parts[4])
-		return b.sendManagementDashboard(chatID, messageID, lang, channelID, page)
-	}
-
-	// Router untuk menu Bantuan
-	if strings.HasPrefix(data, "help_") {
-		// Jika "help_main", tampilkan menu utama (dari /start)
-		if data == "help_main" {
-			text := i18n.GetMessage(lang, "help_main_text", nil)
-			keyboard := InlineKeyboardMarkup{
-				InlineKeyboard: [][]InlineKeyboardButton{
-					{
-						{Text: i18n.GetMessage(lang, "help_register_button", nil), CallbackData: "help_register"},
-						{Text: i18n.GetMessage(lang, "help_learn_button", nil), CallbackData: "help_learn"},
-					},
-					{
-						{Text: i18n.GetMessage(lang, "help_manage_button", nil), CallbackData: "help_manage"},
-						{Text: i18n.GetMessage(lang, "help_formatting_button", nil), CallbackData: "help_formatting"},
-					},
-					{
-						{Text: i18n.GetMessage(lang, "help_lang_button", nil), CallbackData: "help_lang"},
-						{Text: i18n.GetMessage(lang, "help_cancel_button", nil), CallbackData: "help_cancel"},
-					},
-				},
-			}
-			return b.api.EditMessageText(EditMessageTextPayload{
-				ChatID: chatID, MessageID: messageID, Text: text, ParseMode: "Markdown", ReplyMarkup: &keyboard,
-			})
-		}
-		var helpDetailKey string
-		switch data {
-		case "help_register":
-			helpDetailKey = "help_register_text"
-		case "help_learn":
-			helpDetailKey = "help_learn_text"
-		case "help_manage": // Tambahkan case baru
-			helpDetailKey = "help_manage_text"
-		case "help_formatting": // Tambahkan case baru
-			helpDetailKey = "help_formatting_text"
-		case "help_lang":
-			helpDetailKey = "help_lang_text"
-		case "help_cancel":
-			helpDetailKey = "help_cancel_text"
-		}
-		
-		if helpDetailKey != "" {
-			text := i18n.GetMessage(lang, helpDetailKey, nil)
-			keyboard := InlineKeyboardMarkup{
-				InlineKeyboard: [][]InlineKeyboardButton{
-					{{Text: i18n.GetMessage(lang, "back_button", nil), CallbackData: "help_main"}},
-				},
-			}
-			return b.api.EditMessageText(EditMessageTextPayload{
-				ChatID: chatID, MessageID: messageID, Text: text, ParseMode: "Markdown", ReplyMarkup: &keyboard,
-			})
-		}
-	}
-	
-	// Router untuk prompt bahasa (dari /start)
-	if data == "lang_prompt" {
-		return b.handleLangCommand(cb.Message, lang)
-	}
+}
 
-	// Sisa logika callback query (lang_en, learn_channel_, dll) tetap sama
-	if strings.HasPrefix(data, "lang_") {
-		langCode := strings.TrimPrefix(data, "lang_")
-		if err := b.store.SetUserLanguage(userID, langCode); err != nil {
+// handleLangPromptCallback menampilkan prompt bahasa (dari /start)
+func (b *Bot) handleLangPromptCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	return b.handleLangCommand(ctx, cb.Message, lang)
+}
+
+func (b *Bot) setLanguageCallback(langCode string) callbackHandler {
+	return func(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+		if err := b.store.SetUserLanguage(ctx, cb.From.ID, langCode); err != nil {
 			log.Printf("failed to set user language: %v", err)
-			return b.api.AnswerCallbackQuery(AnswerCallbackQueryPayload{CallbackQueryID: cb.ID})
+			return b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{CallbackQueryID: cb.ID})
 		}
 		text := i18n.GetMessage(langCode, "lang_updated", nil)
-		b.api.AnswerCallbackQuery(AnswerCallbackQueryPayload{
+		b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{
 			CallbackQueryID: cb.ID, Text: text, ShowAlert: true,
 		})
-		return b.api.EditMessageText(EditMessageTextPayload{
-			ChatID: chatID, MessageID: messageID, Text: text,
+		return b.api.EditMessageText(ctx, EditMessageTextPayload{
+			ChatID: cb.Message.Chat.ID, MessageID: cb.Message.ID, Text: text,
 		})
 	}
+}
 
-	if strings.HasPrefix(data, "learn_channel_") {
-		channelIDStr := strings.TrimPrefix(data, "learn_channel_")
-		channelID, _ := strconv.ParseInt(channelIDStr, 10, 64)
+func (b *Bot) handleLearnChannelCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	b.states.SetState(cb.From.ID, &UserState{
+		Step: "awaiting_trigger", ChannelID: p.ChannelID,
+	})
 
-		b.states.SetState(userID, &UserState{
-			Step: "awaiting_trigger", ChannelID: channelID,
-		})
+	text := i18n.GetMessage(lang, "learn_channel_selected", nil)
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{
+		ChatID: cb.Message.Chat.ID, MessageID: cb.Message.ID, Text: text, ParseMode: "Markdown",
+	})
+}
 
-		text := i18n.GetMessage(lang, "learn_channel_selected", nil)
-		return b.api.EditMessageText(EditMessageTextPayload{
-			ChatID: chatID, MessageID: messageID, Text: text, ParseMode: "Markdown",
-		})
+func (b *Bot) handlePlaceholderHelpCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	helpText := i18n.GetMessage(lang, "placeholder_help_text", nil)
+	backButton := InlineKeyboardButton{
+		Text: i18n.GetMessage(lang, "back_button", nil), CallbackData: "back_to_response_prompt",
 	}
-	
-	if data == "show_placeholder_help" {
-		helpText := i18n.GetMessage(lang, "placeholder_help_text", nil)
-		backButton := InlineKeyboardButton{
-			Text: i18n.GetMessage(lang, "back_button", nil), CallbackData: "back_to_response_prompt",
-		}
-		keyboard := InlineKeyboardMarkup{
-			InlineKeyboard: [][]InlineKeyboardButton{{backButton}},
-		}
-
-		return b.api.EditMessageText(EditMessageTextPayload{
-			ChatID: chatID, MessageID: messageID, Text: helpText, ParseMode: "Markdown", ReplyMarkup: &keyboard,
-		})
+	keyboard := InlineKeyboardMarkup{
+		InlineKeyboard: [][]InlineKeyboardButton{{backButton}},
 	}
-	
-	if data == "back_to_response_prompt" {
-		state, found := b.states.GetState(userID)
-		if !found || state.Step != "awaiting_response" {
-			return b.api.EditMessageText(EditMessageTextPayload{
-				ChatID: chatID, MessageID: messageID, Text: i18n.GetMessage(lang, "session_expired", nil),			})
-		}
 
-		textData := struct{ Trigger string }{Trigger: state.Trigger}
-		text := i18n.GetMessage(lang, "learn_awaiting_response", textData)
-		helpButton := InlineKeyboardButton{
-			Text: i18n.GetMessage(lang, "placeholder_button", nil), CallbackData: "show_placeholder_help",
-		}
-		keyboard := InlineKeyboardMarkup{
-			InlineKeyboard: [][]InlineKeyboardButton{{helpButton}},
-		}
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{
+		ChatID: cb.Message.Chat.ID, MessageID: cb.Message.ID, Text: helpText, ParseMode: "Markdown", ReplyMarkup: &keyboard,
+	})
+}
 
-		return b.api.EditMessageText(EditMessageTextPayload{
-			ChatID: chatID, MessageID: messageID, Text: text, ParseMode: "Markdown", ReplyMarkup: &keyboard,
-		})
+func (b *Bot) handleBackToResponsePromptCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	chatID := cb.Message.Chat.ID
+	messageID := cb.Message.ID
+	state, found := b.states.GetState(cb.From.ID)
+	if !found || state.Step != "awaiting_response" {
+		return b.api.EditMessageText(ctx, EditMessageTextPayload{
+			ChatID: chatID, MessageID: messageID, Text: i18n.GetMessage(lang, "session_expired", nil),			})
 	}
 
-	return nil
+	textData := struct{ Trigger string }{Trigger: state.Trigger}
+	text := i18n.GetMessage(lang, "learn_awaiting_response", textData)
+	helpButton := InlineKeyboardButton{
+		Text: i18n.GetMessage(lang, "placeholder_button", nil), CallbackData: "show_placeholder_help",
+	}
+	keyboard := InlineKeyboardMarkup{
+		InlineKeyboard: [][]InlineKeyboardButton{{helpButton}},
+	}
+
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{
+		ChatID: chatID, MessageID: messageID, Text: text, ParseMode: "Markdown", ReplyMarkup: &keyboard,
+	})
 }
 // --- AKHIR PERUBAHAN ---
 
 // --- AWAL PERUBAHAN ---
 // FUNGSI LENGKAP YANG DIPERBARUI
 
-func (b *Bot) sendManagementDashboard(chatID int64, messageID int, lang string, channelID int64, page int) error {
+func (b *Bot) sendManagementDashboard(ctx context.Context, chatID int64, messageID int, userID int64, lang string, channelID int64, page int) error {
 	const pageSize = 5 // 5 trigger per halaman
 
-	triggers, err := b.store.GetTriggersByChannel(channelID)
+	triggers, err := b.store.GetTriggersByChannel(ctx, channelID)
 	if err != nil {
 		return err
 	}
 	
-	channelInfo, _ := b.api.GetChat(channelID)
-	
+	channelInfo, _ := b.api.GetChat(ctx, channelID)
+
+	// Tombol ubah/hapus hanya untuk editor ke atas; viewer cukup melihat daftar
+	role, err := b.channelRole(ctx, channelID, userID)
+	if err != nil {
+		log.Printf("could not resolve role of user %d in channel %d: %v", userID, channelID, err)
+	}
+	canEdit := roleAtLeast(role, storage.RoleEditor)
+
+	hitTotals, err := b.triggerHitTotals(ctx, channelID)
+	if err != nil {
+		log.Printf("could not load hit counts for channel %d: %v", channelID, err)
+	}
+
 	// Logika Paginasi
 	start := (page - 1) * pageSize
 	end := start + pageSize
@@ -593,60 +788,96 @@ func (b *Bot) sendManagementDashboard(chatID int64, messageID int, lang string,
 		}
 		
 		row := []InlineKeyboardButton{
-			{Text: displayTrigger, CallbackData: "noop"},
-			{Text: i18n.GetMessage(lang, "delete_button", nil), CallbackData: fmt.Sprintf("del_prompt_%d_ch_%d_pg_%d", trigger.ID, channelID, page)},
+			{Text: fmt.Sprintf("%s · %d", displayTrigger, hitTotals[trigger.ID]), CallbackData: "noop"},
 		}
+		if canEdit {
+			row = append(row,
+				InlineKeyboardButton{Text: i18n.GetMessage(lang, "delete_button", nil), CallbackData: b.callbackData("del_prompt", callbackParams{TriggerID: trigger.ID, ChannelID: channelID, Page: page})},
+				InlineKeyboardButton{Text: i18n.GetMessage(lang, "copy_button", nil), CallbackData: b.callbackData("clone_one", callbackParams{TriggerID: trigger.ID, ChannelID: channelID})},
+			)
+		}
+		row = append(row, InlineKeyboardButton{Text: i18n.GetMessage(lang, "history_button", nil), CallbackData: b.callbackData("rev_list", callbackParams{TriggerID: trigger.ID, Page: page})})
 		keyboard = append(keyboard, row)
 	}
 
+	if len(triggers) > 0 && canEdit {
+		keyboard = append(keyboard, []InlineKeyboardButton{
+			{Text: i18n.GetMessage(lang, "copy_selected_button", nil), CallbackData: b.callbackData("clone_select", callbackParams{ChannelID: channelID, Page: 1})},
+			{Text: i18n.GetMessage(lang, "copy_all_button", nil), CallbackData: b.callbackData("clone_all", callbackParams{ChannelID: channelID})},
+		})
+	}
+
 	// Bangun tombol navigasi
 	var navRow []InlineKeyboardButton
 	if page > 1 {
-		navRow = append(navRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "prev_button", nil), CallbackData: fmt.Sprintf("manage_ch_%d_page_%d", channelID, page-1)})
+		navRow = append(navRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "prev_button", nil), CallbackData: b.callbackData("manage", callbackParams{ChannelID: channelID, Page: page - 1})})
 	}
 	if page < totalPages {
-		navRow = append(navRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "next_button", nil), CallbackData: fmt.Sprintf("manage_ch_%d_page_%d", channelID, page+1)})
+		navRow = append(navRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "next_button", nil), CallbackData: b.callbackData("manage", callbackParams{ChannelID: channelID, Page: page + 1})})
 	}
 	if len(navRow) > 0 {
 		keyboard = append(keyboard, navRow)
 	}
 
+	statsRow := []InlineKeyboardButton{
+		{Text: i18n.GetMessage(lang, "stats_button", nil), CallbackData: b.callbackData("stats", callbackParams{ChannelID: channelID, Days: 7})},
+	}
+	if canEdit {
+		statsRow = append(statsRow,
+			InlineKeyboardButton{Text: i18n.GetMessage(lang, "subscribers_button", nil), CallbackData: b.callbackData("subs", callbackParams{ChannelID: channelID, Page: 1})},
+			InlineKeyboardButton{Text: i18n.GetMessage(lang, "blocklist_button", nil), CallbackData: b.callbackData("blocklist", callbackParams{ChannelID: channelID, Page: 1})},
+		)
+	}
+	keyboard = append(keyboard, statsRow)
+
+	if role == storage.RoleOwner {
+		keyboard = append(keyboard, []InlineKeyboardButton{
+			{Text: i18n.GetMessage(lang, "roles_button", nil), CallbackData: b.callbackData("roles", callbackParams{ChannelID: channelID})},
+		})
+	}
+
 	backToHelpRow := []InlineKeyboardButton{
 		{Text: i18n.GetMessage(lang, "back_to_main_menu_button", nil), CallbackData: "help_main"},
 	}
 	keyboard = append(keyboard, backToHelpRow)
 	
-	return b.api.EditMessageText(EditMessageTextPayload{
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{
 		ChatID: chatID, MessageID: messageID, Text: textBuilder.String(), ParseMode: "Markdown", ReplyMarkup: &InlineKeyboardMarkup{InlineKeyboard: keyboard},
 	})
 }
 // --- AKHIR PERUBAHAN ---
 
 // Langkah 1 dari sesi /learn
-func (b *Bot) handleLearnCommand(msg *Message, lang string) error {
-	userID := msg.From.ID
-	chatID := msg.Chat.ID
-	
+func (b *Bot) handleLearnCommand(ctx context.Context, msg *Message, lang string) error {
+	userAdminChannels, err := b.getChannelsWithRole(ctx, msg.From.ID, storage.RoleEditor)
+	if err != nil {
+		return err
+	}
+	return b.sendChannelSelection(ctx, msg.Chat.ID, userAdminChannels, lang)
+}
+
+// getAdminChannels mengembalikan channel terdaftar di mana user adalah admin,
+// memakai cache agar tidak memanggil getChatAdministrators setiap saat.
+func (b *Bot) getAdminChannels(ctx context.Context, userID int64) ([]storage.RegisteredChannel, error) {
 	// Langkah 1: Coba ambil dari cache terlebih dahulu
 	cachedChannels, found := b.cache.Get(userID)
 	if found {
 		log.Printf("cache hit for user %d", userID)
-		// Jika ditemukan, langsung gunakan data dari cache (super cepat)
-		return b.sendChannelSelection(chatID, cachedChannels, lang)
+		return cachedChannels, nil
 	}
 
 	log.Printf("cache miss for user %d, performing full check", userID)
-	
+
 	// Langkah 2: Jika tidak ada di cache (lambat, hanya terjadi sesekali)
-	allChannels, err := b.store.GetRegisteredChannels()
+	allChannels, err := b.store.GetRegisteredChannels(ctx)
 	if err != nil {
 		log.Printf("error getting registered channels: %v", err)
-		return err
+		return nil, err
 	}
 
 	var userAdminChannels []storage.RegisteredChannel
 	for _, channel := range allChannels {
-		isAdmin, _ := b.isUserAdmin(channel.ChannelID, userID)
+		isAdmin, _ := b.isUserAdmin(ctx, channel.ChannelID, userID)
 		if isAdmin {
 			userAdminChannels = append(userAdminChannels, channel)
 		}
@@ -654,33 +885,27 @@ func (b *Bot) handleLearnCommand(msg *Message, lang string) error {
 
 	// Langkah 3: Simpan hasilnya ke cache untuk penggunaan selanjutnya
 	b.cache.Set(userID, userAdminChannels)
-
-	if len(userAdminChannels) == 0 {
-		text := i18n.GetMessage(lang, "learn_no_channels_found", nil)
-		return b.api.SendMessage(SendMessagePayload{ChatID: chatID, Text: text, ParseMode: "Markdown"})
-	}
-
-	return b.sendChannelSelection(chatID, userAdminChannels, lang)
+	return userAdminChannels, nil
 }
 
 // Fungsi helper baru untuk menghindari duplikasi kode
-func (b *Bot) sendChannelSelection(chatID int64, channels []storage.RegisteredChannel, lang string) error {
+func (b *Bot) sendChannelSelection(ctx context.Context, chatID int64, channels []storage.RegisteredChannel, lang string) error {
 	if len(channels) == 0 {
 		text := i18n.GetMessage(lang, "learn_no_channels_found", nil)
-		return b.api.SendMessage(SendMessagePayload{ChatID: chatID, Text: text, ParseMode: "Markdown"})
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: chatID, Text: text, ParseMode: "Markdown"})
 	}
 	
 	var keyboard [][]InlineKeyboardButton
 	for _, ch := range channels {
 		button := InlineKeyboardButton{
 			Text:         ch.Title,
-			CallbackData: fmt.Sprintf("learn_channel_%d", ch.ChannelID),
+			CallbackData: b.callbackData("learn_channel", callbackParams{ChannelID: ch.ChannelID}),
 		}
 		keyboard = append(keyboard, []InlineKeyboardButton{button})
 	}
 	text := i18n.GetMessage(lang, "learn_prompt_channel", nil)
 
-	return b.api.SendMessage(SendMessagePayload{
+	return b.api.SendMessage(ctx, SendMessagePayload{
 		ChatID:      chatID,
 		Text:        text,
 		ReplyMarkup: &InlineKeyboardMarkup{InlineKeyboard: keyboard},
@@ -688,35 +913,41 @@ func (b *Bot) sendChannelSelection(chatID int64, channels []storage.RegisteredCh
 }
 
 // Menangani pesan lanjutan dalam sesi (memasukkan trigger/response)
-func (b *Bot) handleSessionMessage(msg *Message, state *UserState, lang string) error {
+func (b *Bot) handleSessionMessage(ctx context.Context, msg *Message, state *UserState, lang string) error {
 	userID := msg.From.ID
 
+	if !b.guardSession(ctx, userID, state) {
+		b.states.ClearState(userID)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: i18n.GetMessage(lang, "unauthorized", nil)})
+	}
+
 	switch state.Step {
 
 	case "awaiting_registration_forward":
 		if msg.ForwardFromChat == nil {
 			text := i18n.GetMessage(lang, "register_invalid_forward", nil)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
 		}
 
 		channelInfo := msg.ForwardFromChat
-		isAdmin, err := b.isUserAdmin(channelInfo.ID, userID) // userID sudah didefinisikan di awal switch
+		isAdmin, err := b.isUserAdmin(ctx, channelInfo.ID, userID) // userID sudah didefinisikan di awal switch
 
 		if err != nil {
 			log.Printf("error checking admin status for channel %d user %d: %v", channelInfo.ID, userID, err)
 			errorText := fmt.Sprintf("❌ Failed to verify admin status. Make sure I am an administrator in '%s' and try again in a few seconds. (API Error: %v)", channelInfo.Title, err)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: errorText})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: errorText})
 		}
 		if !isAdmin {
 			log.Printf("register failed for channel %d: user %d is not admin.", channelInfo.ID, userID)
 			text := i18n.GetMessage(lang, "register_fail_not_admin", nil)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
 		}
 
-		if err := b.store.RegisterChannel(channelInfo.ID, channelInfo.Title, userID); err != nil {
+		if err := b.store.RegisterChannel(ctx, channelInfo.ID, channelInfo.Title, userID); err != nil {
 			log.Printf("register failed for %d: could not save to storage: %v", channelInfo.ID, err)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: "An internal error occurred."})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: "An internal error occurred."})
 		}
+		b.recordAudit(ctx, channelInfo.ID, userID, storage.AuditRegister, channelInfo.Title, "", "")
 
 		// BEFORE
 		// b.cache.Set(userID, nil)
@@ -726,35 +957,39 @@ func (b *Bot) handleSessionMessage(msg *Message, state *UserState, lang string)
 
 		data := struct{ ChannelTitle string }{ChannelTitle: channelInfo.Title}
 		text := i18n.GetMessage(lang, "register_success", data)
-		return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text, ParseMode: "Markdown"})
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text, ParseMode: "Markdown"})
 // --- AKHIR PERUBAHAN ---
 
+	case "awaiting_fallback_reply":
+		return b.handleFallbackReplyMessage(ctx, msg, state, lang)
+
+	case "awaiting_timezone":
+		return b.handleTimezoneMessage(ctx, msg, state, lang)
+
+	case "awaiting_digest_schedule":
+		return b.handleDigestScheduleMessage(ctx, msg, state, lang)
+
+	case "awaiting_block_user":
+		return b.handleBlockUserMessage(ctx, msg, state, lang)
+
+	case "awaiting_subscriber_search":
+		return b.handleSubscriberSearchMessage(ctx, msg, state, lang)
+
+	case "awaiting_subscriber_note":
+		return b.handleSubscriberNoteMessage(ctx, msg, state, lang)
+
+	case "awaiting_subscriber_tags":
+		return b.handleSubscriberTagsMessage(ctx, msg, state, lang)
+
+	case "awaiting_broadcast_message", "awaiting_broadcast_confirm":
+		return b.handleBroadcastMessage(ctx, msg, state, lang)
+
 	case "awaiting_trigger":
 		state.Trigger = msg.Text
 		state.Step = "awaiting_response_type"
 		b.states.SetState(userID, state)
 
-		textData := struct{ Trigger string }{Trigger: msg.Text}
-		text := i18n.GetMessage(lang, "learn_awaiting_response_type", textData)
-		keyboard := InlineKeyboardMarkup{
-			InlineKeyboard: [][]InlineKeyboardButton{
-				{
-					{Text: i18n.GetMessage(lang, "reply_type_text", nil), CallbackData: "learn_type_text"},
-					{Text: i18n.GetMessage(lang, "reply_type_photo", nil), CallbackData: "learn_type_photo"},
-					{Text: i18n.GetMessage(lang, "reply_type_sticker", nil), CallbackData: "learn_type_sticker"},
-				},
-				{
-					{Text: i18n.GetMessage(lang, "reply_type_document", nil), CallbackData: "learn_type_document"},
-					{Text: i18n.GetMessage(lang, "reply_type_gif", nil), CallbackData: "learn_type_animation"},
-				},
-				{
-					{Text: i18n.GetMessage(lang, "reply_type_audio", nil), CallbackData: "learn_type_audio"},
-				},
-			},
-		}
-		return b.api.SendMessage(SendMessagePayload{
-			ChatID: msg.Chat.ID, Text: text, ParseMode: "Markdown", ReplyMarkup: &keyboard,
-		})
+		return b.sendResponseTypePrompt(ctx, msg.Chat.ID, lang, msg.Text)
 
 	case "awaiting_text":
 		// BEFORE
@@ -767,11 +1002,11 @@ func (b *Bot) handleSessionMessage(msg *Message, state *UserState, lang string)
 				ResponseType: "text",
 				ResponseText: msg.Text,
 			}
-			return b.finalizeLearnSession(userID, msg.Chat.ID, lang, record)
+			return b.finalizeLearnSession(ctx, userID, msg.Chat.ID, lang, record)
 		} else {
 			data := struct{ ExpectedType string }{"text"}
 			text := i18n.GetMessage(lang, "learn_wrong_file_type", data)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
 		}
 
 	case "awaiting_photo":
@@ -789,11 +1024,11 @@ func (b *Bot) handleSessionMessage(msg *Message, state *UserState, lang string)
 				ResponseFileID: bestPhoto.FileID,
 				ResponseText:   msg.Caption,
 			}
-			return b.finalizeLearnSession(userID, msg.Chat.ID, lang, record)
+			return b.finalizeLearnSession(ctx, userID, msg.Chat.ID, lang, record)
 		} else {
 			data := struct{ ExpectedType string }{"image"}
 			text := i18n.GetMessage(lang, "learn_wrong_file_type", data)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
 		}
 
 	case "awaiting_sticker":
@@ -804,11 +1039,11 @@ func (b *Bot) handleSessionMessage(msg *Message, state *UserState, lang string)
 				ResponseType:   "sticker",
 				ResponseFileID: msg.Sticker.FileID,
 			}
-			return b.finalizeLearnSession(userID, msg.Chat.ID, lang, record)
+			return b.finalizeLearnSession(ctx, userID, msg.Chat.ID, lang, record)
 		} else {
 			data := struct{ ExpectedType string }{"sticker"}
 			text := i18n.GetMessage(lang, "learn_wrong_file_type", data)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
 		}
 		
 	// Lakukan hal yang sama untuk semua jenis media lainnya...
@@ -821,11 +1056,11 @@ func (b *Bot) handleSessionMessage(msg *Message, state *UserState, lang string)
 				ResponseFileID: msg.Document.FileID,
 				ResponseText:   msg.Caption,
 			}
-			return b.finalizeLearnSession(userID, msg.Chat.ID, lang, record)
+			return b.finalizeLearnSession(ctx, userID, msg.Chat.ID, lang, record)
 		} else {
 			data := struct{ ExpectedType string }{"document"}
 			text := i18n.GetMessage(lang, "learn_wrong_file_type", data)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
 		}
 
 	case "awaiting_animation":
@@ -837,11 +1072,11 @@ func (b *Bot) handleSessionMessage(msg *Message, state *UserState, lang string)
 				ResponseFileID: msg.Animation.FileID,
 				ResponseText:   msg.Caption,
 			}
-			return b.finalizeLearnSession(userID, msg.Chat.ID, lang, record)
+			return b.finalizeLearnSession(ctx, userID, msg.Chat.ID, lang, record)
 		} else {
 			data := struct{ ExpectedType string }{"GIF"}
 			text := i18n.GetMessage(lang, "learn_wrong_file_type", data)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
 		}
 
 	case "awaiting_audio":
@@ -853,23 +1088,69 @@ func (b *Bot) handleSessionMessage(msg *Message, state *UserState, lang string)
 				ResponseFileID: msg.Audio.FileID,
 				ResponseText:   msg.Caption,
 			}
-			return b.finalizeLearnSession(userID, msg.Chat.ID, lang, record)
+			return b.finalizeLearnSession(ctx, userID, msg.Chat.ID, lang, record)
 		} else {
 			data := struct{ ExpectedType string }{"audio file"}
 			text := i18n.GetMessage(lang, "learn_wrong_file_type", data)
-			return b.api.SendMessage(SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+			return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
 		}
+
+	default:
+		// Sesi yang menunggu tombol (misalnya salin trigger) tidak menerima
+		// teks; beri tahu user agar tidak terlihat seperti bot diam saja
+		return b.sendSessionActive(ctx, msg.Chat.ID, lang, state.Step)
 	}
-	return nil
+}
 
-	
+// sendSessionActive memberi tahu sesi mana yang masih berjalan dan cara menghentikannya.
+func (b *Bot) sendSessionActive(ctx context.Context, chatID int64, lang, step string) error {
+	session := i18n.GetMessage(lang, "session_"+step, nil)
+	if session == "session_"+step {
+		session = i18n.GetMessage(lang, "session_other", nil)
+	}
+	text := i18n.GetMessage(lang, "session_active", struct{ Session string }{session})
+	return b.api.SendMessage(ctx, SendMessagePayload{ChatID: chatID, Text: text})
+}
+
+// sendResponseTypePrompt menanyakan jenis balasan untuk trigger yang baru dimasukkan.
+func (b *Bot) sendResponseTypePrompt(ctx context.Context, chatID int64, lang, trigger string) error {
+	textData := struct{ Trigger string }{Trigger: trigger}
+	text := i18n.GetMessage(lang, "learn_awaiting_response_type", textData)
+	keyboard := InlineKeyboardMarkup{
+		InlineKeyboard: [][]InlineKeyboardButton{
+			{
+				{Text: i18n.GetMessage(lang, "reply_type_text", nil), CallbackData: b.callbackData("learn_type", callbackParams{Value: "text"})},
+				{Text: i18n.GetMessage(lang, "reply_type_photo", nil), CallbackData: b.callbackData("learn_type", callbackParams{Value: "photo"})},
+				{Text: i18n.GetMessage(lang, "reply_type_sticker", nil), CallbackData: b.callbackData("learn_type", callbackParams{Value: "sticker"})},
+			},
+			{
+				{Text: i18n.GetMessage(lang, "reply_type_document", nil), CallbackData: b.callbackData("learn_type", callbackParams{Value: "document"})},
+				{Text: i18n.GetMessage(lang, "reply_type_gif", nil), CallbackData: b.callbackData("learn_type", callbackParams{Value: "animation"})},
+			},
+			{
+				{Text: i18n.GetMessage(lang, "reply_type_audio", nil), CallbackData: b.callbackData("learn_type", callbackParams{Value: "audio"})},
+			},
+		},
+	}
+	return b.sendPlainText(ctx, chatID, 0, text, &keyboard)
+}
+
+// sendPlainText mengirim pesan baru (messageID 0) atau mengedit pesan yang ada
+// tanpa parse mode. Pakai ini untuk teks yang memuat isian user, seperti nama,
+// trigger, tag atau pesan subscriber, karena isian itu bisa berisi karakter
+// Markdown apa saja yang membuat Telegram menolak pesannya.
+func (b *Bot) sendPlainText(ctx context.Context, chatID int64, messageID int, text string, markup *InlineKeyboardMarkup) error {
+	if messageID == 0 {
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: chatID, Text: text, ReplyMarkup: markup})
+	}
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: chatID, MessageID: messageID, Text: text, ReplyMarkup: markup})
 }
 
 // Fungsi helper baru untuk menyelesaikan sesi
-func (b *Bot) finalizeLearnSession(userID, chatID int64, lang string, record storage.TriggerRecord) error {
-	if err := b.store.Set(record); err != nil {
+func (b *Bot) finalizeLearnSession(ctx context.Context, userID, chatID int64, lang string, record storage.TriggerRecord) error {
+	if err := b.saveTrigger(ctx, record, userID, storage.AuditLearn); err != nil {
 		log.Printf("failed to save final trigger: %v", err)
-		b.api.SendMessage(SendMessagePayload{ChatID: chatID, Text: "An error occurred."})
+		b.api.SendMessage(ctx, SendMessagePayload{ChatID: chatID, Text: "An error occurred."})
 		return err
 	}
 	
@@ -877,12 +1158,12 @@ func (b *Bot) finalizeLearnSession(userID, chatID int64, lang string, record sto
 	
 	textData := struct{ Trigger string }{Trigger: record.TriggerText}
 	text := i18n.GetMessage(lang, "learn_success", textData)
-	return b.api.SendMessage(SendMessagePayload{ChatID: chatID, Text: text, ParseMode: "Markdown"})
+	return b.api.SendMessage(ctx, SendMessagePayload{ChatID: chatID, Text: text, ParseMode: "Markdown"})
 }
 
 // ... (handleAutoReply, isUserAdmin, dll tidak berubah)
-func (b *Bot) isUserAdmin(chatID, userID int64) (bool, error) {
-	admins, err := b.api.GetChatAdministrators(chatID)
+func (b *Bot) isUserAdmin(ctx context.Context, chatID, userID int64) (bool, error) {
+	admins, err := b.channelAdministrators(ctx, chatID)
 	if err != nil {
 		return false, err
 	}
@@ -896,54 +1177,201 @@ func (b *Bot) isUserAdmin(chatID, userID int64) (bool, error) {
 
 // --- AWAL PERUBAHAN ---
 // FUNGSI LENGKAP YANG DIPERBARUI
-func (b *Bot) handleAutoReply(msg *Message) error {
-	var searchID int64
-	dmChatInfo, err := b.api.GetChat(msg.Chat.ID)
+func (b *Bot) handleAutoReply(ctx context.Context, msg *Message) error {
+	// User yang membanjiri DM atau mengirim spam dibisukan sementara. Dicek
+	// sebelum GetChat agar pesan dari user yang sedang dibisukan tidak
+	// memanggil API sama sekali.
+	floodText := msg.Text
+	if floodText == "" {
+		floodText = msg.Caption
+	}
+	muted, reason := b.flood.Check(msg.Chat.ID, msg.From.ID, floodText, time.Now())
+	if muted && reason == "" {
+		return nil
+	}
+
+	searchID, err := b.dmParentChannel(ctx, msg.Chat.ID)
 	if err != nil {
 		log.Printf("could not get detailed info for DM chat %d: %v", msg.Chat.ID, err)
 		return nil
 	}
-	if dmChatInfo.ParentChat != nil && dmChatInfo.ParentChat.ID != 0 {
-		searchID = dmChatInfo.ParentChat.ID
-	} else {
-		searchID = msg.Chat.ID
+
+	// User yang diblokir diabaikan sebelum query apa pun ke database
+	if b.isBlocked(ctx, searchID, msg.From.ID) {
+		log.Printf("ignoring message from blocked user %d in channel %d", msg.From.ID, searchID)
+		return nil
 	}
 
-	record, found, err := b.store.Get(searchID, msg.Text)
-	if err != nil || !found {
+	// Channel yang sudah di-unregister tidak dibalas lagi walaupun trigger-nya disimpan
+	registered, err := b.store.IsChannelRegistered(ctx, searchID)
+	if muted {
+		log.Printf("muting user %d in channel %d for %s (%s)", msg.From.ID, searchID, floodMuteDuration, reason)
+		if err == nil && registered {
+			b.notifyAdminsAbuse(ctx, searchID, msg, reason)
+		}
+		return nil
+	}
+	if err != nil || !registered {
 		return err
 	}
+	b.activity.RecordDM(searchID, msg, time.Now())
+
+	settings, err := b.store.GetChannelSettings(ctx, searchID)
+	if err != nil {
+		log.Printf("could not load settings for channel %d, using defaults: %v", searchID, err)
+	}
+	if !settings.AutoReply {
+		return nil
+	}
+
+	match, err := b.matchTrigger(ctx, settings, msg.Text)
+	if err != nil {
+		return err
+	}
+	if !match.Found {
+		return b.handleUnmatched(ctx, msg, settings)
+	}
+
+	log.Printf("found match for trigger '%s'. replying with type '%s'", msg.Text, match.Record.ResponseType)
+	b.hits.Record(searchID, match.Record.ID, msg.From.ID, msg.From.LangCode, time.Now())
+	b.activity.RecordMatched(searchID, time.Now())
+
+	if err := b.sendTriggerResponse(ctx, msg.Chat.ID, msg.DirectMessagesTopic.TopicID, match.Record, msg.From, settings.ParseMode); err != nil {
+		b.activity.RecordFailedSend(searchID, time.Now())
+		return err
+	}
+	return nil
+}
+
+// dmParentChannel mengembalikan channel pemilik chat DM chatID, atau chatID
+// sendiri jika chat itu tidak punya channel induk. getChat hanya dipanggil
+// untuk chat DM yang belum ada di cache.
+func (b *Bot) dmParentChannel(ctx context.Context, chatID int64) (int64, error) {
+	if parentID, found := b.parents.Get(chatID); found {
+		return parentID, nil
+	}
+	dmChatInfo, err := b.api.GetChat(ctx, chatID)
+	if err != nil {
+		return 0, err
+	}
+	parentID := chatID
+	if dmChatInfo.ParentChat != nil && dmChatInfo.ParentChat.ID != 0 {
+		parentID = dmChatInfo.ParentChat.ID
+	}
+	b.parents.Set(chatID, parentID)
+	return parentID, nil
+}
+
+// triggerMatch menjelaskan bagaimana sebuah pesan dicocokkan dengan trigger,
+// dipakai oleh balasan otomatis dan oleh /test.
+type triggerMatch struct {
+	Record     storage.TriggerRecord
+	Found      bool
+	Normalized string
+	Mode       string
+}
+
+func normalizeTriggerText(text string) string {
+	return strings.ToLower(text)
+}
+
+// matchTrigger selalu mencoba kecocokan persis terlebih dahulu, lalu mode
+// "contains"/"prefix" sesuai pengaturan channel dengan trigger terpanjang menang.
+func (b *Bot) matchTrigger(ctx context.Context, settings storage.ChannelSettings, text string) (triggerMatch, error) {
+	match := triggerMatch{Normalized: normalizeTriggerText(text), Mode: storage.MatchModeExact}
+
+	record, found, err := b.store.Get(ctx, settings.ChannelID, match.Normalized)
+	if err != nil {
+		return match, err
+	}
+	// Trigger dari /unanswered disimpan tanpa tanda baca, jadi coba juga bentuk itu
+	if loose := normalizeUnanswered(text); !found && loose != "" && loose != match.Normalized {
+		record, found, err = b.store.Get(ctx, settings.ChannelID, loose)
+		if err != nil {
+			return match, err
+		}
+	}
+	if found || settings.MatchMode == storage.MatchModeExact || settings.MatchMode == "" {
+		match.Record = record
+		match.Found = found
+		return match, nil
+	}
 
-	log.Printf("found match for trigger '%s'. replying with type '%s'", msg.Text, record.ResponseType)
+	triggers, cached := b.triggers.Get(settings.ChannelID)
+	if !cached {
+		triggers, err = b.store.GetTriggersByChannel(ctx, settings.ChannelID)
+		if err != nil {
+			return match, err
+		}
+		b.triggers.Set(settings.ChannelID, triggers)
+	}
+	for _, trigger := range triggers {
+		var ok bool
+		switch settings.MatchMode {
+		case storage.MatchModeContains:
+			ok = strings.Contains(match.Normalized, trigger.TriggerText)
+		case storage.MatchModePrefix:
+			ok = strings.HasPrefix(match.Normalized, trigger.TriggerText)
+		}
+		if ok && len(trigger.TriggerText) > len(match.Record.TriggerText) {
+			match.Record = trigger
+			match.Found = true
+			match.Mode = settings.MatchMode
+		}
+	}
+	return match, nil
+}
 
-	topicID := msg.DirectMessagesTopic.TopicID
+// handleUnmatched mengirim balasan cadangan dan memberi tahu admin
+// jika diaktifkan di pengaturan channel.
+func (b *Bot) handleUnmatched(ctx context.Context, msg *Message, settings storage.ChannelSettings) error {
+	if msg.Text != "" {
+		b.unanswered.Record(settings.ChannelID, msg.Text, time.Now())
+	}
+	b.activity.RecordUnmatched(settings.ChannelID, time.Now())
+	if settings.NotifyUnmatched {
+		b.notifyAdminsUnmatched(ctx, settings.ChannelID, msg)
+	}
+	if settings.FallbackReply == "" {
+		return nil
+	}
+	fallback := storage.TriggerRecord{ResponseType: "text", ResponseText: settings.FallbackReply}
+	if err := b.sendTriggerResponse(ctx, msg.Chat.ID, msg.DirectMessagesTopic.TopicID, fallback, msg.From, settings.ParseMode); err != nil {
+		b.activity.RecordFailedSend(settings.ChannelID, time.Now())
+		return err
+	}
+	return nil
+}
 
-	// Ganti switch lama dengan yang ini
+func (b *Bot) sendTriggerResponse(ctx context.Context, chatID int64, topicID int, record storage.TriggerRecord, user User, parseMode string) error {
 	switch record.ResponseType {
 	case "text":
-		finalText := strings.Replace(record.ResponseText, "{{user_first_name}}", msg.From.FirstName, -1)
-		return b.api.SendMessage(SendMessagePayload{
-			ChatID: msg.Chat.ID, Text: finalText, ParseMode: "Markdown", DirectMessagesTopicID: topicID,
+		finalText := strings.Replace(record.ResponseText, "{{user_first_name}}", user.FirstName, -1)
+		return b.api.SendMessage(ctx, SendMessagePayload{
+			ChatID: chatID, Text: finalText, ParseMode: parseMode, DirectMessagesTopicID: topicID,
 		})
 	case "photo":
-		return b.api.SendPhoto(SendPhotoPayload{
-			ChatID: msg.Chat.ID, Photo: record.ResponseFileID, Caption: record.ResponseText, ParseMode: "Markdown", DirectMessagesTopicID: topicID,
+		return b.api.SendPhoto(ctx, SendPhotoPayload{
+			ChatID: chatID, Photo: record.ResponseFileID, Caption: record.ResponseText, ParseMode: parseMode, DirectMessagesTopicID: topicID,
 		})
 	case "sticker":
-		return b.api.SendSticker(SendStickerPayload{
-			ChatID: msg.Chat.ID, Sticker: record.ResponseFileID, DirectMessagesTopicID: topicID,
+		return b.api.SendSticker(ctx, SendStickerPayload{
+			ChatID: chatID, Sticker: record.ResponseFileID, DirectMessagesTopicID: topicID,
 		})
+	// Caption dokumen, animasi dan audio selalu dikirim tanpa parse mode
+	// seperti sebelum ada pengaturan channel, karena caption lama yang
+	// berisi "_" atau "*" tidak pernah diperiksa sebagai Markdown
 	case "document":
-		return b.api.SendDocument(SendDocumentPayload{
-			ChatID: msg.Chat.ID, Document: record.ResponseFileID, Caption: record.ResponseText, DirectMessagesTopicID: topicID,
+		return b.api.SendDocument(ctx, SendDocumentPayload{
+			ChatID: chatID, Document: record.ResponseFileID, Caption: record.ResponseText, DirectMessagesTopicID: topicID,
 		})
 	case "animation":
-		return b.api.SendAnimation(SendAnimationPayload{
-			ChatID: msg.Chat.ID, Animation: record.ResponseFileID, Caption: record.ResponseText, DirectMessagesTopicID: topicID,
+		return b.api.SendAnimation(ctx, SendAnimationPayload{
+			ChatID: chatID, Animation: record.ResponseFileID, Caption: record.ResponseText, DirectMessagesTopicID: topicID,
 		})
 	case "audio":
-		return b.api.SendAudio(SendAudioPayload{
-			ChatID: msg.Chat.ID, Audio: record.ResponseFileID, Caption: record.ResponseText, DirectMessagesTopicID: topicID,
+		return b.api.SendAudio(ctx, SendAudioPayload{
+			ChatID: chatID, Audio: record.ResponseFileID, Caption: record.ResponseText, DirectMessagesTopicID: topicID,
 		})
 	}
 
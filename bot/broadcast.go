@@ -0,0 +1,406 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+const (
+	// broadcastRate dibagi oleh semua broadcast yang berjalan, di bawah batas
+	// global Telegram sekitar 30 pesan per detik agar balasan otomatis tetap lancar.
+	broadcastRate          = 20
+	broadcastProgressEvery = 3 * time.Second
+)
+
+const (
+	broadcastRunning   = "running"
+	broadcastPaused    = "paused"
+	broadcastCancelled = "cancelled"
+	broadcastDone      = "done"
+)
+
+// BroadcastJob adalah satu pengiriman pesan ke semua subscriber sebuah channel.
+// Progres dilaporkan dengan mengedit pesan ChatID/MessageID milik admin.
+type BroadcastJob struct {
+	ID         int64
+	ChannelID  int64
+	Lang       string
+	Message    storage.TriggerRecord
+	ParseMode  string
+	Recipients []storage.Subscriber
+	ChatID     int64
+	MessageID  int
+
+	mu        sync.Mutex
+	status    string
+	sent      int
+	failed    int
+	lastError string
+	wake      chan struct{}
+}
+
+type broadcastProgress struct {
+	Status    string
+	Sent      int
+	Failed    int
+	Total     int
+	LastError string
+}
+
+func (j *BroadcastJob) progress() broadcastProgress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return broadcastProgress{Status: j.status, Sent: j.sent, Failed: j.failed, Total: len(j.Recipients), LastError: j.lastError}
+}
+
+// setStatus mengubah status job; job yang sudah selesai atau dibatalkan tidak bisa diubah lagi.
+func (j *BroadcastJob) setStatus(status string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status == broadcastDone || j.status == broadcastCancelled {
+		return false
+	}
+	j.status = status
+	// Bangunkan runner yang sedang menunggu karena dijeda
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// waitWhilePaused menahan runner selama job dijeda. Mengembalikan false jika job dibatalkan.
+func (j *BroadcastJob) waitWhilePaused() bool {
+	for {
+		j.mu.Lock()
+		status := j.status
+		j.mu.Unlock()
+		switch status {
+		case broadcastCancelled:
+			return false
+		case broadcastPaused:
+			<-j.wake
+		default:
+			return true
+		}
+	}
+}
+
+func (j *BroadcastJob) recordResult(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err != nil {
+		j.failed++
+		j.lastError = err.Error()
+		return
+	}
+	j.sent++
+}
+
+// BroadcastRunner menyimpan broadcast yang sedang berjalan dan membatasi
+// kecepatan kirim semuanya dengan satu ticker bersama.
+type BroadcastRunner struct {
+	mu     sync.Mutex
+	jobs   map[int64]*BroadcastJob
+	nextID int64
+	tick   <-chan time.Time
+}
+
+func NewBroadcastRunner(ratePerSecond int) *BroadcastRunner {
+	return &BroadcastRunner{
+		jobs: make(map[int64]*BroadcastJob),
+		tick: time.NewTicker(time.Second / time.Duration(ratePerSecond)).C,
+	}
+}
+
+func (r *BroadcastRunner) add(job *BroadcastJob) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	job.ID = r.nextID
+	job.status = broadcastRunning
+	job.wake = make(chan struct{}, 1)
+	r.jobs[job.ID] = job
+}
+
+func (r *BroadcastRunner) get(id int64) (*BroadcastJob, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, found := r.jobs[id]
+	return job, found
+}
+
+// cancelAll membatalkan semua broadcast yang berjalan, dipakai saat bot dihentikan.
+func (r *BroadcastRunner) cancelAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, job := range r.jobs {
+		job.setStatus(broadcastCancelled)
+	}
+}
+
+func (r *BroadcastRunner) remove(id int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.jobs, id)
+}
+
+// runBroadcast mengirim pesan ke setiap penerima dan melaporkan progresnya secara berkala.
+func (b *Bot) runBroadcast(ctx context.Context, job *BroadcastJob) {
+	defer b.inflight.Done()
+	defer b.broadcasts.remove(job.ID)
+
+	lastReport := time.Now()
+	for _, sub := range job.Recipients {
+		if !job.waitWhilePaused() {
+			break
+		}
+		select {
+		case <-b.broadcasts.tick:
+		case <-ctx.Done():
+			job.setStatus(broadcastCancelled)
+			continue
+		}
+
+		user := User{ID: sub.UserID, FirstName: sub.FirstName, Username: sub.Username, LangCode: sub.LangCode}
+		err := b.sendTriggerResponse(ctx, sub.ChatID, sub.TopicID, job.Message, user, job.ParseMode)
+		if wait, retry := broadcastRetryDelay(err); retry {
+			// Broadcast tidak berjalan di worker, jadi tunggu yang panjang
+			// boleh dilakukan di sini lalu dicoba sekali lagi
+			log.Printf("broadcast %d rate limited, waiting %s", job.ID, wait)
+			if sleepContext(ctx, wait) == nil {
+				err = b.sendTriggerResponse(ctx, sub.ChatID, sub.TopicID, job.Message, user, job.ParseMode)
+			}
+		}
+		if err != nil {
+			log.Printf("broadcast %d to user %d in channel %d failed: %v", job.ID, sub.UserID, job.ChannelID, err)
+			b.activity.RecordFailedSend(job.ChannelID, time.Now())
+		}
+		job.recordResult(err)
+
+		if time.Since(lastReport) >= broadcastProgressEvery {
+			b.reportBroadcast(ctx, job)
+			lastReport = time.Now()
+		}
+	}
+
+	job.setStatus(broadcastDone)
+	progress := job.progress()
+	log.Printf("broadcast %d for channel %d finished as %s: %d sent, %d failed of %d", job.ID, job.ChannelID, progress.Status, progress.Sent, progress.Failed, progress.Total)
+	b.reportBroadcast(ctx, job)
+}
+
+// reportBroadcast mengedit pesan progres beserta tombol jeda/lanjut/batal.
+func (b *Bot) reportBroadcast(ctx context.Context, job *BroadcastJob) {
+	progress := job.progress()
+	text := i18n.GetMessage(job.Lang, "broadcast_progress", struct {
+		ChannelTitle string
+		Status       string
+		Sent         int
+		Failed       int
+		Total        int
+		LastError    string
+	}{
+		ChannelTitle: b.channelTitle(ctx, job.ChannelID),
+		Status:       i18n.GetMessage(job.Lang, "broadcast_status_"+progress.Status, nil),
+		Sent:         progress.Sent,
+		Failed:       progress.Failed,
+		Total:        progress.Total,
+		LastError:    progress.LastError,
+	})
+
+	params := callbackParams{ChannelID: job.ChannelID, JobID: job.ID}
+	var row []InlineKeyboardButton
+	switch progress.Status {
+	case broadcastRunning:
+		row = append(row, InlineKeyboardButton{Text: i18n.GetMessage(job.Lang, "broadcast_pause_button", nil), CallbackData: b.callbackData("broadcast_pause", params)})
+	case broadcastPaused:
+		row = append(row, InlineKeyboardButton{Text: i18n.GetMessage(job.Lang, "broadcast_resume_button", nil), CallbackData: b.callbackData("broadcast_resume", params)})
+	}
+	payload := EditMessageTextPayload{ChatID: job.ChatID, MessageID: job.MessageID, Text: text}
+	if row != nil {
+		row = append(row, InlineKeyboardButton{Text: i18n.GetMessage(job.Lang, "broadcast_cancel_button", nil), CallbackData: b.callbackData("broadcast_cancel", params)})
+		payload.ReplyMarkup = &InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{row}}
+	}
+	if err := b.api.EditMessageText(ctx, payload); err != nil && !IsMessageNotModified(err) {
+		log.Printf("could not update progress of broadcast %d: %v", job.ID, err)
+	}
+}
+
+// broadcastRetryDelay menentukan apakah kiriman broadcast yang gagal karena
+// batas kecepatan layak diulang, dan berapa lama harus menunggu dulu.
+func broadcastRetryDelay(err error) (time.Duration, bool) {
+	if errors.Is(err, ErrSendBacklog) {
+		return sendScheduleMax, true
+	}
+	if apiErr, ok := asAPIError(err); ok && IsTooManyRequests(err) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+func (b *Bot) handleBroadcastCommand(ctx context.Context, msg *Message, lang string) error {
+	return b.sendChannelPicker(ctx, msg, lang, "broadcast", storage.RoleEditor, "broadcast_prompt")
+}
+
+func (b *Bot) handleBroadcastCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	b.states.SetState(cb.From.ID, &UserState{Step: "awaiting_broadcast_message", ChannelID: p.ChannelID})
+	text := i18n.GetMessage(lang, "broadcast_awaiting_message", struct{ ChannelTitle string }{b.channelTitle(ctx, p.ChannelID)})
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: cb.Message.Chat.ID, MessageID: cb.Message.ID, Text: text})
+}
+
+// broadcastRecipients mengembalikan subscriber channel kecuali yang diblokir.
+func (b *Bot) broadcastRecipients(ctx context.Context, channelID int64) ([]storage.Subscriber, error) {
+	subscribers, err := b.store.GetSubscribers(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	var recipients []storage.Subscriber
+	for _, sub := range subscribers {
+		if !b.isBlocked(ctx, channelID, sub.UserID) {
+			recipients = append(recipients, sub)
+		}
+	}
+	return recipients, nil
+}
+
+// broadcastContent mengubah pesan admin menjadi isi broadcast dengan format
+// yang sama seperti balasan trigger.
+func broadcastContent(msg *Message) (storage.TriggerRecord, bool) {
+	switch {
+	case len(msg.Photo) > 0:
+		bestPhoto := msg.Photo[0]
+		for _, photo := range msg.Photo {
+			if photo.FileSize > bestPhoto.FileSize {
+				bestPhoto = photo
+			}
+		}
+		return storage.TriggerRecord{ResponseType: "photo", ResponseFileID: bestPhoto.FileID, ResponseText: msg.Caption}, true
+	case msg.Sticker != nil:
+		return storage.TriggerRecord{ResponseType: "sticker", ResponseFileID: msg.Sticker.FileID}, true
+	case msg.Animation != nil:
+		// Animasi juga dikirim Telegram dengan field document, jadi periksa lebih dulu
+		return storage.TriggerRecord{ResponseType: "animation", ResponseFileID: msg.Animation.FileID, ResponseText: msg.Caption}, true
+	case msg.Document != nil:
+		return storage.TriggerRecord{ResponseType: "document", ResponseFileID: msg.Document.FileID, ResponseText: msg.Caption}, true
+	case msg.Audio != nil:
+		return storage.TriggerRecord{ResponseType: "audio", ResponseFileID: msg.Audio.FileID, ResponseText: msg.Caption}, true
+	case msg.Text != "":
+		return storage.TriggerRecord{ResponseType: "text", ResponseText: msg.Text}, true
+	}
+	return storage.TriggerRecord{}, false
+}
+
+// handleBroadcastMessage menerima isi broadcast, mengirim pratinjau lalu meminta
+// konfirmasi. Pesan baru sebelum konfirmasi menggantikan draf sebelumnya.
+func (b *Bot) handleBroadcastMessage(ctx context.Context, msg *Message, state *UserState, lang string) error {
+	record, ok := broadcastContent(msg)
+	if !ok {
+		text := i18n.GetMessage(lang, "broadcast_unsupported_type", nil)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+	}
+	record.ChannelID = state.ChannelID
+
+	subscribers, err := b.broadcastRecipients(ctx, state.ChannelID)
+	if err != nil {
+		log.Printf("error getting subscribers for channel %d: %v", state.ChannelID, err)
+		b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: "An error occurred."})
+		return err
+	}
+	if len(subscribers) == 0 {
+		b.states.ClearState(msg.From.ID)
+		text := i18n.GetMessage(lang, "broadcast_no_subscribers", nil)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+	}
+
+	settings, err := b.store.GetChannelSettings(ctx, state.ChannelID)
+	if err != nil {
+		log.Printf("could not load settings for channel %d, using defaults: %v", state.ChannelID, err)
+	}
+	// Pratinjau juga memastikan format pesan valid sebelum dikirim ke semua orang
+	if err := b.sendTriggerResponse(ctx, msg.Chat.ID, 0, record, msg.From, settings.ParseMode); err != nil {
+		text := i18n.GetMessage(lang, "broadcast_preview_failed", struct{ Error string }{err.Error()})
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+	}
+
+	state.Step = "awaiting_broadcast_confirm"
+	state.Draft = record
+	b.states.SetState(msg.From.ID, state)
+
+	text := i18n.GetMessage(lang, "broadcast_confirm", struct {
+		ChannelTitle string
+		Count        int
+	}{b.channelTitle(ctx, state.ChannelID), len(subscribers)})
+	keyboard := InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{{
+		{Text: i18n.GetMessage(lang, "broadcast_send_button", nil), CallbackData: b.callbackData("broadcast_send", callbackParams{})},
+		{Text: i18n.GetMessage(lang, "broadcast_discard_button", nil), CallbackData: b.callbackData("broadcast_discard", callbackParams{})},
+	}}}
+	return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text, ReplyMarkup: &keyboard})
+}
+
+func (b *Bot) handleBroadcastSendCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	userID := cb.From.ID
+	state, found := b.states.GetState(userID)
+	if !found || state.Step != "awaiting_broadcast_confirm" {
+		text := i18n.GetMessage(lang, "broadcast_session_expired", nil)
+		return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: cb.Message.Chat.ID, MessageID: cb.Message.ID, Text: text})
+	}
+
+	subscribers, err := b.broadcastRecipients(ctx, state.ChannelID)
+	if err != nil {
+		log.Printf("error getting subscribers for channel %d: %v", state.ChannelID, err)
+		return b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{CallbackQueryID: cb.ID, Text: "An error occurred.", ShowAlert: true})
+	}
+	settings, err := b.store.GetChannelSettings(ctx, state.ChannelID)
+	if err != nil {
+		log.Printf("could not load settings for channel %d, using defaults: %v", state.ChannelID, err)
+	}
+	b.states.ClearState(userID)
+
+	job := &BroadcastJob{
+		ChannelID:  state.ChannelID,
+		Lang:       lang,
+		Message:    state.Draft,
+		ParseMode:  settings.ParseMode,
+		Recipients: subscribers,
+		ChatID:     cb.Message.Chat.ID,
+		MessageID:  cb.Message.ID,
+	}
+	b.broadcasts.add(job)
+	b.recordAudit(ctx, state.ChannelID, userID, storage.AuditBroadcast, state.Draft.ResponseType, "", auditTriggerValue(state.Draft))
+	log.Printf("user %d started broadcast %d to %d subscribers of channel %d", userID, job.ID, len(subscribers), state.ChannelID)
+
+	b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{CallbackQueryID: cb.ID})
+	b.reportBroadcast(ctx, job)
+	b.inflight.Add(1)
+	go b.runBroadcast(ctx, job)
+	return nil
+}
+
+func (b *Bot) handleBroadcastDiscardCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	b.states.ClearState(cb.From.ID)
+	text := i18n.GetMessage(lang, "broadcast_discarded", nil)
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: cb.Message.Chat.ID, MessageID: cb.Message.ID, Text: text})
+}
+
+// broadcastControlCallback menjeda, melanjutkan atau membatalkan broadcast yang berjalan.
+func (b *Bot) broadcastControlCallback(status string) callbackHandler {
+	return func(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+		job, found := b.broadcasts.get(p.JobID)
+		if !found || job.ChannelID != p.ChannelID || !job.setStatus(status) {
+			return b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{
+				CallbackQueryID: cb.ID, Text: i18n.GetMessage(lang, "broadcast_not_found", nil), ShowAlert: true,
+			})
+		}
+		log.Printf("user %d set broadcast %d to %s", cb.From.ID, job.ID, status)
+		b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{CallbackQueryID: cb.ID})
+		b.reportBroadcast(ctx, job)
+		return nil
+	}
+}
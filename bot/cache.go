@@ -64,4 +64,93 @@ func (c *AdminCache) Invalidate(userID int64) {
 	defer c.mu.Unlock()
 	delete(c.data, userID)
 	log.Printf("cache invalidated for user %d", userID)
-}
\ No newline at end of file
+}
+
+// RemoveChannel menghapus satu channel dari semua entri cache,
+// misalnya setelah channel tersebut di-unregister.
+func (c *AdminCache) RemoveChannel(channelID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for userID, entry := range c.data {
+		var channels []storage.RegisteredChannel
+		for _, ch := range entry.channels {
+			if ch.ChannelID != channelID {
+				channels = append(channels, ch)
+			}
+		}
+		if channels == nil {
+			channels = []storage.RegisteredChannel{}
+		}
+		entry.channels = channels
+		c.data[userID] = entry
+	}
+}
+
+// triggerCacheDuration membatasi umur cache trigger, karena instance lain bisa
+// mengubah trigger tanpa membuang cache di instance ini.
+const triggerCacheDuration = time.Minute
+
+type triggerCacheEntry struct {
+	triggers  []storage.TriggerRecord
+	timestamp time.Time
+}
+
+// TriggerCache menyimpan semua trigger sebuah channel untuk mode "contains" dan
+// "prefix", agar tidak perlu memuat ulang seluruh trigger di setiap DM.
+type TriggerCache struct {
+	mu   sync.RWMutex
+	data map[int64]triggerCacheEntry
+}
+
+func NewTriggerCache() *TriggerCache {
+	return &TriggerCache{data: make(map[int64]triggerCacheEntry)}
+}
+
+func (c *TriggerCache) Get(channelID int64) ([]storage.TriggerRecord, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, found := c.data[channelID]
+	if !found || time.Since(entry.timestamp) > triggerCacheDuration {
+		return nil, false
+	}
+	return entry.triggers, true
+}
+
+func (c *TriggerCache) Set(channelID int64, triggers []storage.TriggerRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[channelID] = triggerCacheEntry{triggers: triggers, timestamp: time.Now()}
+}
+
+// Invalidate membuang trigger channel setelah ada yang ditambah, diubah atau dihapus.
+func (c *TriggerCache) Invalidate(channelID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.data, channelID)
+}
+
+// ParentChatCache menyimpan channel induk dari chat DM sebuah channel. Pasangan
+// ini tidak pernah berubah, jadi cukup satu getChat per chat DM selama bot
+// berjalan, dan pesan dari user yang diblokir atau dibisukan tidak memanggil
+// API sama sekali setelahnya.
+type ParentChatCache struct {
+	mu   sync.RWMutex
+	data map[int64]int64
+}
+
+func NewParentChatCache() *ParentChatCache {
+	return &ParentChatCache{data: make(map[int64]int64)}
+}
+
+func (c *ParentChatCache) Get(chatID int64) (int64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	parentID, found := c.data[chatID]
+	return parentID, found
+}
+
+func (c *ParentChatCache) Set(chatID, parentID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[chatID] = parentID
+}
@@ -0,0 +1,352 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+const (
+	// callbackTokenPrefix membedakan token dari nama aksi statis seperti "help_main".
+	callbackTokenPrefix = "t:"
+	callbackTokenTTL    = 24 * time.Hour
+	callbackSweepEvery  = 10 * time.Minute
+	// Masa berlaku token di storage diperpanjang paling sering sekali per jam
+	callbackResaveAfter = time.Hour
+)
+
+// callbackParams adalah parameter bertipe milik sebuah tombol inline.
+// Parameter disimpan di server; Telegram hanya menerima token pendeknya.
+type callbackParams struct {
+	ChannelID  int64
+	TriggerID  int64
+	RevisionID int64
+	TargetID   int64
+	MemberID   int64
+	UserID     int64 // subscriber yang dimaksud tombol, misalnya untuk blokir
+	Page       int
+	Days       int
+	JobID      int64
+	Value      string
+}
+
+type callbackEntry struct {
+	Action  string
+	Params  callbackParams
+	Expires time.Time
+	saved   time.Time // masa berlaku yang terakhir disimpan ke storage
+}
+
+type callbackKey struct {
+	Action string
+	Params callbackParams
+}
+
+// CallbackRegistry menyimpan aksi dan parameter tombol inline dengan token
+// acak, sehingga callback_data tidak perlu diurai dan tidak pernah melewati
+// batas 64 byte Telegram. Token baru dicatat di pending lalu disimpan ke
+// storage oleh flushCallbacks, agar tombol tetap berfungsi setelah restart.
+type CallbackRegistry struct {
+	mu        sync.Mutex
+	entries   map[string]callbackEntry
+	tokens    map[callbackKey]string // tombol yang sama memakai ulang token yang sama
+	pending   map[string]bool
+	ttl       time.Duration
+	lastSweep time.Time
+}
+
+func NewCallbackRegistry(ttl time.Duration) *CallbackRegistry {
+	return &CallbackRegistry{
+		entries:   make(map[string]callbackEntry),
+		tokens:    make(map[callbackKey]string),
+		pending:   make(map[string]bool),
+		ttl:       ttl,
+		lastSweep: time.Now(),
+	}
+}
+
+// Register mengembalikan callback_data untuk aksi dan parameter yang diberikan.
+func (r *CallbackRegistry) Register(action string, params callbackParams) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastSweep) > callbackSweepEvery {
+		r.sweep(now)
+	}
+
+	key := callbackKey{action, params}
+	if token, ok := r.tokens[key]; ok {
+		entry := r.entries[token]
+		entry.Expires = now.Add(r.ttl)
+		r.entries[token] = entry
+		// Masa berlaku di storage cukup diperpanjang sesekali
+		if entry.Expires.Sub(entry.saved) > callbackResaveAfter {
+			r.pending[token] = true
+		}
+		return callbackTokenPrefix + token
+	}
+
+	token := newCallbackToken()
+	for _, taken := r.entries[token]; taken; _, taken = r.entries[token] {
+		token = newCallbackToken()
+	}
+	r.entries[token] = callbackEntry{Action: action, Params: params, Expires: now.Add(r.ttl)}
+	r.tokens[key] = token
+	r.pending[token] = true
+	return callbackTokenPrefix + token
+}
+
+// Resolve mengubah callback_data kembali menjadi aksi dan parameternya dari
+// memori. Data tanpa prefix token dianggap nama aksi statis tanpa parameter.
+// token kosong berarti data tidak perlu dicari lagi di storage.
+func (r *CallbackRegistry) Resolve(data string) (entry callbackEntry, found bool, token string) {
+	if !strings.HasPrefix(data, callbackTokenPrefix) {
+		return callbackEntry{Action: data}, true, ""
+	}
+	token = strings.TrimPrefix(data, callbackTokenPrefix)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[token]
+	if !ok || time.Now().After(entry.Expires) {
+		return callbackEntry{}, false, token
+	}
+	return entry, true, token
+}
+
+// remember menyimpan di memori token yang dibuat sebelum restart atau oleh
+// instance lain.
+func (r *CallbackRegistry) remember(token string, entry callbackEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry.saved = entry.Expires
+	r.entries[token] = entry
+	r.tokens[callbackKey{entry.Action, entry.Params}] = token
+}
+
+// drainPending mengembalikan token yang belum disimpan ke storage.
+func (r *CallbackRegistry) drainPending() map[string]callbackEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	drained := make(map[string]callbackEntry, len(r.pending))
+	for token := range r.pending {
+		if entry, ok := r.entries[token]; ok {
+			drained[token] = entry
+		}
+	}
+	r.pending = make(map[string]bool)
+	return drained
+}
+
+// markSaved mencatat hasil flush; token yang gagal disimpan dicoba lagi nanti.
+func (r *CallbackRegistry) markSaved(entries map[string]callbackEntry, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for token, saved := range entries {
+		entry, exists := r.entries[token]
+		if !exists {
+			continue
+		}
+		if !ok {
+			r.pending[token] = true
+			continue
+		}
+		entry.saved = saved.Expires
+		r.entries[token] = entry
+	}
+}
+
+func (r *CallbackRegistry) sweep(now time.Time) {
+	for token, entry := range r.entries {
+		if now.After(entry.Expires) {
+			delete(r.entries, token)
+			delete(r.tokens, callbackKey{entry.Action, entry.Params})
+			delete(r.pending, token)
+		}
+	}
+	r.lastSweep = now
+}
+
+func newCallbackToken() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		// Token hanya perlu unik; akses tetap diperiksa oleh guardCallback
+		log.Printf("failed to generate random callback token: %v", err)
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// callbackData mendaftarkan tombol dan mengembalikan callback_data-nya.
+func (b *Bot) callbackData(action string, params callbackParams) string {
+	return b.callbacks.Register(action, params)
+}
+
+// resolveCallback mencari aksi tombol di memori, lalu di storage untuk tombol
+// yang dibuat sebelum restart atau oleh instance lain.
+func (b *Bot) resolveCallback(ctx context.Context, data string) (callbackEntry, bool) {
+	entry, found, token := b.callbacks.Resolve(data)
+	if found || token == "" {
+		return entry, found
+	}
+	stored, found, err := b.store.GetCallbackToken(ctx, token)
+	if err != nil {
+		log.Printf("could not load callback token: %v", err)
+		return callbackEntry{}, false
+	}
+	if !found || time.Now().After(stored.ExpiresAt) {
+		return callbackEntry{}, false
+	}
+	entry = callbackEntry{Action: stored.Action, Expires: stored.ExpiresAt}
+	if err := json.Unmarshal([]byte(stored.Params), &entry.Params); err != nil {
+		log.Printf("invalid params for callback token %s: %v", token, err)
+		return callbackEntry{}, false
+	}
+	b.callbacks.remember(token, entry)
+	return entry, true
+}
+
+// flushCallbacks menyimpan token tombol yang baru dibuat atau diperpanjang.
+func (b *Bot) flushCallbacks(ctx context.Context) {
+	pending := b.callbacks.drainPending()
+	if len(pending) == 0 {
+		return
+	}
+	tokens := make([]storage.CallbackToken, 0, len(pending))
+	for token, entry := range pending {
+		params, err := json.Marshal(entry.Params)
+		if err != nil {
+			log.Printf("could not encode params of callback %s: %v", entry.Action, err)
+			continue
+		}
+		tokens = append(tokens, storage.CallbackToken{Token: token, Action: entry.Action, Params: string(params), ExpiresAt: entry.Expires})
+	}
+	err := b.store.SaveCallbackTokens(ctx, tokens)
+	if err != nil {
+		log.Printf("failed to save %d callback tokens, will retry: %v", len(tokens), err)
+	}
+	b.callbacks.markSaved(pending, err == nil)
+}
+
+// pruneCallbackTokens menghapus token tombol yang sudah kedaluwarsa dari storage.
+func (b *Bot) pruneCallbackTokens(ctx context.Context) {
+	if err := b.store.PruneCallbackTokens(ctx, time.Now()); err != nil {
+		log.Printf("failed to prune callback tokens: %v", err)
+	}
+}
+
+type callbackHandler func(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error
+
+// accessFunc mengembalikan syarat akses sebuah callback. Nil berarti callback
+// tidak terikat channel.
+type accessFunc func(userID int64, p callbackParams) []accessCheck
+
+type callbackRoute struct {
+	Handle callbackHandler
+	Access accessFunc
+}
+
+// registerCallbackRoutes membangun tabel aksi callback. Aksi tanpa parameter
+// dikirim apa adanya sebagai callback_data; sisanya lewat callbackData.
+func (b *Bot) registerCallbackRoutes() {
+	viewer := b.paramAccess(storage.RoleViewer)
+	editor := b.paramAccess(storage.RoleEditor)
+	owner := b.paramAccess(storage.RoleOwner)
+	session := b.sessionAccess(storage.RoleEditor)
+
+	b.routes = map[string]callbackRoute{
+		"noop": {Handle: b.handleNoopCallback},
+
+		"help_main":               {Handle: b.handleHelpMainCallback},
+		"help_register":           {Handle: b.helpDetailCallback("help_register_text")},
+		"help_learn":              {Handle: b.helpDetailCallback("help_learn_text")},
+		"help_manage":             {Handle: b.helpDetailCallback("help_manage_text")},
+		"help_formatting":         {Handle: b.helpDetailCallback("help_formatting_text")},
+		"help_lang":               {Handle: b.helpDetailCallback("help_lang_text")},
+		"help_cancel":             {Handle: b.helpDetailCallback("help_cancel_text")},
+		"lang_prompt":             {Handle: b.handleLangPromptCallback},
+		"show_placeholder_help":   {Handle: b.handlePlaceholderHelpCallback},
+		"back_to_response_prompt": {Handle: b.handleBackToResponsePromptCallback, Access: session},
+
+		"manage":        {Handle: b.handleManageCallback, Access: viewer},
+		"del_prompt":    {Handle: b.handleDeletePromptCallback, Access: editor},
+		"del_confirm":   {Handle: b.handleDeleteConfirmCallback, Access: editor},
+		"learn_channel": {Handle: b.handleLearnChannelCallback, Access: editor},
+		"learn_type":    {Handle: b.handleLearnTypeCallback, Access: session},
+
+		"clone_one":    {Handle: b.handleCloneOneCallback, Access: editor},
+		"clone_all":    {Handle: b.handleCloneAllCallback, Access: editor},
+		"clone_select": {Handle: b.handleCloneSelectCallback, Access: editor},
+		"clone_page":   {Handle: b.handleClonePageCallback, Access: session},
+		"clone_toggle": {Handle: b.handleCloneToggleCallback, Access: session},
+		"clone_next":   {Handle: b.handleCloneNextCallback, Access: session},
+		"clone_target": {Handle: b.handleCloneTargetCallback, Access: session},
+		"clone_mode":   {Handle: b.handleCloneModeCallback, Access: session},
+
+		"rev_list":    {Handle: b.handleRevisionListCallback, Access: viewer},
+		"rev_restore": {Handle: b.handleRevisionRestoreCallback, Access: editor},
+
+		"settings": {Handle: b.handleSettingsCallback, Access: editor},
+
+		"stats": {Handle: b.handleStatsCallback, Access: viewer},
+
+		"unanswered":         {Handle: b.handleUnansweredCallback, Access: editor},
+		"unanswered_learn":   {Handle: b.handleUnansweredLearnCallback, Access: editor},
+		"unanswered_dismiss": {Handle: b.handleUnansweredDismissCallback, Access: editor},
+
+		"broadcast":         {Handle: b.handleBroadcastCallback, Access: editor},
+		"broadcast_send":    {Handle: b.handleBroadcastSendCallback, Access: session},
+		"broadcast_discard": {Handle: b.handleBroadcastDiscardCallback, Access: session},
+		"broadcast_pause":   {Handle: b.broadcastControlCallback(broadcastPaused), Access: editor},
+		"broadcast_resume":  {Handle: b.broadcastControlCallback(broadcastRunning), Access: editor},
+		"broadcast_cancel":  {Handle: b.broadcastControlCallback(broadcastCancelled), Access: editor},
+
+		"subs":        {Handle: b.handleSubscribersCallback, Access: editor},
+		"subs_search": {Handle: b.handleSubscriberSearchCallback, Access: editor},
+		"sub_view":    {Handle: b.handleSubscriberViewCallback, Access: editor},
+		"sub_note":    {Handle: b.handleSubscriberNoteCallback, Access: editor},
+		"sub_tags":    {Handle: b.handleSubscriberTagsCallback, Access: editor},
+
+		"blocklist":    {Handle: b.handleBlocklistCallback, Access: editor},
+		"block_prompt": {Handle: b.handleBlockPromptCallback, Access: editor},
+		"block_user":   {Handle: b.handleBlockUserCallback, Access: editor},
+		"unblock":      {Handle: b.handleUnblockCallback, Access: editor},
+
+		"audit":        {Handle: b.handleAuditCallback, Access: editor},
+		"audit_export": {Handle: b.handleAuditExportCallback, Access: editor},
+
+		"unreg":        {Handle: b.handleUnregisterCallback, Access: owner},
+		"unreg_cancel": {Handle: b.handleUnregisterCancelCallback},
+
+		"roles":        {Handle: b.handleRolesMenuCallback, Access: owner},
+		"roles_invite": {Handle: b.handleRolesInviteCallback, Access: owner},
+		"roles_remove": {Handle: b.handleRolesRemoveCallback, Access: owner},
+	}
+
+	for _, code := range []string{"en", "id", "ru"} {
+		b.routes["lang_"+code] = callbackRoute{Handle: b.setLanguageCallback(code)}
+	}
+}
+
+// expiredCallback menjawab tombol yang tokennya sudah kedaluwarsa atau tidak dikenal,
+// misalnya tombol dari pesan lama sebelum bot dijalankan ulang.
+func (b *Bot) expiredCallback(ctx context.Context, cb *CallbackQuery, lang string) error {
+	return b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{
+		CallbackQueryID: cb.ID, Text: i18n.GetMessage(lang, "callback_expired", nil), ShowAlert: true,
+	})
+}
+
+func (b *Bot) handleNoopCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	return b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{CallbackQueryID: cb.ID})
+}
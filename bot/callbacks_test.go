@@ -0,0 +1,48 @@
+package bot
+
+import (
+	"context"
+	"testing"
+
+	"telegram-dm-bot/config"
+)
+
+func TestCallbackSurvivesRestart(t *testing.T) {
+	params := callbackParams{ChannelID: testChannelID, TriggerID: 5, Page: 2, Value: "a *long* value"}
+
+	tests := []struct {
+		name      string
+		flush     bool
+		data      func(b *Bot) string
+		wantFound bool
+	}{
+		{name: "saved token", flush: true, data: func(b *Bot) string { return b.callbackData("manage", params) }, wantFound: true},
+		{name: "token lost before saving", data: func(b *Bot) string { return b.callbackData("manage", params) }},
+		{name: "unknown token", flush: true, data: func(*Bot) string { return callbackTokenPrefix + "nope" }},
+		{name: "static action", data: func(*Bot) string { return "help_main" }, wantFound: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			before, client, store := newTestBot(t)
+			data := tt.data(before)
+			if tt.flush {
+				before.flushCallbacks(ctx)
+			}
+
+			// Bot baru dengan storage yang sama, seperti setelah restart atau di instance lain
+			after := NewBotWithClient(ctx, &config.Config{}, store, client)
+			entry, found := after.resolveCallback(ctx, data)
+			if found != tt.wantFound {
+				t.Fatalf("found = %v, want %v", found, tt.wantFound)
+			}
+			if found && entry.Action == "manage" && entry.Params != params {
+				t.Errorf("params = %+v, want %+v", entry.Params, params)
+			}
+			if found && after.callbackData(entry.Action, entry.Params) != data && entry.Action == "manage" {
+				t.Error("the restarted bot issued a different token for the same button")
+			}
+		})
+	}
+}
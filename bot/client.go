@@ -0,0 +1,30 @@
+package bot
+
+import "context"
+
+// TelegramClient adalah semua method Bot API yang dipakai bot. API adalah
+// implementasi sebenarnya; test memakai client palsu tanpa jaringan.
+type TelegramClient interface {
+	SendMessage(ctx context.Context, payload SendMessagePayload) error
+	SendSticker(ctx context.Context, payload SendStickerPayload) error
+	SendDocument(ctx context.Context, payload SendDocumentPayload) error
+	SendAnimation(ctx context.Context, payload SendAnimationPayload) error
+	SendAudio(ctx context.Context, payload SendAudioPayload) error
+	SendPhoto(ctx context.Context, payload SendPhotoPayload) error
+	SendDocumentFile(ctx context.Context, chatID int64, filename string, content []byte, caption string) error
+	EditMessageText(ctx context.Context, payload EditMessageTextPayload) error
+	AnswerCallbackQuery(ctx context.Context, payload AnswerCallbackQueryPayload) error
+	SetWebhook(ctx context.Context, payload SetWebhookPayload) error
+	DeleteWebhook(ctx context.Context, payload DeleteWebhookPayload) error
+	GetUpdates(ctx context.Context, offset int) ([]Update, error)
+	GetChatAdministrators(ctx context.Context, chatID int64) ([]ChatMember, error)
+	GetChat(ctx context.Context, chatID interface{}) (*GetChatResponse, error)
+	GetMe(ctx context.Context) (*User, error)
+
+	// QueueDepth adalah jumlah pesan keluar yang sedang menunggu giliran
+	QueueDepth() int
+	// Close dipanggil sekali saat bot berhenti
+	Close()
+}
+
+var _ TelegramClient = (*API)(nil)
@@ -0,0 +1,345 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+const cloneSelectPageSize = 8
+
+const (
+	cloneModeSkip      = "skip"
+	cloneModeOverwrite = "overwrite"
+	cloneModeRename    = "rename"
+)
+
+type cloneResult struct {
+	Copied      int
+	Overwritten int
+	Renamed     int
+	Skipped     int
+}
+
+// Handler tombol "clone_*" untuk menyalin trigger dari satu channel ke channel lain.
+// Langkah-langkahnya disimpan di sesi "cloning" milik user.
+
+func (b *Bot) handleCloneOneCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	b.states.SetState(cb.From.ID, &UserState{Step: "cloning", ChannelID: p.ChannelID, SelectedIDs: []int64{p.TriggerID}})
+	return b.sendCloneTargetPrompt(ctx, cb.Message.Chat.ID, cb.Message.ID, cb.From.ID, lang)
+}
+
+func (b *Bot) handleCloneAllCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	triggers, err := b.store.GetTriggersByChannel(ctx, p.ChannelID)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for _, t := range triggers {
+		ids = append(ids, t.ID)
+	}
+	b.states.SetState(cb.From.ID, &UserState{Step: "cloning", ChannelID: p.ChannelID, SelectedIDs: ids})
+	return b.sendCloneTargetPrompt(ctx, cb.Message.Chat.ID, cb.Message.ID, cb.From.ID, lang)
+}
+
+func (b *Bot) handleCloneSelectCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	b.states.SetState(cb.From.ID, &UserState{Step: "cloning", ChannelID: p.ChannelID})
+	return b.sendCloneSelection(ctx, cb.Message.Chat.ID, cb.Message.ID, cb.From.ID, lang, p.Page)
+}
+
+func (b *Bot) handleClonePageCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	return b.sendCloneSelection(ctx, cb.Message.Chat.ID, cb.Message.ID, cb.From.ID, lang, p.Page)
+}
+
+func (b *Bot) handleCloneToggleCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	userID := cb.From.ID
+	state, found := b.states.GetState(userID)
+	if !found || state.Step != "cloning" {
+		return b.sendCloneSessionExpired(ctx, cb.Message.Chat.ID, cb.Message.ID, lang)
+	}
+	var selected []int64
+	removed := false
+	for _, id := range state.SelectedIDs {
+		if id == p.TriggerID {
+			removed = true
+			continue
+		}
+		selected = append(selected, id)
+	}
+	if !removed {
+		selected = append(selected, p.TriggerID)
+	}
+	state.SelectedIDs = selected
+	b.states.SetState(userID, state)
+	return b.sendCloneSelection(ctx, cb.Message.Chat.ID, cb.Message.ID, userID, lang, p.Page)
+}
+
+func (b *Bot) handleCloneNextCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	state, found := b.states.GetState(cb.From.ID)
+	if !found || state.Step != "cloning" {
+		return b.sendCloneSessionExpired(ctx, cb.Message.Chat.ID, cb.Message.ID, lang)
+	}
+	if len(state.SelectedIDs) == 0 {
+		return b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{
+			CallbackQueryID: cb.ID, Text: i18n.GetMessage(lang, "copy_nothing_selected", nil), ShowAlert: true,
+		})
+	}
+	return b.sendCloneTargetPrompt(ctx, cb.Message.Chat.ID, cb.Message.ID, cb.From.ID, lang)
+}
+
+func (b *Bot) handleCloneTargetCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	chatID := cb.Message.Chat.ID
+	messageID := cb.Message.ID
+	state, found := b.states.GetState(cb.From.ID)
+	if !found || state.Step != "cloning" {
+		return b.sendCloneSessionExpired(ctx, chatID, messageID, lang)
+	}
+	state.TargetChannelID = p.TargetID
+	b.states.SetState(cb.From.ID, state)
+
+	title := b.channelTitle(ctx, p.TargetID)
+	text := i18n.GetMessage(lang, "copy_prompt_conflict", struct{ ChannelTitle string }{title})
+	keyboard := InlineKeyboardMarkup{
+		InlineKeyboard: [][]InlineKeyboardButton{
+			{
+				{Text: i18n.GetMessage(lang, "copy_conflict_skip", nil), CallbackData: b.callbackData("clone_mode", callbackParams{Value: cloneModeSkip})},
+				{Text: i18n.GetMessage(lang, "copy_conflict_overwrite", nil), CallbackData: b.callbackData("clone_mode", callbackParams{Value: cloneModeOverwrite})},
+				{Text: i18n.GetMessage(lang, "copy_conflict_rename", nil), CallbackData: b.callbackData("clone_mode", callbackParams{Value: cloneModeRename})},
+			},
+			{{Text: i18n.GetMessage(lang, "cancel_delete_button", nil), CallbackData: b.callbackData("manage", callbackParams{ChannelID: state.ChannelID, Page: 1})}},
+		},
+	}
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{
+		ChatID: chatID, MessageID: messageID, Text: text, ParseMode: "Markdown", ReplyMarkup: &keyboard,
+	})
+}
+
+func (b *Bot) handleCloneModeCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	userID := cb.From.ID
+	chatID := cb.Message.Chat.ID
+	messageID := cb.Message.ID
+	state, found := b.states.GetState(userID)
+	if !found || state.Step != "cloning" || state.TargetChannelID == 0 {
+		return b.sendCloneSessionExpired(ctx, chatID, messageID, lang)
+	}
+
+	result, err := b.cloneTriggers(ctx, userID, state.ChannelID, state.TargetChannelID, state.SelectedIDs, p.Value)
+	b.states.ClearState(userID)
+	if err != nil {
+		log.Printf("failed to clone triggers from %d to %d: %v", state.ChannelID, state.TargetChannelID, err)
+		return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: chatID, MessageID: messageID, Text: "An error occurred."})
+	}
+
+	textData := struct {
+		ChannelTitle                          string
+		Copied, Overwritten, Renamed, Skipped int
+	}{b.channelTitle(ctx, state.TargetChannelID), result.Copied, result.Overwritten, result.Renamed, result.Skipped}
+	text := i18n.GetMessage(lang, "copy_done", textData)
+	keyboard := InlineKeyboardMarkup{
+		InlineKeyboard: [][]InlineKeyboardButton{
+			{{Text: i18n.GetMessage(lang, "back_button", nil), CallbackData: b.callbackData("manage", callbackParams{ChannelID: state.ChannelID, Page: 1})}},
+		},
+	}
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{
+		ChatID: chatID, MessageID: messageID, Text: text, ParseMode: "Markdown", ReplyMarkup: &keyboard,
+	})
+}
+
+// sendCloneSelection menampilkan daftar trigger dengan tanda centang
+// agar admin bisa memilih trigger mana saja yang akan disalin.
+func (b *Bot) sendCloneSelection(ctx context.Context, chatID int64, messageID int, userID int64, lang string, page int) error {
+	state, found := b.states.GetState(userID)
+	if !found || state.Step != "cloning" {
+		return b.sendCloneSessionExpired(ctx, chatID, messageID, lang)
+	}
+
+	triggers, err := b.store.GetTriggersByChannel(ctx, state.ChannelID)
+	if err != nil {
+		return err
+	}
+
+	totalPages := (len(triggers) + cloneSelectPageSize - 1) / cloneSelectPageSize
+	if totalPages == 0 {
+		totalPages = 1
+	}
+	if page < 1 || page > totalPages {
+		page = 1
+	}
+	start := (page - 1) * cloneSelectPageSize
+	end := start + cloneSelectPageSize
+	if end > len(triggers) {
+		end = len(triggers)
+	}
+
+	selected := make(map[int64]bool)
+	for _, id := range state.SelectedIDs {
+		selected[id] = true
+	}
+
+	var keyboard [][]InlineKeyboardButton
+	for _, trigger := range triggers[start:end] {
+		mark := "⬜"
+		if selected[trigger.ID] {
+			mark = "✅"
+		}
+		displayTrigger := trigger.TriggerText
+		if len(displayTrigger) > 20 {
+			displayTrigger = displayTrigger[:17] + "..."
+		}
+		keyboard = append(keyboard, []InlineKeyboardButton{
+			{Text: mark + " " + displayTrigger, CallbackData: b.callbackData("clone_toggle", callbackParams{TriggerID: trigger.ID, Page: page})},
+		})
+	}
+
+	var navRow []InlineKeyboardButton
+	if page > 1 {
+		navRow = append(navRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "prev_button", nil), CallbackData: b.callbackData("clone_page", callbackParams{Page: page - 1})})
+	}
+	if page < totalPages {
+		navRow = append(navRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "next_button", nil), CallbackData: b.callbackData("clone_page", callbackParams{Page: page + 1})})
+	}
+	if len(navRow) > 0 {
+		keyboard = append(keyboard, navRow)
+	}
+	keyboard = append(keyboard, []InlineKeyboardButton{
+		{Text: i18n.GetMessage(lang, "cancel_delete_button", nil), CallbackData: b.callbackData("manage", callbackParams{ChannelID: state.ChannelID, Page: 1})},
+		{Text: i18n.GetMessage(lang, "copy_next_button", nil), CallbackData: "clone_next"},
+	})
+
+	textData := struct {
+		ChannelTitle string
+		Count        int
+	}{b.channelTitle(ctx, state.ChannelID), len(state.SelectedIDs)}
+	text := i18n.GetMessage(lang, "copy_select_title", textData)
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{
+		ChatID: chatID, MessageID: messageID, Text: text, ParseMode: "Markdown", ReplyMarkup: &InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+}
+
+// sendCloneTargetPrompt menampilkan channel lain di mana user juga editor.
+func (b *Bot) sendCloneTargetPrompt(ctx context.Context, chatID int64, messageID int, userID int64, lang string) error {
+	state, found := b.states.GetState(userID)
+	if !found || state.Step != "cloning" {
+		return b.sendCloneSessionExpired(ctx, chatID, messageID, lang)
+	}
+
+	channels, err := b.getChannelsWithRole(ctx, userID, storage.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	var keyboard [][]InlineKeyboardButton
+	for _, ch := range channels {
+		if ch.ChannelID == state.ChannelID {
+			continue
+		}
+		keyboard = append(keyboard, []InlineKeyboardButton{
+			{Text: ch.Title, CallbackData: b.callbackData("clone_target", callbackParams{TargetID: ch.ChannelID})},
+		})
+	}
+	backButton := InlineKeyboardButton{
+		Text: i18n.GetMessage(lang, "cancel_delete_button", nil), CallbackData: b.callbackData("manage", callbackParams{ChannelID: state.ChannelID, Page: 1}),
+	}
+
+	if len(keyboard) == 0 {
+		b.states.ClearState(userID)
+		return b.api.EditMessageText(ctx, EditMessageTextPayload{
+			ChatID: chatID, MessageID: messageID, Text: i18n.GetMessage(lang, "copy_no_targets", nil),
+			ReplyMarkup: &InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{{backButton}}},
+		})
+	}
+	keyboard = append(keyboard, []InlineKeyboardButton{backButton})
+
+	text := i18n.GetMessage(lang, "copy_prompt_target", struct{ Count int }{len(state.SelectedIDs)})
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{
+		ChatID: chatID, MessageID: messageID, Text: text, ReplyMarkup: &InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+}
+
+func (b *Bot) sendCloneSessionExpired(ctx context.Context, chatID int64, messageID int, lang string) error {
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{
+		ChatID: chatID, MessageID: messageID, Text: i18n.GetMessage(lang, "copy_session_expired", nil),
+	})
+}
+
+// cloneTriggers menyalin trigger terpilih dari channel sumber ke channel tujuan.
+// mode menentukan apa yang terjadi jika trigger dengan teks yang sama sudah ada.
+func (b *Bot) cloneTriggers(ctx context.Context, userID, sourceID, targetID int64, triggerIDs []int64, mode string) (cloneResult, error) {
+	var result cloneResult
+
+	sourceTriggers, err := b.store.GetTriggersByChannel(ctx, sourceID)
+	if err != nil {
+		return result, err
+	}
+	targetTriggers, err := b.store.GetTriggersByChannel(ctx, targetID)
+	if err != nil {
+		return result, err
+	}
+
+	wanted := make(map[int64]bool)
+	for _, id := range triggerIDs {
+		wanted[id] = true
+	}
+	existing := make(map[string]bool)
+	for _, t := range targetTriggers {
+		existing[strings.ToLower(t.TriggerText)] = true
+	}
+
+	for _, src := range sourceTriggers {
+		if !wanted[src.ID] {
+			continue
+		}
+
+		record := storage.TriggerRecord{
+			ChannelID:      targetID,
+			TriggerText:    src.TriggerText,
+			ResponseType:   src.ResponseType,
+			ResponseText:   src.ResponseText,
+			ResponseFileID: src.ResponseFileID,
+		}
+
+		key := strings.ToLower(src.TriggerText)
+		if existing[key] {
+			switch mode {
+			case cloneModeOverwrite:
+				result.Overwritten++
+			case cloneModeRename:
+				for n := 2; ; n++ {
+					candidate := fmt.Sprintf("%s (%d)", src.TriggerText, n)
+					if !existing[strings.ToLower(candidate)] {
+						record.TriggerText = candidate
+						break
+					}
+				}
+				result.Renamed++
+			default:
+				result.Skipped++
+				continue
+			}
+		}
+
+		if err := b.saveTrigger(ctx, record, userID, storage.AuditImport); err != nil {
+			return result, err
+		}
+		existing[strings.ToLower(record.TriggerText)] = true
+		result.Copied++
+	}
+
+	log.Printf("cloned %d triggers from channel %d to %d (mode: %s)", result.Copied, sourceID, targetID, mode)
+	return result, nil
+}
+
+// channelTitle mengambil judul channel, kembali ke ID jika getChat gagal.
+func (b *Bot) channelTitle(ctx context.Context, channelID int64) string {
+	channelInfo, err := b.api.GetChat(ctx, channelID)
+	if err != nil {
+		log.Printf("could not get chat info for %d: %v", channelID, err)
+		return strconv.FormatInt(channelID, 10)
+	}
+	return channelInfo.Title
+}
@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+// cronTime membaca waktu UTC "YYYY-MM-DD hh:mm". 2026-10-18 adalah hari Minggu.
+func cronTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	v, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"0 9 * * *", false},
+		{"*/15 * * * *", false},
+		{"0 9-17/2 * * 1-5", false},
+		{"30 8 1,15 * *", false},
+		{"0 9 * * 7", false},
+		{"5/10 * * * *", false},
+		{"0 9 * *", true},
+		{"0 9 * * * *", true},
+		{"60 * * * *", true},
+		{"0 24 * * *", true},
+		{"0 0 0 * *", true},
+		{"0 0 * 13 *", true},
+		{"0 0 * * 8", true},
+		{"0 17-9 * * *", true},
+		{"*/0 * * * *", true},
+		{"a * * * *", true},
+		{"1-x * * * *", true},
+	}
+	for _, tt := range tests {
+		_, err := parseCron(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCron(%q) error = %v, want error %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCronMatches(t *testing.T) {
+	tests := []struct {
+		expr string
+		at   string
+		want bool
+	}{
+		{"0 9 * * *", "2026-10-18 09:00", true},
+		{"0 9 * * *", "2026-10-18 09:01", false},
+		{"*/15 * * * *", "2026-10-18 10:45", true},
+		{"*/15 * * * *", "2026-10-18 10:50", false},
+		{"5/10 * * * *", "2026-10-18 10:25", true},
+		{"5/10 * * * *", "2026-10-18 10:20", false},
+		{"0 9-17/2 * * *", "2026-10-18 13:00", true},
+		{"0 9-17/2 * * *", "2026-10-18 14:00", false},
+		{"0 9 * * 0", "2026-10-18 09:00", true},
+		{"0 9 * * 7", "2026-10-18 09:00", true},
+		{"0 9 * * 1-5", "2026-10-18 09:00", false},
+		{"0 9 * 11 *", "2026-10-18 09:00", false},
+		// Tanggal dan hari sama-sama dibatasi: cukup salah satu yang cocok
+		{"0 9 1 * 0", "2026-10-18 09:00", true},
+		{"0 9 18 * 1", "2026-10-18 09:00", true},
+		{"0 9 1 * 1", "2026-10-18 09:00", false},
+		// Hanya tanggal yang dibatasi: hari diabaikan
+		{"0 9 18 * *", "2026-10-18 09:00", true},
+		{"0 9 19 * *", "2026-10-18 09:00", false},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tt.expr, err)
+		}
+		if got := schedule.Matches(cronTime(t, tt.at)); got != tt.want {
+			t.Errorf("%q matches %s = %v, want %v", tt.expr, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestCronPrev(t *testing.T) {
+	tests := []struct {
+		expr  string
+		from  string
+		limit time.Duration
+		want  string // kosong berarti tidak ditemukan
+	}{
+		{"0 9 * * *", "2026-10-18 09:00", 48 * time.Hour, "2026-10-17 09:00"},
+		{"0 9 * * *", "2026-10-18 09:30", 48 * time.Hour, "2026-10-18 09:00"},
+		{"0 9 * * 1", "2026-10-19 09:00", 8 * 24 * time.Hour, "2026-10-12 09:00"},
+		{"*/15 * * * *", "2026-10-18 10:07", time.Hour, "2026-10-18 10:00"},
+		{"0 0 1 * *", "2026-10-18 00:00", 31 * 24 * time.Hour, "2026-10-01 00:00"},
+		{"0 9 * * 1", "2026-10-19 09:00", 24 * time.Hour, ""},
+		{"0 0 29 2 *", "2026-10-18 00:00", digestMaxPeriod, ""},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tt.expr, err)
+		}
+		got, found := schedule.Prev(cronTime(t, tt.from), tt.limit)
+		if tt.want == "" {
+			if found {
+				t.Errorf("%q prev before %s = %s, want none", tt.expr, tt.from, got)
+			}
+			continue
+		}
+		if !found || !got.Equal(cronTime(t, tt.want)) {
+			t.Errorf("%q prev before %s = %s (found %v), want %s", tt.expr, tt.from, got, found, tt.want)
+		}
+	}
+}
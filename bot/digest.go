@@ -0,0 +1,266 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	_ "time/tzdata" // zona waktu tetap tersedia walaupun image tidak punya tzdata
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+const (
+	// digestMaxPeriod membatasi seberapa jauh ke belakang jadwal sebelumnya dicari.
+	digestMaxPeriod = 32 * 24 * time.Hour
+	digestTopLimit  = 5
+)
+
+// Jadwal digest yang bisa dipilih lewat tombol di /settings; jadwal lain
+// dimasukkan manual sebagai ekspresi cron.
+var digestPresetCycle = []string{"", "0 9 * * *", "0 9 * * 1"}
+
+// channelLocation mengembalikan zona waktu channel, atau UTC jika kosong/tidak valid.
+func channelLocation(settings storage.ChannelSettings) *time.Location {
+	if settings.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		log.Printf("invalid timezone %q for channel %d, using UTC: %v", settings.Timezone, settings.ChannelID, err)
+		return time.UTC
+	}
+	return loc
+}
+
+// runDigestScheduler memeriksa jadwal digest semua channel di awal setiap menit
+// sampai ctx selesai. Digest dikirim dengan sendCtx, seperti handler update,
+// agar yang sedang terkirim sempat selesai saat bot dihentikan.
+func (b *Bot) runDigestScheduler(ctx, sendCtx context.Context) {
+	// Tunggu sampai awal menit berikutnya agar pengecekan jatuh tepat di menit jadwal
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(time.Until(time.Now().Truncate(time.Minute).Add(time.Minute))):
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		b.checkDigests(ctx, sendCtx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Bot) checkDigests(ctx, sendCtx context.Context, now time.Time) {
+	scheduled, err := b.store.GetScheduledChannelSettings(ctx)
+	if err != nil {
+		log.Printf("could not load digest schedules: %v", err)
+		return
+	}
+
+	for _, settings := range scheduled {
+		schedule, err := parseCron(settings.DigestSchedule)
+		if err != nil {
+			log.Printf("invalid digest schedule %q for channel %d: %v", settings.DigestSchedule, settings.ChannelID, err)
+			continue
+		}
+		local := now.In(channelLocation(settings)).Truncate(time.Minute)
+		if !schedule.Matches(local) {
+			continue
+		}
+
+		// Laporan mencakup waktu sejak jadwal sebelumnya
+		from, found := schedule.Prev(local, digestMaxPeriod)
+		if !found {
+			from = local.Add(-24 * time.Hour)
+		}
+		b.inflight.Add(1)
+		go func(settings storage.ChannelSettings, from, to time.Time) {
+			defer b.inflight.Done()
+			if err := b.sendDigest(sendCtx, settings, from, to); err != nil {
+				log.Printf("failed to send digest for channel %d: %v", settings.ChannelID, err)
+			}
+		}(settings, from, local)
+	}
+}
+
+type digestSummary struct {
+	DMs, Matched, Unmatched, FailedSends int
+	NewSubscribers                       int
+	Top                                  []triggerStat
+}
+
+// buildDigest mengumpulkan angka laporan untuk rentang [from, to).
+func (b *Bot) buildDigest(ctx context.Context, channelID int64, from, to time.Time) (digestSummary, error) {
+	var summary digestSummary
+	b.flushActivity(ctx)
+
+	activity, err := b.store.GetChannelActivity(ctx, channelID, from.Truncate(time.Hour), to)
+	if err != nil {
+		return summary, err
+	}
+	for _, a := range activity {
+		summary.DMs += a.DMs
+		summary.Matched += a.Matched
+		summary.Unmatched += a.Unmatched
+		summary.FailedSends += a.FailedSends
+	}
+
+	if summary.NewSubscribers, err = b.store.CountNewSubscribers(ctx, channelID, from, to); err != nil {
+		return summary, err
+	}
+
+	// Hitungan trigger disimpan per hari, jadi trigger teratas dihitung per hari penuh
+	counts, err := b.channelTriggerHits(ctx, channelID, from)
+	if err != nil {
+		return summary, err
+	}
+	triggers, err := b.store.GetTriggersByChannel(ctx, channelID)
+	if err != nil {
+		return summary, err
+	}
+	triggerText := make(map[int64]string)
+	for _, t := range triggers {
+		triggerText[t.ID] = t.TriggerText
+	}
+	perTrigger := make(map[int64]int)
+	for _, c := range counts {
+		perTrigger[c.TriggerID] += c.Hits
+	}
+	for id, hits := range perTrigger {
+		if text, exists := triggerText[id]; exists {
+			summary.Top = append(summary.Top, triggerStat{TriggerID: id, Trigger: text, Hits: hits})
+		}
+	}
+	sort.Slice(summary.Top, func(i, j int) bool {
+		if summary.Top[i].Hits != summary.Top[j].Hits {
+			return summary.Top[i].Hits > summary.Top[j].Hits
+		}
+		return summary.Top[i].Trigger < summary.Top[j].Trigger
+	})
+	if len(summary.Top) > digestTopLimit {
+		summary.Top = summary.Top[:digestTopLimit]
+	}
+	return summary, nil
+}
+
+// sendDigest mengirim laporan ke chat pribadi setiap penerima dari
+// digestRecipients, dalam bahasa pilihan masing-masing. Jadwal to ditandai di
+// storage sebelum laporan dibuat, sehingga digest yang sama tidak terkirim dua
+// kali; digest yang gagal setelah ditandai tidak diulang.
+func (b *Bot) sendDigest(ctx context.Context, settings storage.ChannelSettings, from, to time.Time) error {
+	channelID := settings.ChannelID
+	channel, registered, err := b.store.GetRegisteredChannel(ctx, channelID)
+	if err != nil || !registered {
+		return err
+	}
+
+	// Setiap instance memeriksa jadwal yang sama, jadi hanya yang pertama
+	// menandai jadwal ini yang mengirim digest
+	marked, err := b.store.MarkDigestSent(ctx, channelID, to)
+	if err != nil {
+		return err
+	}
+	if !marked {
+		log.Printf("digest for channel %d at %s was already sent", channelID, to.Format(time.RFC3339))
+		return nil
+	}
+
+	summary, err := b.buildDigest(ctx, channelID, from, to)
+	if err != nil {
+		return err
+	}
+
+	recipients, err := b.digestRecipients(ctx, channel)
+	if err != nil {
+		return err
+	}
+
+	title := b.channelTitle(ctx, channelID)
+	for _, user := range recipients {
+		userLang := b.getUserLang(ctx, user.ID, user.LangCode)
+		text := digestText(userLang, title, from, to, summary)
+		if err := b.api.SendMessage(ctx, SendMessagePayload{ChatID: user.ID, Text: text}); err != nil {
+			log.Printf("could not send digest for channel %d to user %d: %v", channelID, user.ID, err)
+		}
+	}
+	log.Printf("sent digest for channel %d covering %s to %s", channelID, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	return nil
+}
+
+// digestRecipients mengembalikan semua user yang boleh melihat statistik
+// channel: pemilik, admin Telegram dan kolaborator editor/viewer. Setiap user
+// hanya muncul sekali dan bot lain dilewati.
+func (b *Bot) digestRecipients(ctx context.Context, channel storage.RegisteredChannel) ([]User, error) {
+	admins, err := b.channelAdministrators(ctx, channel.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := b.store.GetChannelRoles(ctx, channel.ChannelID)
+	if err != nil {
+		return nil, err
+	}
+
+	var recipients []User
+	seen := make(map[int64]bool)
+	add := func(user User) {
+		if user.IsBot || user.ID == 0 || seen[user.ID] {
+			return
+		}
+		seen[user.ID] = true
+		recipients = append(recipients, user)
+	}
+	for _, admin := range admins {
+		add(admin.User)
+	}
+	add(User{ID: channel.OwnerID})
+	for _, role := range roles {
+		add(User{ID: role.UserID})
+	}
+	return recipients, nil
+}
+
+func digestText(lang, channelTitle string, from, to time.Time, summary digestSummary) string {
+	var top strings.Builder
+	if len(summary.Top) == 0 {
+		top.WriteString(i18n.GetMessage(lang, "stats_no_hits", nil))
+	}
+	for i, stat := range summary.Top {
+		if i > 0 {
+			top.WriteString("\n")
+		}
+		top.WriteString(i18n.GetMessage(lang, "digest_top_entry", struct {
+			Rank    int
+			Trigger string
+			Hits    int
+		}{i + 1, stat.Trigger, stat.Hits}))
+	}
+
+	data := struct {
+		ChannelTitle   string
+		From, To       string
+		DMs            int
+		Matched        int
+		Unmatched      int
+		NewSubscribers int
+		FailedSends    int
+		TopTriggers    string
+	}{
+		ChannelTitle:   channelTitle,
+		From:           from.Format("2006-01-02 15:04"),
+		To:             to.Format("2006-01-02 15:04 MST"),
+		DMs:            summary.DMs,
+		Matched:        summary.Matched,
+		Unmatched:      summary.Unmatched,
+		NewSubscribers: summary.NewSubscribers,
+		FailedSends:    summary.FailedSends,
+		TopTriggers:    top.String(),
+	}
+	return i18n.GetMessage(lang, "digest_report", data)
+}
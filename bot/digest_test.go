@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"telegram-dm-bot/storage"
+)
+
+func TestDigestRecipients(t *testing.T) {
+	b, client, store := newTestBot(t)
+	store.channels[testChannelID] = storage.RegisteredChannel{ChannelID: testChannelID, Title: "News", OwnerID: 7}
+	client.admins[testChannelID] = []ChatMember{
+		{User: User{ID: 8, LangCode: "en"}, Status: "administrator"},
+		{User: User{ID: 1, IsBot: true}, Status: "administrator"},
+	}
+	store.roles = []storage.ChannelRole{
+		{ChannelID: testChannelID, UserID: 9, Role: storage.RoleViewer},
+		{ChannelID: testChannelID, UserID: 10, Role: storage.RoleEditor},
+		{ChannelID: testChannelID, UserID: 8, Role: storage.RoleEditor},
+		{ChannelID: -1999, UserID: 11, Role: storage.RoleEditor},
+	}
+
+	to := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	settings := storage.ChannelSettings{ChannelID: testChannelID, DigestSchedule: "0 9 * * *"}
+	if err := b.sendDigest(context.Background(), settings, to.Add(-24*time.Hour), to); err != nil {
+		t.Fatalf("sendDigest: %v", err)
+	}
+
+	got := make(map[int64]int)
+	for _, call := range client.sent("sendMessage") {
+		got[call.Payload.(SendMessagePayload).ChatID]++
+	}
+	want := map[int64]int{7: 1, 8: 1, 9: 1, 10: 1}
+	if len(got) != len(want) {
+		t.Fatalf("digest sent to %v, want %v", got, want)
+	}
+	for id, n := range want {
+		if got[id] != n {
+			t.Errorf("user %d got %d digests, want %d", id, got[id], n)
+		}
+	}
+}
+
+func TestDigestSentOncePerSchedule(t *testing.T) {
+	ctx := context.Background()
+	b, client, store := newTestBot(t)
+	store.channels[testChannelID] = storage.RegisteredChannel{ChannelID: testChannelID, Title: "News", OwnerID: 7}
+	settings := storage.ChannelSettings{ChannelID: testChannelID, DigestSchedule: "0 9 * * *"}
+	to := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+
+	// Instance kedua yang memeriksa jadwal yang sama tidak mengirim lagi
+	for i := 0; i < 2; i++ {
+		if err := b.sendDigest(ctx, settings, to.Add(-24*time.Hour), to); err != nil {
+			t.Fatalf("sendDigest: %v", err)
+		}
+	}
+	if got := len(client.sent("sendMessage")); got != 1 {
+		t.Fatalf("sent %d digests for one schedule, want 1", got)
+	}
+
+	if err := b.sendDigest(ctx, settings, to, to.Add(24*time.Hour)); err != nil {
+		t.Fatalf("sendDigest: %v", err)
+	}
+	if got := len(client.sent("sendMessage")); got != 2 {
+		t.Errorf("sent %d digests after the next schedule, want 2", got)
+	}
+}
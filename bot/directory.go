@@ -0,0 +1,258 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+const directoryPageSize = 8
+
+// clearFieldInput adalah balasan yang menghapus catatan atau tag subscriber.
+const clearFieldInput = "-"
+
+func (b *Bot) handleSubscribersCommand(ctx context.Context, msg *Message, lang string) error {
+	return b.sendChannelPicker(ctx, msg, lang, "subs", storage.RoleEditor, "subscribers_prompt")
+}
+
+// Di semua tombol direktori, Value membawa kata kunci pencarian yang sedang aktif.
+
+func (b *Bot) handleSubscribersCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	return b.sendSubscriberDirectory(ctx, cb.Message.Chat.ID, cb.Message.ID, lang, p.ChannelID, p.Page, p.Value)
+}
+
+func (b *Bot) handleSubscriberSearchCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	b.states.SetState(cb.From.ID, &UserState{Step: "awaiting_subscriber_search", ChannelID: p.ChannelID})
+	text := i18n.GetMessage(lang, "subscribers_awaiting_search", nil)
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: cb.Message.Chat.ID, MessageID: cb.Message.ID, Text: text})
+}
+
+func (b *Bot) handleSubscriberSearchMessage(ctx context.Context, msg *Message, state *UserState, lang string) error {
+	query := strings.TrimSpace(msg.Text)
+	if query == "" {
+		data := struct{ ExpectedType string }{"text"}
+		text := i18n.GetMessage(lang, "learn_wrong_file_type", data)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+	}
+	b.states.ClearState(msg.From.ID)
+	return b.sendSubscriberDirectory(ctx, msg.Chat.ID, 0, lang, state.ChannelID, 1, query)
+}
+
+// sendSubscriberDirectory menampilkan satu halaman direktori subscriber.
+// messageID 0 berarti kirim sebagai pesan baru.
+func (b *Bot) sendSubscriberDirectory(ctx context.Context, chatID int64, messageID int, lang string, channelID int64, page int, query string) error {
+	b.flushActivity(ctx)
+
+	if page < 1 {
+		page = 1
+	}
+	// Ambil satu subscriber lebih banyak untuk mengetahui apakah ada halaman berikutnya
+	subscribers, err := b.store.SearchSubscribers(ctx, channelID, query, (page-1)*directoryPageSize, directoryPageSize+1)
+	if err != nil {
+		log.Printf("error getting subscribers for channel %d: %v", channelID, err)
+		return err
+	}
+	hasNext := len(subscribers) > directoryPageSize
+	if hasNext {
+		subscribers = subscribers[:directoryPageSize]
+	}
+
+	var textBuilder strings.Builder
+	textBuilder.WriteString(i18n.GetMessage(lang, "subscribers_title", struct {
+		ChannelTitle string
+		Page         int
+		Query        string
+	}{b.channelTitle(ctx, channelID), page, query}))
+	textBuilder.WriteString("\n\n")
+	if len(subscribers) == 0 {
+		textBuilder.WriteString(i18n.GetMessage(lang, "subscribers_empty", nil))
+	}
+
+	var keyboard [][]InlineKeyboardButton
+	var row []InlineKeyboardButton
+	for i, sub := range subscribers {
+		number := (page-1)*directoryPageSize + i + 1
+		textBuilder.WriteString(i18n.GetMessage(lang, "subscribers_entry", struct {
+			Number   int
+			Name     string
+			Messages int
+			LastSeen string
+			Tags     string
+		}{number, subscriberName(sub), sub.MessageCount, sub.LastSeen.Format("2006-01-02"), formatTags(sub.Tags)}))
+		textBuilder.WriteString("\n")
+
+		row = append(row, InlineKeyboardButton{Text: fmt.Sprintf("👤 #%d", number), CallbackData: b.callbackData("sub_view", callbackParams{ChannelID: channelID, UserID: sub.UserID, Page: page, Value: query})})
+		if len(row) == 4 {
+			keyboard = append(keyboard, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		keyboard = append(keyboard, row)
+	}
+
+	var navRow []InlineKeyboardButton
+	if page > 1 {
+		navRow = append(navRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "prev_button", nil), CallbackData: b.callbackData("subs", callbackParams{ChannelID: channelID, Page: page - 1, Value: query})})
+	}
+	if hasNext {
+		navRow = append(navRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "next_button", nil), CallbackData: b.callbackData("subs", callbackParams{ChannelID: channelID, Page: page + 1, Value: query})})
+	}
+	if len(navRow) > 0 {
+		keyboard = append(keyboard, navRow)
+	}
+
+	searchRow := []InlineKeyboardButton{
+		{Text: i18n.GetMessage(lang, "subscribers_search_button", nil), CallbackData: b.callbackData("subs_search", callbackParams{ChannelID: channelID})},
+	}
+	if query != "" {
+		searchRow = append(searchRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "subscribers_clear_search_button", nil), CallbackData: b.callbackData("subs", callbackParams{ChannelID: channelID, Page: 1})})
+	}
+	keyboard = append(keyboard, searchRow, []InlineKeyboardButton{
+		{Text: i18n.GetMessage(lang, "back_to_manage_button", nil), CallbackData: b.callbackData("manage", callbackParams{ChannelID: channelID, Page: 1})},
+	})
+
+	return b.sendPlainText(ctx, chatID, messageID, textBuilder.String(), &InlineKeyboardMarkup{InlineKeyboard: keyboard})
+}
+
+func (b *Bot) handleSubscriberViewCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	return b.sendSubscriberProfile(ctx, cb.Message.Chat.ID, cb.Message.ID, lang, p.ChannelID, p.UserID, p.Page, p.Value)
+}
+
+// sendSubscriberProfile menampilkan detail satu subscriber beserta catatan dan tag-nya.
+func (b *Bot) sendSubscriberProfile(ctx context.Context, chatID int64, messageID int, lang string, channelID, userID int64, page int, query string) error {
+	sub, found, err := b.store.GetSubscriber(ctx, channelID, userID)
+	if err != nil {
+		log.Printf("error getting subscriber %d of channel %d: %v", userID, channelID, err)
+		return err
+	}
+	if !found {
+		return b.sendSubscriberDirectory(ctx, chatID, messageID, lang, channelID, page, query)
+	}
+
+	username := "-"
+	if sub.Username != "" {
+		username = "@" + sub.Username
+	}
+	notes := sub.Notes
+	if notes == "" {
+		notes = "-"
+	}
+	blocked := b.isBlocked(ctx, channelID, sub.UserID)
+	text := i18n.GetMessage(lang, "subscriber_profile", struct {
+		Name      string
+		Username  string
+		UserID    int64
+		Lang      string
+		FirstSeen string
+		LastSeen  string
+		Messages  int
+		Blocked   bool
+		Tags      string
+		Notes     string
+	}{
+		Name:      sub.FirstName,
+		Username:  username,
+		UserID:    sub.UserID,
+		Lang:      sub.LangCode,
+		FirstSeen: sub.FirstSeen.Format("2006-01-02 15:04"),
+		LastSeen:  sub.LastSeen.Format("2006-01-02 15:04"),
+		Messages:  sub.MessageCount,
+		Blocked:   blocked,
+		Tags:      formatTags(sub.Tags),
+		Notes:     notes,
+	})
+
+	params := callbackParams{ChannelID: channelID, UserID: sub.UserID, Page: page, Value: query}
+	keyboard := [][]InlineKeyboardButton{{
+		{Text: i18n.GetMessage(lang, "subscriber_note_button", nil), CallbackData: b.callbackData("sub_note", params)},
+		{Text: i18n.GetMessage(lang, "subscriber_tags_button", nil), CallbackData: b.callbackData("sub_tags", params)},
+	}}
+	if !blocked {
+		keyboard = append(keyboard, []InlineKeyboardButton{
+			{Text: i18n.GetMessage(lang, "block_button", nil), CallbackData: b.callbackData("block_user", callbackParams{ChannelID: channelID, UserID: sub.UserID, Value: subscriberName(sub)})},
+		})
+	}
+	keyboard = append(keyboard, []InlineKeyboardButton{
+		{Text: i18n.GetMessage(lang, "subscribers_back_button", nil), CallbackData: b.callbackData("subs", callbackParams{ChannelID: channelID, Page: page, Value: query})},
+	})
+
+	markup := &InlineKeyboardMarkup{InlineKeyboard: keyboard}
+	if messageID == 0 {
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: chatID, Text: text, ReplyMarkup: markup})
+	}
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: chatID, MessageID: messageID, Text: text, ReplyMarkup: markup})
+}
+
+func (b *Bot) handleSubscriberNoteCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	return b.promptSubscriberField(ctx, cb, lang, p, "awaiting_subscriber_note", "subscriber_awaiting_note")
+}
+
+func (b *Bot) handleSubscriberTagsCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	return b.promptSubscriberField(ctx, cb, lang, p, "awaiting_subscriber_tags", "subscriber_awaiting_tags")
+}
+
+func (b *Bot) promptSubscriberField(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams, step, promptKey string) error {
+	b.states.SetState(cb.From.ID, &UserState{Step: step, ChannelID: p.ChannelID, SubscriberID: p.UserID, Query: p.Value})
+	text := i18n.GetMessage(lang, promptKey, nil)
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: cb.Message.Chat.ID, MessageID: cb.Message.ID, Text: text})
+}
+
+func (b *Bot) handleSubscriberNoteMessage(ctx context.Context, msg *Message, state *UserState, lang string) error {
+	notes := strings.TrimSpace(msg.Text)
+	if notes == clearFieldInput {
+		notes = ""
+	}
+	if err := b.store.SetSubscriberNotes(ctx, state.ChannelID, state.SubscriberID, notes); err != nil {
+		log.Printf("failed to save notes for subscriber %d of channel %d: %v", state.SubscriberID, state.ChannelID, err)
+		b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: "An error occurred."})
+		return err
+	}
+	b.states.ClearState(msg.From.ID)
+	return b.sendSubscriberProfile(ctx, msg.Chat.ID, 0, lang, state.ChannelID, state.SubscriberID, 1, state.Query)
+}
+
+func (b *Bot) handleSubscriberTagsMessage(ctx context.Context, msg *Message, state *UserState, lang string) error {
+	var tags []string
+	if strings.TrimSpace(msg.Text) != clearFieldInput {
+		tags = parseTags(msg.Text)
+	}
+	if err := b.store.SetSubscriberTags(ctx, state.ChannelID, state.SubscriberID, tags); err != nil {
+		log.Printf("failed to save tags for subscriber %d of channel %d: %v", state.SubscriberID, state.ChannelID, err)
+		b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: "An error occurred."})
+		return err
+	}
+	b.states.ClearState(msg.From.ID)
+	return b.sendSubscriberProfile(ctx, msg.Chat.ID, 0, lang, state.ChannelID, state.SubscriberID, 1, state.Query)
+}
+
+// parseTags memisahkan tag dengan spasi atau koma, membuang "#" dan duplikat,
+// dan menyimpannya dalam huruf kecil agar pencarian "#tag" konsisten.
+func parseTags(text string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' }) {
+		tag := strings.ToLower(strings.TrimLeft(field, "#"))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return "#" + strings.Join(tags, " #")
+}
+
+func subscriberName(sub storage.Subscriber) string {
+	return userLabel(User{FirstName: sub.FirstName, Username: sub.Username})
+}
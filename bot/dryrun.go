@@ -0,0 +1,97 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+// handleTestCommand menjalankan pipeline balasan otomatis tanpa mengirim apa pun
+// ke subscriber: balasan dikirim ke admin, diikuti penjelasan hasil pencocokan.
+// Format: /test <@channel|chat_id> <pesan>
+func (b *Bot) handleTestCommand(ctx context.Context, msg *Message, lang string) error {
+	parts := strings.SplitN(msg.Text, " ", 3)
+	if len(parts) < 3 || strings.TrimSpace(parts[2]) == "" {
+		text := i18n.GetMessage(lang, "test_usage", nil)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text, ParseMode: "Markdown"})
+	}
+
+	chatIdentifier, ok := parseChatIdentifier(parts[1])
+	if !ok {
+		text := i18n.GetMessage(lang, "test_usage", nil)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text, ParseMode: "Markdown"})
+	}
+
+	channelInfo, err := b.api.GetChat(ctx, chatIdentifier)
+	if err != nil {
+		log.Printf("test failed for %v: could not get chat info: %v", chatIdentifier, err)
+		text := i18n.GetMessage(lang, "register_fail", nil)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+	}
+
+	if !b.authorize(ctx, channelInfo.ID, msg.From.ID, storage.RoleViewer) {
+		text := i18n.GetMessage(lang, "unauthorized", nil)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+	}
+
+	settings, err := b.store.GetChannelSettings(ctx, channelInfo.ID)
+	if err != nil {
+		log.Printf("could not load settings for channel %d, using defaults: %v", channelInfo.ID, err)
+	}
+
+	testMessage := parts[2]
+	match, err := b.matchTrigger(ctx, settings, testMessage)
+	if err != nil {
+		log.Printf("test failed for channel %d: %v", channelInfo.ID, err)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: "An error occurred."})
+	}
+
+	explanation := struct {
+		ChannelTitle string
+		Message      string
+		Normalized   string
+		Trigger      string
+		Mode         string
+		ResponseType string
+		Cooldown     string
+		Schedule     string
+		AutoReplyOff bool
+		Fallback     bool
+	}{
+		ChannelTitle: channelInfo.Title,
+		Message:      testMessage,
+		Normalized:   match.Normalized,
+		Mode:         i18n.GetMessage(lang, "test_mode_"+match.Mode, nil),
+		Cooldown:     i18n.GetMessage(lang, "test_cooldown_none", nil),
+		Schedule:     i18n.GetMessage(lang, "test_schedule_always", nil),
+		AutoReplyOff: !settings.AutoReply,
+		Fallback:     settings.FallbackReply != "",
+	}
+
+	if !match.Found {
+		if settings.AutoReply && settings.FallbackReply != "" {
+			fallback := storage.TriggerRecord{ResponseType: "text", ResponseText: settings.FallbackReply}
+			if err := b.sendTriggerResponse(ctx, msg.Chat.ID, 0, fallback, msg.From, settings.ParseMode); err != nil {
+				log.Printf("test failed to send fallback preview: %v", err)
+			}
+		}
+		text := i18n.GetMessage(lang, "test_result_no_match", explanation)
+		return b.sendPlainText(ctx, msg.Chat.ID, 0, text, nil)
+	}
+
+	explanation.Trigger = match.Record.TriggerText
+	explanation.ResponseType = match.Record.ResponseType
+
+	// Kirim balasan persis seperti yang akan diterima subscriber, tapi ke chat admin
+	if settings.AutoReply {
+		if err := b.sendTriggerResponse(ctx, msg.Chat.ID, 0, match.Record, msg.From, settings.ParseMode); err != nil {
+			log.Printf("test failed to send preview for trigger '%s': %v", match.Record.TriggerText, err)
+		}
+	}
+
+	text := i18n.GetMessage(lang, "test_result_match", explanation)
+	return b.sendPlainText(ctx, msg.Chat.ID, 0, text, nil)
+}
@@ -0,0 +1,106 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIError adalah jawaban ok=false dari Bot API Telegram.
+type APIError struct {
+	Method          string
+	ErrorCode       int
+	Description     string
+	RetryAfter      time.Duration // diisi pada 429 Too Many Requests
+	MigrateToChatID int64         // diisi jika grup sudah dipindah ke supergroup
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("telegram API error on %s (%d): %s", e.Method, e.ErrorCode, e.Description)
+}
+
+// newAPIError membaca jawaban gagal Telegram. Body yang bukan JSON (misalnya
+// halaman error dari proxy) disimpan apa adanya sebagai Description.
+func newAPIError(method string, statusCode int, body []byte) *APIError {
+	apiErr := &APIError{Method: method, ErrorCode: statusCode}
+	var apiResp ApiResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil || apiResp.Description == "" {
+		apiErr.Description = strings.TrimSpace(string(body))
+		return apiErr
+	}
+	if apiResp.ErrorCode != 0 {
+		apiErr.ErrorCode = apiResp.ErrorCode
+	}
+	apiErr.Description = apiResp.Description
+	if apiResp.Parameters != nil {
+		apiErr.RetryAfter = time.Duration(apiResp.Parameters.RetryAfter) * time.Second
+		apiErr.MigrateToChatID = apiResp.Parameters.MigrateToChatID
+	}
+	return apiErr
+}
+
+func asAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+func hasDescription(err error, code int, text string) bool {
+	apiErr, ok := asAPIError(err)
+	return ok && apiErr.ErrorCode == code && strings.Contains(strings.ToLower(apiErr.Description), text)
+}
+
+// IsForbidden berarti bot tidak boleh lagi mengakses chat: dikeluarkan dari
+// channel atau diblokir oleh user.
+func IsForbidden(err error) bool {
+	apiErr, ok := asAPIError(err)
+	return ok && apiErr.ErrorCode == http.StatusForbidden
+}
+
+// IsUnauthorized berarti token bot ditolak (401), misalnya karena dicabut lewat
+// BotFather, atau tidak dikenali sama sekali (404).
+func IsUnauthorized(err error) bool {
+	apiErr, ok := asAPIError(err)
+	return ok && (apiErr.ErrorCode == http.StatusUnauthorized || apiErr.ErrorCode == http.StatusNotFound)
+}
+
+// IsConflict berarti getUpdates bentrok dengan instance lain atau webhook aktif.
+func IsConflict(err error) bool {
+	apiErr, ok := asAPIError(err)
+	return ok && apiErr.ErrorCode == http.StatusConflict
+}
+
+// IsWebhookConflict berarti getUpdates ditolak karena webhook masih terdaftar.
+func IsWebhookConflict(err error) bool {
+	return hasDescription(err, http.StatusConflict, "webhook")
+}
+
+// IsChatNotFound berarti chat tidak ada atau bot tidak pernah menjadi anggotanya.
+func IsChatNotFound(err error) bool {
+	return hasDescription(err, http.StatusBadRequest, "chat not found")
+}
+
+// IsMessageNotModified berarti editMessageText dipanggil dengan isi yang sama persis.
+func IsMessageNotModified(err error) bool {
+	return hasDescription(err, http.StatusBadRequest, "message is not modified")
+}
+
+// IsTooManyRequests berarti bot terkena batas kecepatan; lihat APIError.RetryAfter.
+func IsTooManyRequests(err error) bool {
+	apiErr, ok := asAPIError(err)
+	return ok && apiErr.ErrorCode == http.StatusTooManyRequests
+}
+
+// MigratedChatID mengembalikan ID supergroup baru jika chat sudah dipindah.
+func MigratedChatID(err error) (int64, bool) {
+	apiErr, ok := asAPIError(err)
+	if !ok || apiErr.MigrateToChatID == 0 {
+		return 0, false
+	}
+	return apiErr.MigrateToChatID, true
+}
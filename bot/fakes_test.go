@@ -0,0 +1,506 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"telegram-dm-bot/config"
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+func TestMain(m *testing.M) {
+	if err := i18n.LoadTranslations("../locales"); err != nil {
+		log.Fatalf("could not load translations: %v", err)
+	}
+	os.Exit(m.Run())
+}
+
+// sentCall adalah satu panggilan ke Bot API yang dicatat fakeClient.
+type sentCall struct {
+	Method  string
+	Payload interface{}
+}
+
+// fakeClient adalah TelegramClient di memori. Semua panggilan dicatat di
+// calls; jawaban getChat dan getChatAdministrators serta error per method
+// bisa diatur sebelum test dijalankan.
+type fakeClient struct {
+	mu     sync.Mutex
+	calls  []sentCall
+	me     User
+	chats  map[interface{}]*GetChatResponse
+	admins map[int64][]ChatMember
+	errs   map[string]error
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		me:     User{ID: 1, IsBot: true, Username: "test_bot"},
+		chats:  make(map[interface{}]*GetChatResponse),
+		admins: make(map[int64][]ChatMember),
+		errs:   make(map[string]error),
+	}
+}
+
+func (f *fakeClient) record(method string, payload interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, sentCall{Method: method, Payload: payload})
+	return f.errs[method]
+}
+
+// sent mengembalikan semua panggilan method yang tercatat, berurutan.
+func (f *fakeClient) sent(method string) []sentCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []sentCall
+	for _, call := range f.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// lastMessage mengembalikan payload sendMessage terakhir.
+func (f *fakeClient) lastMessage(t *testing.T) SendMessagePayload {
+	t.Helper()
+	calls := f.sent("sendMessage")
+	if len(calls) == 0 {
+		t.Fatal("no message was sent")
+	}
+	return calls[len(calls)-1].Payload.(SendMessagePayload)
+}
+
+// lastEdit mengembalikan payload editMessageText terakhir.
+func (f *fakeClient) lastEdit(t *testing.T) EditMessageTextPayload {
+	t.Helper()
+	calls := f.sent("editMessageText")
+	if len(calls) == 0 {
+		t.Fatal("no message was edited")
+	}
+	return calls[len(calls)-1].Payload.(EditMessageTextPayload)
+}
+
+func (f *fakeClient) SendMessage(ctx context.Context, payload SendMessagePayload) error {
+	return f.record("sendMessage", payload)
+}
+
+func (f *fakeClient) SendSticker(ctx context.Context, payload SendStickerPayload) error {
+	return f.record("sendSticker", payload)
+}
+
+func (f *fakeClient) SendDocument(ctx context.Context, payload SendDocumentPayload) error {
+	return f.record("sendDocument", payload)
+}
+
+func (f *fakeClient) SendAnimation(ctx context.Context, payload SendAnimationPayload) error {
+	return f.record("sendAnimation", payload)
+}
+
+func (f *fakeClient) SendAudio(ctx context.Context, payload SendAudioPayload) error {
+	return f.record("sendAudio", payload)
+}
+
+func (f *fakeClient) SendPhoto(ctx context.Context, payload SendPhotoPayload) error {
+	return f.record("sendPhoto", payload)
+}
+
+func (f *fakeClient) SendDocumentFile(ctx context.Context, chatID int64, filename string, content []byte, caption string) error {
+	return f.record("sendDocument", SendDocumentPayload{ChatID: chatID, Document: filename, Caption: caption})
+}
+
+func (f *fakeClient) EditMessageText(ctx context.Context, payload EditMessageTextPayload) error {
+	return f.record("editMessageText", payload)
+}
+
+func (f *fakeClient) AnswerCallbackQuery(ctx context.Context, payload AnswerCallbackQueryPayload) error {
+	return f.record("answerCallbackQuery", payload)
+}
+
+func (f *fakeClient) SetWebhook(ctx context.Context, payload SetWebhookPayload) error {
+	return f.record("setWebhook", payload)
+}
+
+func (f *fakeClient) DeleteWebhook(ctx context.Context, payload DeleteWebhookPayload) error {
+	return f.record("deleteWebhook", payload)
+}
+
+func (f *fakeClient) GetUpdates(ctx context.Context, offset int) ([]Update, error) {
+	if err := f.record("getUpdates", offset); err != nil {
+		return nil, err
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (f *fakeClient) GetChatAdministrators(ctx context.Context, chatID int64) ([]ChatMember, error) {
+	if err := f.record("getChatAdministrators", chatID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.admins[chatID], nil
+}
+
+func (f *fakeClient) GetChat(ctx context.Context, chatID interface{}) (*GetChatResponse, error) {
+	if err := f.record("getChat", chatID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	chat, found := f.chats[chatID]
+	if !found {
+		return nil, &APIError{Method: "getChat", ErrorCode: 400, Description: "Bad Request: chat not found"}
+	}
+	return chat, nil
+}
+
+func (f *fakeClient) GetMe(ctx context.Context) (*User, error) {
+	if err := f.record("getMe", nil); err != nil {
+		return nil, err
+	}
+	me := f.me
+	return &me, nil
+}
+
+func (f *fakeClient) QueueDepth() int { return 0 }
+
+func (f *fakeClient) Close() {}
+
+// fakeStorage menyimpan data di memori untuk method yang dipakai handler yang
+// diuji. Method lain jatuh ke Storage yang nil dan akan panic, sehingga
+// pemakaian yang tidak terduga langsung terlihat.
+type fakeStorage struct {
+	storage.Storage
+
+	mu        sync.Mutex
+	langs     map[int64]string
+	channels  map[int64]storage.RegisteredChannel
+	roles     []storage.ChannelRole
+	triggers  map[int64]map[string]storage.TriggerRecord
+	settings  map[int64]storage.ChannelSettings
+	blocked   map[int64][]storage.BlockedUser
+	audit     []storage.AuditEvent
+	revisions []storage.TriggerRevision
+	processed map[int]bool
+	callbacks map[string]storage.CallbackToken
+	invites   map[string]storage.ChannelInvite
+	digests   map[int64]time.Time
+	nextID    int64
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		langs:     make(map[int64]string),
+		channels:  make(map[int64]storage.RegisteredChannel),
+		triggers:  make(map[int64]map[string]storage.TriggerRecord),
+		settings:  make(map[int64]storage.ChannelSettings),
+		blocked:   make(map[int64][]storage.BlockedUser),
+		processed: make(map[int]bool),
+		callbacks: make(map[string]storage.CallbackToken),
+		invites:   make(map[string]storage.ChannelInvite),
+		digests:   make(map[int64]time.Time),
+	}
+}
+
+func (s *fakeStorage) GetUserLanguage(ctx context.Context, userID int64) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lang, found := s.langs[userID]
+	return lang, found, nil
+}
+
+func (s *fakeStorage) RegisterChannel(ctx context.Context, channelID int64, title string, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channels[channelID] = storage.RegisteredChannel{ChannelID: channelID, Title: title, OwnerID: userID}
+	return nil
+}
+
+func (s *fakeStorage) GetRegisteredChannels(ctx context.Context) ([]storage.RegisteredChannel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var channels []storage.RegisteredChannel
+	for _, ch := range s.channels {
+		channels = append(channels, ch)
+	}
+	return channels, nil
+}
+
+func (s *fakeStorage) IsChannelRegistered(ctx context.Context, channelID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, found := s.channels[channelID]
+	return found, nil
+}
+
+func (s *fakeStorage) GetRegisteredChannel(ctx context.Context, channelID int64) (storage.RegisteredChannel, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch, found := s.channels[channelID]
+	return ch, found, nil
+}
+
+func (s *fakeStorage) UnregisterChannel(ctx context.Context, channelID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.channels, channelID)
+	return nil
+}
+
+func (s *fakeStorage) GetChannelRole(ctx context.Context, channelID, userID int64) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.roles {
+		if r.ChannelID == channelID && r.UserID == userID {
+			return r.Role, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (s *fakeStorage) GetUserChannelRoles(ctx context.Context, userID int64) ([]storage.ChannelRole, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var roles []storage.ChannelRole
+	for _, r := range s.roles {
+		if r.UserID == userID {
+			roles = append(roles, r)
+		}
+	}
+	return roles, nil
+}
+
+func (s *fakeStorage) GetChannelRoles(ctx context.Context, channelID int64) ([]storage.ChannelRole, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var roles []storage.ChannelRole
+	for _, r := range s.roles {
+		if r.ChannelID == channelID {
+			roles = append(roles, r)
+		}
+	}
+	return roles, nil
+}
+
+func (s *fakeStorage) SetChannelRole(ctx context.Context, role storage.ChannelRole) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.roles {
+		if r.ChannelID == role.ChannelID && r.UserID == role.UserID {
+			s.roles[i] = role
+			return nil
+		}
+	}
+	s.roles = append(s.roles, role)
+	return nil
+}
+
+func (s *fakeStorage) RemoveChannelRole(ctx context.Context, channelID, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var kept []storage.ChannelRole
+	for _, r := range s.roles {
+		if r.ChannelID != channelID || r.UserID != userID {
+			kept = append(kept, r)
+		}
+	}
+	s.roles = kept
+	return nil
+}
+
+func (s *fakeStorage) CreateInvite(ctx context.Context, invite storage.ChannelInvite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invites[invite.Token] = invite
+	return nil
+}
+
+func (s *fakeStorage) ConsumeInvite(ctx context.Context, token string, userID int64) (storage.ChannelInvite, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invite, found := s.invites[token]
+	if !found || invite.UsedBy != 0 {
+		return storage.ChannelInvite{}, false, nil
+	}
+	invite.UsedBy = userID
+	s.invites[token] = invite
+	return invite, true, nil
+}
+
+// Statistik digest selalu kosong di fake; test digest hanya memeriksa penerima.
+func (s *fakeStorage) GetChannelActivity(ctx context.Context, channelID int64, from, to time.Time) ([]storage.ChannelActivity, error) {
+	return nil, nil
+}
+
+func (s *fakeStorage) CountNewSubscribers(ctx context.Context, channelID int64, from, to time.Time) (int, error) {
+	return 0, nil
+}
+
+func (s *fakeStorage) MarkDigestSent(ctx context.Context, channelID int64, scheduledAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, found := s.digests[channelID]; found && !last.Before(scheduledAt) {
+		return false, nil
+	}
+	s.digests[channelID] = scheduledAt
+	return true, nil
+}
+
+func (s *fakeStorage) GetTriggerHits(ctx context.Context, channelID int64, since time.Time) ([]storage.TriggerHitCount, error) {
+	return nil, nil
+}
+
+func (s *fakeStorage) AddAuditEvent(ctx context.Context, event storage.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = append(s.audit, event)
+	return nil
+}
+
+func (s *fakeStorage) Set(ctx context.Context, record storage.TriggerRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record.TriggerText = strings.ToLower(record.TriggerText)
+	if s.triggers[record.ChannelID] == nil {
+		s.triggers[record.ChannelID] = make(map[string]storage.TriggerRecord)
+	}
+	if existing, found := s.triggers[record.ChannelID][record.TriggerText]; found {
+		record.ID = existing.ID
+	} else {
+		s.nextID++
+		record.ID = s.nextID
+	}
+	s.triggers[record.ChannelID][record.TriggerText] = record
+	return nil
+}
+
+func (s *fakeStorage) Get(ctx context.Context, channelID int64, trigger string) (storage.TriggerRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, found := s.triggers[channelID][trigger]
+	return record, found, nil
+}
+
+func (s *fakeStorage) GetTriggersByChannel(ctx context.Context, channelID int64) ([]storage.TriggerRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var records []storage.TriggerRecord
+	for _, record := range s.triggers[channelID] {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (s *fakeStorage) AddTriggerRevision(ctx context.Context, rev storage.TriggerRevision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rev.TriggerText = strings.ToLower(rev.TriggerText)
+	s.revisions = append(s.revisions, rev)
+	return nil
+}
+
+func (s *fakeStorage) GetTriggerRevisions(ctx context.Context, channelID int64, trigger string, limit int) ([]storage.TriggerRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var revs []storage.TriggerRevision
+	for i := len(s.revisions) - 1; i >= 0 && len(revs) < limit; i-- {
+		if rev := s.revisions[i]; rev.ChannelID == channelID && rev.TriggerText == strings.ToLower(trigger) {
+			revs = append(revs, rev)
+		}
+	}
+	return revs, nil
+}
+
+func (s *fakeStorage) DeleteUnansweredQuery(ctx context.Context, channelID int64, normalized string) error {
+	return nil
+}
+
+func (s *fakeStorage) GetChannelSettings(ctx context.Context, channelID int64) (storage.ChannelSettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if settings, found := s.settings[channelID]; found {
+		return settings, nil
+	}
+	return storage.DefaultChannelSettings(channelID), nil
+}
+
+func (s *fakeStorage) GetBlockedUsers(ctx context.Context, channelID int64) ([]storage.BlockedUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blocked[channelID], nil
+}
+
+func (s *fakeStorage) ClaimUpdate(ctx context.Context, updateID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.processed[updateID] {
+		return false, nil
+	}
+	s.processed[updateID] = true
+	return true, nil
+}
+
+func (s *fakeStorage) ReleaseUpdate(ctx context.Context, updateID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.processed, updateID)
+	return nil
+}
+
+func (s *fakeStorage) SaveCallbackTokens(ctx context.Context, tokens []storage.CallbackToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range tokens {
+		s.callbacks[token.Token] = token
+	}
+	return nil
+}
+
+func (s *fakeStorage) GetCallbackToken(ctx context.Context, token string) (storage.CallbackToken, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, found := s.callbacks[token]
+	return stored, found, nil
+}
+
+// newTestBot membuat bot yang memakai client dan storage palsu.
+func newTestBot(t *testing.T) (*Bot, *fakeClient, *fakeStorage) {
+	t.Helper()
+	client := newFakeClient()
+	store := newFakeStorage()
+	cfg := &config.Config{UpdateMode: config.UpdateModePolling, WorkerCount: 1, UpdateQueueLength: 1}
+	b := NewBotWithClient(context.Background(), cfg, store, client)
+	if b.botUsername != client.me.Username {
+		t.Fatalf("botUsername = %q, want %q", b.botUsername, client.me.Username)
+	}
+	return b, client, store
+}
+
+// textUpdate membuat update berisi pesan teks dari user ke chat privatnya.
+func textUpdate(id int, userID int64, text string) Update {
+	return Update{ID: id, Message: &Message{
+		ID:   id,
+		From: User{ID: userID, FirstName: "Tester", LangCode: "en"},
+		Chat: Chat{ID: userID, Type: "private"},
+		Text: text,
+	}}
+}
+
+// callbackUpdate membuat update klik tombol dengan callback_data data.
+func callbackUpdate(id int, userID int64, data string) Update {
+	return Update{ID: id, CallbackQuery: &CallbackQuery{
+		ID:      fmt.Sprintf("cb%d", id),
+		From:    User{ID: userID, FirstName: "Tester", LangCode: "en"},
+		Message: &Message{ID: 100, Chat: Chat{ID: userID, Type: "private"}},
+		Data:    data,
+	}}
+}
@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"telegram-dm-bot/i18n"
+)
+
+const (
+	// Lebih dari floodMaxMessages pesan dalam floodWindow dianggap banjir pesan
+	floodWindow      = 10 * time.Second
+	floodMaxMessages = 8
+
+	// Pesan yang sama atau pesan berisi link yang berulang dalam floodSpamWindow dianggap spam
+	floodSpamWindow  = time.Minute
+	floodRepeatLimit = 4
+	floodLinkLimit   = 3
+
+	floodMuteDuration = 5 * time.Minute
+	floodSweepEvery   = 5 * time.Minute
+)
+
+const (
+	floodReasonFlood  = "flood"
+	floodReasonRepeat = "repeat"
+	floodReasonLinks  = "links"
+)
+
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.|t\.me/|telegram\.me/|\b[a-z0-9-]+\.(com|net|org|io|me|ru|xyz|info|biz|top|click|link)\b)`)
+
+type floodKey struct {
+	ChatID int64
+	UserID int64
+}
+
+type floodMessage struct {
+	At      time.Time
+	Text    string
+	HasLink bool
+}
+
+type floodState struct {
+	messages   []floodMessage
+	mutedUntil time.Time
+}
+
+// FloodDetector melacak pesan terakhir setiap user per channel dengan sliding
+// window dan membisukan balasan otomatis untuk user yang membanjiri atau spam.
+type FloodDetector struct {
+	mu        sync.Mutex
+	users     map[floodKey]*floodState
+	lastSweep time.Time
+}
+
+func NewFloodDetector() *FloodDetector {
+	return &FloodDetector{users: make(map[floodKey]*floodState), lastSweep: time.Now()}
+}
+
+// Check mencatat satu pesan dan melaporkan apakah user sedang dibisukan.
+// chatID adalah chat DM channel, yang selalu sama untuk satu channel, sehingga
+// bisa diperiksa sebelum channel induknya diketahui. reason hanya diisi pada
+// pesan yang memicu pembisuan, agar admin cukup diberi tahu sekali.
+func (f *FloodDetector) Check(chatID, userID int64, text string, at time.Time) (muted bool, reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if at.Sub(f.lastSweep) > floodSweepEvery {
+		f.sweep(at)
+	}
+
+	key := floodKey{chatID, userID}
+	state, found := f.users[key]
+	if !found {
+		state = &floodState{}
+		f.users[key] = state
+	}
+	if at.Before(state.mutedUntil) {
+		return true, ""
+	}
+
+	// Buang pesan yang sudah keluar dari jendela terpanjang
+	kept := state.messages[:0]
+	for _, m := range state.messages {
+		if at.Sub(m.At) < floodSpamWindow {
+			kept = append(kept, m)
+		}
+	}
+	normalized := normalizeUnanswered(text)
+	state.messages = append(kept, floodMessage{At: at, Text: normalized, HasLink: linkPattern.MatchString(text)})
+
+	var recent, repeats, links int
+	for _, m := range state.messages {
+		if at.Sub(m.At) < floodWindow {
+			recent++
+		}
+		if normalized != "" && m.Text == normalized {
+			repeats++
+		}
+		if m.HasLink {
+			links++
+		}
+	}
+
+	switch {
+	case recent > floodMaxMessages:
+		reason = floodReasonFlood
+	case repeats >= floodRepeatLimit:
+		reason = floodReasonRepeat
+	case links >= floodLinkLimit:
+		reason = floodReasonLinks
+	default:
+		return false, ""
+	}
+	state.mutedUntil = at.Add(floodMuteDuration)
+	state.messages = nil
+	return true, reason
+}
+
+func (f *FloodDetector) sweep(now time.Time) {
+	for key, state := range f.users {
+		idle := len(state.messages) == 0 || now.Sub(state.messages[len(state.messages)-1].At) >= floodSpamWindow
+		if idle && !now.Before(state.mutedUntil) {
+			delete(f.users, key)
+		}
+	}
+	f.lastSweep = now
+}
+
+// notifyAdminsAbuse memberi tahu admin channel bahwa seorang user dibisukan
+// sementara, dengan tombol untuk memblokirnya permanen.
+func (b *Bot) notifyAdminsAbuse(ctx context.Context, channelID int64, msg *Message, reason string) {
+	admins, err := b.channelAdministrators(ctx, channelID)
+	if err != nil {
+		log.Printf("could not get admins to notify for channel %d: %v", channelID, err)
+		return
+	}
+
+	title := b.channelTitle(ctx, channelID)
+	for _, admin := range admins {
+		if admin.User.IsBot {
+			continue
+		}
+		adminLang := b.getUserLang(ctx, admin.User.ID, admin.User.LangCode)
+		data := struct {
+			ChannelTitle string
+			User         string
+			Reason       string
+			Minutes      int
+			Text         string
+		}{
+			ChannelTitle: title,
+			User:         blockedTarget(msg.From.ID, userLabel(msg.From)),
+			Reason:       i18n.GetMessage(adminLang, "flood_reason_"+reason, nil),
+			Minutes:      int(floodMuteDuration / time.Minute),
+			Text:         msg.Text,
+		}
+		text := i18n.GetMessage(adminLang, "flood_notification", data)
+		keyboard := InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{{
+			{Text: i18n.GetMessage(adminLang, "block_button", nil), CallbackData: b.callbackData("block_user", callbackParams{ChannelID: channelID, UserID: msg.From.ID, Value: userLabel(msg.From)})},
+		}}}
+		if err := b.api.SendMessage(ctx, SendMessagePayload{ChatID: admin.User.ID, Text: text, ReplyMarkup: &keyboard}); err != nil {
+			log.Printf("could not notify admin %d about suspected abuse: %v", admin.User.ID, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"context"
+	"log"
+
+	"telegram-dm-bot/storage"
+)
+
+// accessCheck adalah satu syarat akses yang harus dipenuhi sebelum sebuah
+// callback atau langkah sesi dijalankan. Jika TriggerID atau RevisionID diisi,
+// objek tersebut juga harus benar-benar milik ChannelID.
+type accessCheck struct {
+	ChannelID  int64
+	TriggerID  int64
+	RevisionID int64
+	Required   string
+}
+
+// guardCallback adalah pemeriksaan hak akses terpusat untuk semua callback.
+// Syaratnya diambil dari parameter bertipe milik rute, bukan dari teks
+// callback_data; rute tanpa Access (bantuan, bahasa, dll.) selalu lolos.
+func (b *Bot) guardCallback(ctx context.Context, cb *CallbackQuery, route callbackRoute, params callbackParams) bool {
+	if route.Access == nil {
+		return true
+	}
+	return b.checkAccess(ctx, cb.From.ID, route.Access(cb.From.ID, params))
+}
+
+// guardSession memeriksa ulang hak akses setiap kali pesan lanjutan sesi masuk,
+// karena peran user bisa berubah di tengah sesi.
+func (b *Bot) guardSession(ctx context.Context, userID int64, state *UserState) bool {
+	if state.ChannelID == 0 {
+		return true
+	}
+	return b.checkAccess(ctx, userID, []accessCheck{{ChannelID: state.ChannelID, Required: storage.RoleEditor}})
+}
+
+func (b *Bot) checkAccess(ctx context.Context, userID int64, checks []accessCheck) bool {
+	for _, check := range checks {
+		if check.TriggerID != 0 {
+			record, found, err := b.store.GetTriggerByID(ctx, check.TriggerID)
+			if err != nil || !found {
+				log.Printf("access check failed: trigger %d not found (err: %v)", check.TriggerID, err)
+				return false
+			}
+			if check.ChannelID == 0 {
+				check.ChannelID = record.ChannelID
+			} else if record.ChannelID != check.ChannelID {
+				log.Printf("access check failed: trigger %d belongs to channel %d, not %d", check.TriggerID, record.ChannelID, check.ChannelID)
+				return false
+			}
+		}
+		if check.RevisionID != 0 {
+			rev, found, err := b.store.GetTriggerRevisionByID(ctx, check.RevisionID)
+			if err != nil || !found {
+				log.Printf("access check failed: revision %d not found (err: %v)", check.RevisionID, err)
+				return false
+			}
+			check.ChannelID = rev.ChannelID
+		}
+		if !b.authorize(ctx, check.ChannelID, userID, check.Required) {
+			return false
+		}
+	}
+	return true
+}
+
+// paramAccess mensyaratkan peran minimal pada channel, trigger atau revisi
+// yang disebut di parameter tombol.
+func (b *Bot) paramAccess(required string) accessFunc {
+	return func(userID int64, p callbackParams) []accessCheck {
+		return []accessCheck{{ChannelID: p.ChannelID, TriggerID: p.TriggerID, RevisionID: p.RevisionID, Required: required}}
+	}
+}
+
+// sessionAccess mensyaratkan peran minimal pada channel sesi aktif, dan juga
+// pada channel tujuan jika tombol atau sesi menyebutkannya.
+func (b *Bot) sessionAccess(required string) accessFunc {
+	return func(userID int64, p callbackParams) []accessCheck {
+		state, found := b.states.GetState(userID)
+		if !found || state.ChannelID == 0 {
+			// Handler sendiri yang melaporkan sesi kedaluwarsa
+			return nil
+		}
+		checks := []accessCheck{{ChannelID: state.ChannelID, TriggerID: p.TriggerID, Required: required}}
+		targetID := p.TargetID
+		if targetID == 0 {
+			targetID = state.TargetChannelID
+		}
+		if targetID != 0 {
+			checks = append(checks, accessCheck{ChannelID: targetID, Required: required})
+		}
+		return checks
+	}
+}
@@ -0,0 +1,796 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+const (
+	testUserID    int64 = 42
+	testChannelID int64 = -1001
+	testDMChatID  int64 = -2001
+)
+
+func TestRegisterCommand(t *testing.T) {
+	admin := []ChatMember{{User: User{ID: testUserID}, Status: "administrator"}}
+	channel := &GetChatResponse{ID: testChannelID, Title: "News"}
+	success := i18n.GetMessage("en", "register_success", struct{ ChannelTitle string }{"News"})
+
+	tests := []struct {
+		name           string
+		text           string
+		chats          map[interface{}]*GetChatResponse
+		admins         []ChatMember
+		wantText       string
+		wantRegistered bool
+		wantSession    bool
+	}{
+		{
+			name:        "without argument asks for a forward",
+			text:        "/register",
+			wantText:    i18n.GetMessage("en", "register_prompt_forward", nil),
+			wantSession: true,
+		},
+		{
+			name:     "invalid identifier",
+			text:     "/register news",
+			wantText: i18n.GetMessage("en", "register_usage", nil),
+		},
+		{
+			name:     "too many arguments",
+			text:     "/register @news extra",
+			wantText: i18n.GetMessage("en", "register_usage", nil),
+		},
+		{
+			name:     "unknown channel",
+			text:     "/register @missing",
+			wantText: i18n.GetMessage("en", "register_fail_not_found", nil),
+		},
+		{
+			name:     "user is not an admin",
+			text:     "/register @news",
+			chats:    map[interface{}]*GetChatResponse{"@news": channel},
+			admins:   []ChatMember{{User: User{ID: 7}, Status: "creator"}},
+			wantText: i18n.GetMessage("en", "register_fail_not_admin", nil),
+		},
+		{
+			name:           "by username",
+			text:           "/register @news",
+			chats:          map[interface{}]*GetChatResponse{"@news": channel},
+			admins:         admin,
+			wantText:       success,
+			wantRegistered: true,
+		},
+		{
+			name:           "by numeric id",
+			text:           "/register -1001",
+			chats:          map[interface{}]*GetChatResponse{testChannelID: channel},
+			admins:         admin,
+			wantText:       success,
+			wantRegistered: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, client, store := newTestBot(t)
+			for id, chat := range tt.chats {
+				client.chats[id] = chat
+			}
+			client.admins[testChannelID] = tt.admins
+
+			if err := b.handleUpdate(context.Background(), textUpdate(1, testUserID, tt.text)); err != nil {
+				t.Fatalf("handleUpdate: %v", err)
+			}
+
+			if got := client.lastMessage(t); got.Text != tt.wantText || got.ChatID != testUserID {
+				t.Errorf("sent %q to %d, want %q to %d", got.Text, got.ChatID, tt.wantText, testUserID)
+			}
+
+			ch, registered, _ := store.GetRegisteredChannel(context.Background(), testChannelID)
+			if registered != tt.wantRegistered {
+				t.Fatalf("registered = %v, want %v", registered, tt.wantRegistered)
+			}
+			if registered {
+				if ch.OwnerID != testUserID || ch.Title != "News" {
+					t.Errorf("registered channel = %+v, want owner %d and title News", ch, testUserID)
+				}
+				if len(store.audit) != 1 || store.audit[0].Action != storage.AuditRegister {
+					t.Errorf("audit = %+v, want one register event", store.audit)
+				}
+			}
+
+			state, inSession := b.states.GetState(testUserID)
+			if inSession != tt.wantSession {
+				t.Fatalf("in session = %v, want %v", inSession, tt.wantSession)
+			}
+			if inSession && state.Step != "awaiting_registration_forward" {
+				t.Errorf("step = %q, want awaiting_registration_forward", state.Step)
+			}
+		})
+	}
+}
+
+func TestLearnCommand(t *testing.T) {
+	news := storage.RegisteredChannel{ChannelID: testChannelID, Title: "News", OwnerID: 7}
+	blog := storage.RegisteredChannel{ChannelID: -1002, Title: "Blog", OwnerID: testUserID}
+
+	tests := []struct {
+		name       string
+		channels   []storage.RegisteredChannel
+		roles      []storage.ChannelRole
+		admins     map[int64][]ChatMember
+		wantTitles []string
+	}{
+		{
+			name:     "no channels",
+			channels: []storage.RegisteredChannel{news},
+		},
+		{
+			name:       "telegram admin is an editor",
+			channels:   []storage.RegisteredChannel{news},
+			admins:     map[int64][]ChatMember{testChannelID: {{User: User{ID: testUserID}}}},
+			wantTitles: []string{"News"},
+		},
+		{
+			name:       "owner",
+			channels:   []storage.RegisteredChannel{blog},
+			wantTitles: []string{"Blog"},
+		},
+		{
+			name:     "viewer cannot teach",
+			channels: []storage.RegisteredChannel{news},
+			roles:    []storage.ChannelRole{{ChannelID: testChannelID, UserID: testUserID, Role: storage.RoleViewer}},
+		},
+		{
+			name:       "invited editor",
+			channels:   []storage.RegisteredChannel{news},
+			roles:      []storage.ChannelRole{{ChannelID: testChannelID, UserID: testUserID, Role: storage.RoleEditor}},
+			wantTitles: []string{"News"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, client, store := newTestBot(t)
+			for _, ch := range tt.channels {
+				store.channels[ch.ChannelID] = ch
+			}
+			store.roles = tt.roles
+			for id, admins := range tt.admins {
+				client.admins[id] = admins
+			}
+
+			if err := b.handleUpdate(context.Background(), textUpdate(1, testUserID, "/learn")); err != nil {
+				t.Fatalf("handleUpdate: %v", err)
+			}
+
+			got := client.lastMessage(t)
+			if len(tt.wantTitles) == 0 {
+				if want := i18n.GetMessage("en", "learn_no_channels_found", nil); got.Text != want {
+					t.Errorf("sent %q, want %q", got.Text, want)
+				}
+				return
+			}
+			if want := i18n.GetMessage("en", "learn_prompt_channel", nil); got.Text != want {
+				t.Errorf("sent %q, want %q", got.Text, want)
+			}
+			if titles := keyboardTitles(got.ReplyMarkup); !equalStrings(titles, tt.wantTitles) {
+				t.Errorf("buttons = %v, want %v", titles, tt.wantTitles)
+			}
+		})
+	}
+}
+
+func TestLearnFlowSavesTrigger(t *testing.T) {
+	ctx := context.Background()
+	b, client, store := newTestBot(t)
+	store.channels[testChannelID] = storage.RegisteredChannel{ChannelID: testChannelID, Title: "News", OwnerID: testUserID}
+
+	if err := b.handleUpdate(ctx, textUpdate(1, testUserID, "/learn")); err != nil {
+		t.Fatalf("/learn: %v", err)
+	}
+	channelButton := client.lastMessage(t).ReplyMarkup.InlineKeyboard[0][0]
+
+	if err := b.handleUpdate(ctx, callbackUpdate(2, testUserID, channelButton.CallbackData)); err != nil {
+		t.Fatalf("choosing channel: %v", err)
+	}
+	if want := i18n.GetMessage("en", "learn_channel_selected", nil); client.lastEdit(t).Text != want {
+		t.Errorf("edited to %q, want %q", client.lastEdit(t).Text, want)
+	}
+
+	if err := b.handleUpdate(ctx, textUpdate(3, testUserID, "Price")); err != nil {
+		t.Fatalf("sending trigger: %v", err)
+	}
+	textButton := client.lastMessage(t).ReplyMarkup.InlineKeyboard[0][0]
+
+	if err := b.handleUpdate(ctx, callbackUpdate(4, testUserID, textButton.CallbackData)); err != nil {
+		t.Fatalf("choosing response type: %v", err)
+	}
+	if want := i18n.GetMessage("en", "learn_awaiting_text", nil); client.lastEdit(t).Text != want {
+		t.Errorf("edited to %q, want %q", client.lastEdit(t).Text, want)
+	}
+
+	if err := b.handleUpdate(ctx, textUpdate(5, testUserID, "It costs $5")); err != nil {
+		t.Fatalf("sending response: %v", err)
+	}
+	wantText := i18n.GetMessage("en", "learn_success", struct{ Trigger string }{"Price"})
+	if got := client.lastMessage(t).Text; got != wantText {
+		t.Errorf("sent %q, want %q", got, wantText)
+	}
+
+	record, found, _ := store.Get(ctx, testChannelID, "price")
+	if !found || record.ResponseType != "text" || record.ResponseText != "It costs $5" {
+		t.Errorf("stored trigger = %+v (found %v), want text reply 'It costs $5'", record, found)
+	}
+	if _, inSession := b.states.GetState(testUserID); inSession {
+		t.Error("session still active after saving the trigger")
+	}
+}
+
+func TestManageCommand(t *testing.T) {
+	news := storage.RegisteredChannel{ChannelID: testChannelID, Title: "News", OwnerID: 7}
+	blog := storage.RegisteredChannel{ChannelID: -1002, Title: "Blog", OwnerID: 7}
+
+	tests := []struct {
+		name       string
+		roles      []storage.ChannelRole
+		admins     map[int64][]ChatMember
+		wantTitles []string
+	}{
+		{
+			name: "no access",
+		},
+		{
+			name:       "viewer sees the dashboard",
+			roles:      []storage.ChannelRole{{ChannelID: testChannelID, UserID: testUserID, Role: storage.RoleViewer}},
+			wantTitles: []string{"News"},
+		},
+		{
+			name:       "telegram admin",
+			admins:     map[int64][]ChatMember{-1002: {{User: User{ID: testUserID}}}},
+			wantTitles: []string{"Blog"},
+		},
+		{
+			name:       "roles of other users are ignored",
+			roles:      []storage.ChannelRole{{ChannelID: testChannelID, UserID: 8, Role: storage.RoleEditor}},
+			wantTitles: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, client, store := newTestBot(t)
+			store.channels[news.ChannelID] = news
+			store.channels[blog.ChannelID] = blog
+			store.roles = tt.roles
+			for id, admins := range tt.admins {
+				client.admins[id] = admins
+			}
+
+			if err := b.handleUpdate(context.Background(), textUpdate(1, testUserID, "/manage")); err != nil {
+				t.Fatalf("handleUpdate: %v", err)
+			}
+
+			got := client.lastMessage(t)
+			if len(tt.wantTitles) == 0 {
+				if want := i18n.GetMessage("en", "learn_no_channels_found", nil); got.Text != want {
+					t.Errorf("sent %q, want %q", got.Text, want)
+				}
+				return
+			}
+			if want := i18n.GetMessage("en", "manage_prompt", nil); got.Text != want {
+				t.Errorf("sent %q, want %q", got.Text, want)
+			}
+			if titles := keyboardTitles(got.ReplyMarkup); !equalStrings(titles, tt.wantTitles) {
+				t.Errorf("buttons = %v, want %v", titles, tt.wantTitles)
+			}
+		})
+	}
+}
+
+func TestAutoReply(t *testing.T) {
+	greeting := storage.TriggerRecord{ChannelID: testChannelID, TriggerText: "hello", ResponseType: "text", ResponseText: "Hi {{user_first_name}}!"}
+	menu := storage.TriggerRecord{ChannelID: testChannelID, TriggerText: "menu", ResponseType: "photo", ResponseFileID: "photo-1", ResponseText: "Our menu"}
+
+	defaults := storage.DefaultChannelSettings(testChannelID)
+	disabled := defaults
+	disabled.AutoReply = false
+	contains := defaults
+	contains.MatchMode = storage.MatchModeContains
+	fallback := defaults
+	fallback.FallbackReply = "We will get back to you."
+
+	tests := []struct {
+		name         string
+		text         string
+		unregistered bool
+		blocked      bool
+		settings     *storage.ChannelSettings
+		wantMethod   string
+		wantText     string
+	}{
+		{
+			name:       "exact match fills placeholders",
+			text:       "Hello",
+			wantMethod: "sendMessage",
+			wantText:   "Hi Tester!",
+		},
+		{
+			name:       "punctuation is ignored like in /unanswered",
+			text:       "Hello!!",
+			wantMethod: "sendMessage",
+			wantText:   "Hi Tester!",
+		},
+		{
+			name:       "media response",
+			text:       "menu",
+			wantMethod: "sendPhoto",
+			wantText:   "Our menu",
+		},
+		{
+			name: "no match without fallback stays silent",
+			text: "where are you?",
+		},
+		{
+			name:       "fallback reply",
+			text:       "where are you?",
+			settings:   &fallback,
+			wantMethod: "sendMessage",
+			wantText:   "We will get back to you.",
+		},
+		{
+			name:       "contains mode",
+			text:       "well hello there",
+			settings:   &contains,
+			wantMethod: "sendMessage",
+			wantText:   "Hi Tester!",
+		},
+		{
+			name:     "auto reply disabled",
+			text:     "hello",
+			settings: &disabled,
+		},
+		{
+			name:    "blocked user",
+			text:    "hello",
+			blocked: true,
+		},
+		{
+			name:         "unregistered channel",
+			text:         "hello",
+			unregistered: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			b, client, store := newTestBot(t)
+			client.chats[testDMChatID] = &GetChatResponse{ID: testDMChatID, ParentChat: &ParentChat{ID: testChannelID}}
+			if !tt.unregistered {
+				store.channels[testChannelID] = storage.RegisteredChannel{ChannelID: testChannelID, Title: "News", OwnerID: 7}
+			}
+			if tt.blocked {
+				store.blocked[testChannelID] = []storage.BlockedUser{{ChannelID: testChannelID, UserID: testUserID}}
+			}
+			if tt.settings != nil {
+				store.settings[testChannelID] = *tt.settings
+			}
+			store.Set(ctx, greeting)
+			store.Set(ctx, menu)
+
+			update := Update{ID: 1, Message: &Message{
+				ID:                  1,
+				From:                User{ID: testUserID, FirstName: "Tester", LangCode: "en"},
+				Chat:                Chat{ID: testDMChatID, Type: "supergroup", IsDirectMessages: true},
+				DirectMessagesTopic: DirectMessagesTopic{TopicID: 9},
+				Text:                tt.text,
+			}}
+			if err := b.handleUpdate(ctx, update); err != nil {
+				t.Fatalf("handleUpdate: %v", err)
+			}
+
+			var replies []sentCall
+			for _, method := range []string{"sendMessage", "sendPhoto", "sendSticker", "sendDocument", "sendAnimation", "sendAudio"} {
+				replies = append(replies, client.sent(method)...)
+			}
+			if tt.wantMethod == "" {
+				if len(replies) != 0 {
+					t.Fatalf("sent %+v, want no reply", replies)
+				}
+				return
+			}
+			if len(replies) != 1 || replies[0].Method != tt.wantMethod {
+				t.Fatalf("sent %+v, want one %s", replies, tt.wantMethod)
+			}
+
+			var chatID int64
+			var topicID int
+			var text string
+			switch payload := replies[0].Payload.(type) {
+			case SendMessagePayload:
+				chatID, topicID, text = payload.ChatID, payload.DirectMessagesTopicID, payload.Text
+			case SendPhotoPayload:
+				chatID, topicID, text = payload.ChatID, payload.DirectMessagesTopicID, payload.Caption
+			}
+			if chatID != testDMChatID || topicID != 9 {
+				t.Errorf("replied to chat %d topic %d, want chat %d topic 9", chatID, topicID, testDMChatID)
+			}
+			if text != tt.wantText {
+				t.Errorf("reply text = %q, want %q", text, tt.wantText)
+			}
+		})
+	}
+}
+
+func keyboardTitles(markup *InlineKeyboardMarkup) []string {
+	if markup == nil {
+		return nil
+	}
+	var titles []string
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			titles = append(titles, button.Text)
+		}
+	}
+	return titles
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSessionWaitingForButtons(t *testing.T) {
+	tests := []struct {
+		name    string
+		step    string
+		session string
+	}{
+		{name: "copying triggers", step: "cloning", session: "session_cloning"},
+		{name: "choosing reply type", step: "awaiting_response_type", session: "session_awaiting_response_type"},
+		{name: "unknown step", step: "awaiting_something_new", session: "session_other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, client, _ := newTestBot(t)
+			b.states.SetState(testUserID, &UserState{Step: tt.step})
+
+			if err := b.handleUpdate(context.Background(), textUpdate(1, testUserID, "hello")); err != nil {
+				t.Fatalf("handleUpdate: %v", err)
+			}
+
+			session := i18n.GetMessage("en", tt.session, nil)
+			want := i18n.GetMessage("en", "session_active", struct{ Session string }{session})
+			if got := client.lastMessage(t).Text; got != want {
+				t.Errorf("sent %q, want %q", got, want)
+			}
+			if _, inSession := b.states.GetState(testUserID); !inSession {
+				t.Error("session was cleared by a stray message")
+			}
+		})
+	}
+}
+
+func TestBlockPromptBack(t *testing.T) {
+	ctx := context.Background()
+	b, client, store := newTestBot(t)
+	store.channels[testChannelID] = storage.RegisteredChannel{ChannelID: testChannelID, Title: "News", OwnerID: 7}
+	store.roles = []storage.ChannelRole{{ChannelID: testChannelID, UserID: testUserID, Role: storage.RoleEditor}}
+
+	prompt := b.callbackData("block_prompt", callbackParams{ChannelID: testChannelID})
+	if err := b.handleUpdate(ctx, callbackUpdate(1, testUserID, prompt)); err != nil {
+		t.Fatalf("handleUpdate: %v", err)
+	}
+	if state, _ := b.states.GetState(testUserID); state == nil || state.Step != "awaiting_block_user" {
+		t.Fatalf("state = %+v, want awaiting_block_user", state)
+	}
+	markup := client.lastEdit(t).ReplyMarkup
+	if markup == nil || len(markup.InlineKeyboard) == 0 {
+		t.Fatal("block prompt has no back button")
+	}
+
+	back := markup.InlineKeyboard[0][0].CallbackData
+	if err := b.handleUpdate(ctx, callbackUpdate(2, testUserID, back)); err != nil {
+		t.Fatalf("handleUpdate: %v", err)
+	}
+	if _, inSession := b.states.GetState(testUserID); inSession {
+		t.Error("going back left the block prompt session open")
+	}
+}
+
+func TestContainsModeSeesNewTriggers(t *testing.T) {
+	ctx := context.Background()
+	b, client, store := newTestBot(t)
+	client.chats[testDMChatID] = &GetChatResponse{ID: testDMChatID, ParentChat: &ParentChat{ID: testChannelID}}
+	store.channels[testChannelID] = storage.RegisteredChannel{ChannelID: testChannelID, Title: "News", OwnerID: 7}
+	settings := storage.DefaultChannelSettings(testChannelID)
+	settings.MatchMode = storage.MatchModeContains
+	store.settings[testChannelID] = settings
+
+	dm := func(id int) Update {
+		return Update{ID: id, Message: &Message{
+			ID:                  id,
+			From:                User{ID: testUserID, FirstName: "Tester", LangCode: "en"},
+			Chat:                Chat{ID: testDMChatID, Type: "supergroup", IsDirectMessages: true},
+			DirectMessagesTopic: DirectMessagesTopic{TopicID: 9},
+			Text:                "well hello there",
+		}}
+	}
+
+	// DM pertama mengisi cache trigger channel yang masih kosong
+	if err := b.handleUpdate(ctx, dm(1)); err != nil {
+		t.Fatalf("handleUpdate: %v", err)
+	}
+	if sent := client.sent("sendMessage"); len(sent) != 0 {
+		t.Fatalf("sent %+v before any trigger existed", sent)
+	}
+
+	record := storage.TriggerRecord{ChannelID: testChannelID, TriggerText: "hello", ResponseType: "text", ResponseText: "Hi!"}
+	if err := b.saveTrigger(ctx, record, 7, storage.AuditLearn); err != nil {
+		t.Fatalf("saveTrigger: %v", err)
+	}
+	if err := b.handleUpdate(ctx, dm(2)); err != nil {
+		t.Fatalf("handleUpdate: %v", err)
+	}
+	if got := client.lastMessage(t).Text; got != "Hi!" {
+		t.Errorf("reply = %q, want the trigger learned after the cache was filled", got)
+	}
+}
+
+func TestMutedUserSkipsGetChat(t *testing.T) {
+	ctx := context.Background()
+	b, client, store := newTestBot(t)
+	client.chats[testDMChatID] = &GetChatResponse{ID: testDMChatID, ParentChat: &ParentChat{ID: testChannelID}}
+	store.channels[testChannelID] = storage.RegisteredChannel{ChannelID: testChannelID, Title: "News", OwnerID: 7}
+
+	dm := func(id int) Update {
+		return Update{ID: id, Message: &Message{
+			ID:                  id,
+			From:                User{ID: testUserID, FirstName: "Tester", LangCode: "en"},
+			Chat:                Chat{ID: testDMChatID, Type: "supergroup", IsDirectMessages: true},
+			DirectMessagesTopic: DirectMessagesTopic{TopicID: 9},
+			Text:                fmt.Sprintf("message %d", id),
+		}}
+	}
+
+	// Pesan ke-(floodMaxMessages+1) memicu pembisuan
+	for id := 1; id <= floodMaxMessages+1; id++ {
+		if err := b.handleUpdate(ctx, dm(id)); err != nil {
+			t.Fatalf("handleUpdate: %v", err)
+		}
+	}
+	before := len(client.sent("getChat"))
+	if err := b.handleUpdate(ctx, dm(floodMaxMessages+2)); err != nil {
+		t.Fatalf("handleUpdate: %v", err)
+	}
+	if after := len(client.sent("getChat")); after != before {
+		t.Errorf("muted message called getChat %d times, want none", after-before)
+	}
+}
+
+func TestTestCommandWithMarkdownInput(t *testing.T) {
+	b, client, store := newTestBot(t)
+	client.chats[testChannelID] = &GetChatResponse{ID: testChannelID, Title: "News_*"}
+	store.channels[testChannelID] = storage.RegisteredChannel{ChannelID: testChannelID, Title: "News_*", OwnerID: testUserID}
+
+	if err := b.handleUpdate(context.Background(), textUpdate(1, testUserID, "/test -1001 what's `the` *price*")); err != nil {
+		t.Fatalf("handleUpdate: %v", err)
+	}
+
+	got := client.lastMessage(t)
+	if got.ParseMode != "" {
+		t.Errorf("parse mode = %q, want plain text for user input", got.ParseMode)
+	}
+	if !strings.Contains(got.Text, "what's `the` *price*") {
+		t.Errorf("sent %q, want the message shown verbatim", got.Text)
+	}
+}
+
+func TestChannelsWithRoleMatchesChannelRole(t *testing.T) {
+	ctx := context.Background()
+	b, client, store := newTestBot(t)
+	const member = int64(77)
+	store.channels[-1001] = storage.RegisteredChannel{ChannelID: -1001, Title: "Admin", OwnerID: 7}
+	store.channels[-1002] = storage.RegisteredChannel{ChannelID: -1002, Title: "Viewer", OwnerID: 7}
+	store.channels[-1003] = storage.RegisteredChannel{ChannelID: -1003, Title: "Owned", OwnerID: member}
+	store.channels[-1004] = storage.RegisteredChannel{ChannelID: -1004, Title: "Editor", OwnerID: 7}
+	admin := []ChatMember{{User: User{ID: member}, Status: "administrator"}}
+	client.admins[-1001] = admin
+	client.admins[-1002] = admin
+	// Peran eksplisit mengalahkan status admin Telegram
+	store.roles = []storage.ChannelRole{
+		{ChannelID: -1002, UserID: member, Role: storage.RoleViewer},
+		{ChannelID: -1004, UserID: member, Role: storage.RoleEditor},
+	}
+
+	for _, required := range []string{storage.RoleViewer, storage.RoleEditor, storage.RoleOwner} {
+		channels, err := b.getChannelsWithRole(ctx, member, required)
+		if err != nil {
+			t.Fatalf("getChannelsWithRole(%s): %v", required, err)
+		}
+		listed := make(map[int64]bool)
+		for _, ch := range channels {
+			listed[ch.ChannelID] = true
+		}
+		for id := range store.channels {
+			role, err := b.channelRole(ctx, id, member)
+			if err != nil {
+				t.Fatalf("channelRole(%d): %v", id, err)
+			}
+			if want := roleAtLeast(role, required); listed[id] != want {
+				t.Errorf("channel %d with role %q listed for %s = %v, want %v", id, role, required, listed[id], want)
+			}
+		}
+	}
+}
+
+func TestRoleChangesAreAudited(t *testing.T) {
+	ctx := context.Background()
+	b, _, store := newTestBot(t)
+	const member = int64(77)
+	store.channels[testChannelID] = storage.RegisteredChannel{ChannelID: testChannelID, Title: "News", OwnerID: testUserID}
+
+	invite := callbackUpdate(1, testUserID, b.callbackData("roles_invite", callbackParams{ChannelID: testChannelID, Value: storage.RoleEditor}))
+	if err := b.handleUpdate(ctx, invite); err != nil {
+		t.Fatalf("handleUpdate(invite): %v", err)
+	}
+	if len(store.invites) != 1 {
+		t.Fatalf("got %d invites, want 1", len(store.invites))
+	}
+	var token string
+	for tok := range store.invites {
+		token = tok
+	}
+	if err := b.handleUpdate(ctx, textUpdate(2, member, "/start "+invitePrefix+token)); err != nil {
+		t.Fatalf("handleUpdate(start): %v", err)
+	}
+	remove := callbackUpdate(3, testUserID, b.callbackData("roles_remove", callbackParams{ChannelID: testChannelID, MemberID: member}))
+	if err := b.handleUpdate(ctx, remove); err != nil {
+		t.Fatalf("handleUpdate(remove): %v", err)
+	}
+
+	want := []storage.AuditEvent{
+		{ChannelID: testChannelID, ActorID: testUserID, Action: storage.AuditInvite, Target: storage.RoleEditor},
+		{ChannelID: testChannelID, ActorID: member, Action: storage.AuditInviteUse, Target: storage.RoleEditor},
+		{ChannelID: testChannelID, ActorID: testUserID, Action: storage.AuditRoleGrant, Target: "77", After: storage.RoleEditor},
+		{ChannelID: testChannelID, ActorID: testUserID, Action: storage.AuditRoleRemove, Target: "77", Before: storage.RoleEditor},
+	}
+	if len(store.audit) != len(want) {
+		t.Fatalf("audit = %+v, want %d events", store.audit, len(want))
+	}
+	for i := range want {
+		if store.audit[i] != want[i] {
+			t.Errorf("audit[%d] = %+v, want %+v", i, store.audit[i], want[i])
+		}
+	}
+}
+
+func TestBotRemovedFromChannel(t *testing.T) {
+	removed := func(id int, channelID int64) Update {
+		return Update{ID: id, MyChatMember: &ChatMemberUpdated{
+			Chat:          Chat{ID: channelID, Type: "channel"},
+			From:          User{ID: testUserID},
+			OldChatMember: ChatMember{User: User{ID: 1}, Status: "administrator"},
+			NewChatMember: ChatMember{User: User{ID: 1}, Status: "left"},
+		}}
+	}
+	ctx := context.Background()
+	b, _, store := newTestBot(t)
+	store.channels[testChannelID] = storage.RegisteredChannel{ChannelID: testChannelID, Title: "News", OwnerID: testUserID}
+
+	// Channel yang tidak terdaftar diabaikan tanpa event audit
+	if err := b.handleUpdate(ctx, removed(1, -1999)); err != nil {
+		t.Fatalf("handleUpdate: %v", err)
+	}
+	if len(store.audit) != 0 {
+		t.Fatalf("unregistered channel produced audit events %+v", store.audit)
+	}
+
+	if err := b.handleUpdate(ctx, removed(2, testChannelID)); err != nil {
+		t.Fatalf("handleUpdate: %v", err)
+	}
+	if _, found := store.channels[testChannelID]; found {
+		t.Error("registered channel was not unregistered")
+	}
+	if len(store.audit) != 1 || store.audit[0].Action != storage.AuditUnregister {
+		t.Errorf("audit = %+v, want one unregister event", store.audit)
+	}
+}
+
+func TestBlockedUserSkipsGetChat(t *testing.T) {
+	ctx := context.Background()
+	b, client, store := newTestBot(t)
+	const blockedUser = int64(77)
+	client.chats[testDMChatID] = &GetChatResponse{ID: testDMChatID, ParentChat: &ParentChat{ID: testChannelID}}
+	store.channels[testChannelID] = storage.RegisteredChannel{ChannelID: testChannelID, Title: "News", OwnerID: 7}
+	store.blocked[testChannelID] = []storage.BlockedUser{{ChannelID: testChannelID, UserID: blockedUser}}
+
+	dm := func(id int, userID int64) Update {
+		return Update{ID: id, Message: &Message{
+			ID:                  id,
+			From:                User{ID: userID, FirstName: "Tester", LangCode: "en"},
+			Chat:                Chat{ID: testDMChatID, Type: "supergroup", IsDirectMessages: true},
+			DirectMessagesTopic: DirectMessagesTopic{TopicID: int(userID)},
+			Text:                "hello",
+		}}
+	}
+
+	// Pesan pertama ke chat DM ini mengisi cache channel induknya
+	if err := b.handleUpdate(ctx, dm(1, testUserID)); err != nil {
+		t.Fatalf("handleUpdate: %v", err)
+	}
+	before := len(client.sent("getChat"))
+	if before != 1 {
+		t.Fatalf("first DM called getChat %d times, want 1", before)
+	}
+	for id := 2; id <= 4; id++ {
+		if err := b.handleUpdate(ctx, dm(id, blockedUser)); err != nil {
+			t.Fatalf("handleUpdate: %v", err)
+		}
+	}
+	if after := len(client.sent("getChat")); after != before {
+		t.Errorf("blocked user called getChat %d times, want none", after-before)
+	}
+	if got := len(client.sent("sendMessage")); got != 0 {
+		t.Errorf("blocked user got %d replies, want none", got)
+	}
+}
+
+func TestTriggerResponseCaptionParseMode(t *testing.T) {
+	tests := []struct {
+		responseType string
+		method       string
+		wantMode     string
+	}{
+		{"text", "sendMessage", "HTML"},
+		{"photo", "sendPhoto", "HTML"},
+		// Caption berikut tetap tanpa parse mode seperti sebelum ada pengaturan channel
+		{"document", "sendDocument", ""},
+		{"animation", "sendAnimation", ""},
+		{"audio", "sendAudio", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.responseType, func(t *testing.T) {
+			b, client, _ := newTestBot(t)
+			record := storage.TriggerRecord{ChannelID: testChannelID, ResponseType: tt.responseType, ResponseText: "price_list *v2*", ResponseFileID: "file"}
+			if err := b.sendTriggerResponse(context.Background(), testDMChatID, 9, record, User{ID: testUserID, FirstName: "Tester"}, "HTML"); err != nil {
+				t.Fatalf("sendTriggerResponse: %v", err)
+			}
+			calls := client.sent(tt.method)
+			if len(calls) != 1 {
+				t.Fatalf("got %d %s calls, want 1", len(calls), tt.method)
+			}
+			var mode string
+			switch payload := calls[0].Payload.(type) {
+			case SendMessagePayload:
+				mode = payload.ParseMode
+			case SendPhotoPayload:
+				mode = payload.ParseMode
+			case SendDocumentPayload:
+				mode = payload.ParseMode
+			case SendAnimationPayload:
+				mode = payload.ParseMode
+			case SendAudioPayload:
+				mode = payload.ParseMode
+			}
+			if mode != tt.wantMode {
+				t.Errorf("parse mode = %q, want %q", mode, tt.wantMode)
+			}
+		})
+	}
+}
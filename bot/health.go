@@ -0,0 +1,130 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthStopped  = "stopped"
+)
+
+const (
+	// Polling dianggap terganggu setelah beberapa kegagalan berturut-turut
+	pollDegradedAfter = 3
+	pollBackoffBase   = time.Second
+	pollBackoffMax    = time.Minute
+)
+
+// HealthReport adalah ringkasan kondisi bot untuk pemantauan.
+type HealthReport struct {
+	Status         string     `json:"status"`
+	Mode           string     `json:"mode"`
+	PollFailures   int        `json:"poll_failures,omitempty"`
+	LastPoll       *time.Time `json:"last_poll,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	SendQueueDepth int        `json:"send_queue_depth"`
+}
+
+// HealthState mencatat hasil polling terakhir. Dipakai bersama oleh loop
+// polling dan endpoint health.
+type HealthState struct {
+	mu           sync.Mutex
+	pollFailures int
+	lastPoll     time.Time
+	lastError    string
+	stopped      bool
+}
+
+func NewHealthState() *HealthState {
+	return &HealthState{}
+}
+
+func (h *HealthState) pollSucceeded(at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pollFailures = 0
+	h.lastPoll = at
+	h.lastError = ""
+}
+
+// pollFailed mencatat kegagalan dan mengembalikan jumlah kegagalan berturut-turut.
+func (h *HealthState) pollFailed(err error) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pollFailures++
+	h.lastError = err.Error()
+	return h.pollFailures
+}
+
+func (h *HealthState) stop(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopped = true
+	if err != nil {
+		h.lastError = err.Error()
+	}
+}
+
+// Health mengembalikan kondisi bot saat ini.
+func (b *Bot) Health() HealthReport {
+	b.health.mu.Lock()
+	defer b.health.mu.Unlock()
+
+	report := HealthReport{
+		Status:         HealthOK,
+		Mode:           b.cfg.UpdateMode,
+		PollFailures:   b.health.pollFailures,
+		LastError:      b.health.lastError,
+		SendQueueDepth: b.api.QueueDepth(),
+	}
+	if !b.health.lastPoll.IsZero() {
+		lastPoll := b.health.lastPoll
+		report.LastPoll = &lastPoll
+	}
+	switch {
+	case b.health.stopped:
+		report.Status = HealthStopped
+	case b.health.pollFailures >= pollDegradedAfter:
+		report.Status = HealthDegraded
+	}
+	return report
+}
+
+// healthHandler menjawab GET dengan HealthReport dalam JSON; statusnya 503
+// jika bot tidak dalam kondisi ok.
+func (b *Bot) healthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := b.Health()
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != HealthOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// runHealthServer menyajikan /healthz di HealthListenAddr sampai ctx selesai.
+func (b *Bot) runHealthServer(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", b.healthHandler())
+	server := &http.Server{Addr: b.cfg.HealthListenAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), webhookShutdownPeriod)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	log.Printf("health endpoint listening on %s/healthz", b.cfg.HealthListenAddr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("health server failed: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// Telegram menyimpan update paling lama 24 jam, jadi catatan dedup yang
+	// lebih tua tidak diperlukan lagi
+	processedUpdateRetention  = 24 * time.Hour
+	processedUpdatePruneEvery = time.Hour
+)
+
+// UpdateTracker melacak update yang sedang diproses worker pool. Karena worker
+// menyelesaikan update tidak berurutan, offset yang aman disimpan adalah
+// update_id terkecil yang belum selesai.
+type UpdateTracker struct {
+	mu        sync.Mutex
+	pending   map[int]bool
+	next      int // update_id tertinggi yang diterima + 1
+	committed int // offset yang terakhir disimpan ke storage
+}
+
+func NewUpdateTracker() *UpdateTracker {
+	return &UpdateTracker{pending: make(map[int]bool)}
+}
+
+// reset memulai pelacakan dari offset yang tersimpan.
+func (t *UpdateTracker) reset(offset int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.next = offset
+	t.committed = offset
+}
+
+func (t *UpdateTracker) begin(updateID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending[updateID] = true
+	if updateID >= t.next {
+		t.next = updateID + 1
+	}
+}
+
+func (t *UpdateTracker) done(updateID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.pending, updateID)
+}
+
+// offset mengembalikan offset yang aman disimpan dan apakah nilainya berubah
+// sejak terakhir disimpan.
+func (t *UpdateTracker) offset() (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	offset := t.next
+	for id := range t.pending {
+		if id < offset {
+			offset = id
+		}
+	}
+	return offset, offset > t.committed
+}
+
+func (t *UpdateTracker) markCommitted(offset int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if offset > t.committed {
+		t.committed = offset
+	}
+}
+
+// commitOffset menyimpan offset update yang sudah selesai diproses, sehingga
+// setelah restart polling dilanjutkan dari sana.
+func (b *Bot) commitOffset(ctx context.Context) {
+	offset, changed := b.tracker.offset()
+	if !changed {
+		return
+	}
+	if err := b.store.SetUpdateOffset(ctx, offset); err != nil {
+		log.Printf("failed to store update offset %d, will retry: %v", offset, err)
+		return
+	}
+	b.tracker.markCommitted(offset)
+}
+
+// processUpdate dijalankan worker untuk setiap update. Update diklaim di
+// storage sebelum handler dijalankan, sehingga webhook yang dikirim ulang,
+// restart, atau instance lain yang menerima update yang sama tidak mengirim
+// balasan kedua. Klaim dilepas jika handler gagal agar pengiriman ulang bisa
+// memprosesnya lagi; update yang terputus karena crash tetap terklaim dan
+// tidak diulang. Jika klaim gagal dicatat, update tetap diproses.
+func (b *Bot) processUpdate(ctx context.Context, update Update) {
+	defer b.tracker.done(update.ID)
+
+	claimed, err := b.store.ClaimUpdate(ctx, update.ID)
+	if err != nil {
+		log.Printf("could not claim update %d for deduplication: %v", update.ID, err)
+	} else if !claimed {
+		log.Printf("skipping duplicate update %d", update.ID)
+		return
+	}
+
+	err = b.handleUpdate(ctx, update)
+	// Tombol yang baru dikirim langsung disimpan agar instance lain dan
+	// restart berikutnya mengenalinya
+	b.flushCallbacks(ctx)
+	if err != nil {
+		log.Printf("error handling update %d: %v", update.ID, err)
+		if claimed {
+			if err := b.store.ReleaseUpdate(ctx, update.ID); err != nil {
+				log.Printf("could not release update %d: %v", update.ID, err)
+			}
+		}
+	}
+}
+
+// pruneProcessedUpdates menghapus catatan dedup yang sudah kedaluwarsa.
+func (b *Bot) pruneProcessedUpdates(ctx context.Context) {
+	if err := b.store.PruneProcessedUpdates(ctx, time.Now().Add(-processedUpdateRetention)); err != nil {
+		log.Printf("failed to prune processed updates: %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Batas global Telegram sekitar 30 pesan per detik untuk semua chat
+	globalSendInterval = time.Second / 30
+	globalSendBurst    = 30
+
+	// Chat pribadi sebaiknya tidak menerima lebih dari satu pesan per detik,
+	// grup dan channel tidak lebih dari 20 pesan per menit
+	privateSendInterval = time.Second
+	groupSendInterval   = 3 * time.Second
+	chatSendBurst       = 3
+
+	chatBucketIdle  = 10 * time.Minute
+	chatBucketSweep = 5 * time.Minute
+
+	// sendScheduleMax membatasi seberapa jauh ke depan slot kirim boleh dipesan.
+	// Pengiriman yang harus menunggu lebih lama gagal dengan ErrSendBacklog
+	// alih-alih menahan worker; sama dengan sendRetryAfterMax agar jeda setelah
+	// 429 yang masih ditunggu di handler tetap muat.
+	sendScheduleMax = 5 * time.Second
+)
+
+// ErrSendBacklog berarti antrean kirim ke sebuah chat sudah terlalu panjang.
+// Pemanggil di luar worker (misalnya broadcast) boleh menunggu lalu mencoba lagi.
+var ErrSendBacklog = errors.New("send backlog for chat is too long")
+
+const (
+	sendMaxAttempts = 5
+	sendBackoffBase = 500 * time.Millisecond
+	sendBackoffMax  = 10 * time.Second
+	// Total waktu menunggu retry_after di dalam handler; tunggu yang lebih
+	// lama akan menahan semua user lain di worker yang sama
+	sendRetryAfterMax = 5 * time.Second
+)
+
+// sendBucket adalah token bucket berbasis waktu: tat adalah waktu ketika
+// bucket kembali penuh jika tidak ada pengiriman baru.
+type sendBucket struct {
+	interval time.Duration
+	burst    int
+	tat      time.Time
+}
+
+// next mengembalikan waktu paling awal pengiriman berikutnya diizinkan.
+func (b *sendBucket) next(now time.Time) time.Time {
+	earliest := b.tat.Add(-time.Duration(b.burst-1) * b.interval)
+	if earliest.Before(now) {
+		return now
+	}
+	return earliest
+}
+
+func (b *sendBucket) take(at time.Time) {
+	if b.tat.Before(at) {
+		b.tat = at
+	}
+	b.tat = b.tat.Add(b.interval)
+}
+
+// chatKey adalah tujuan pesan untuk pacer. Semua DM sebuah channel dikirim ke
+// chat DM channel yang sama dan hanya berbeda topik, jadi setiap topik
+// (percakapan dengan satu user) punya bucket sendiri.
+type chatKey struct {
+	ChatID  int64
+	TopicID int
+}
+
+// SendPacer mengatur jadwal pesan keluar agar tidak melewati batas global dan
+// batas per chat Telegram. Pengirim yang harus menunggu dihitung di Depth.
+type SendPacer struct {
+	mu        sync.Mutex
+	global    sendBucket
+	chats     map[chatKey]*sendBucket
+	lastSweep time.Time
+	waiting   atomic.Int64
+}
+
+func NewSendPacer() *SendPacer {
+	return &SendPacer{
+		global:    sendBucket{interval: globalSendInterval, burst: globalSendBurst},
+		chats:     make(map[chatKey]*sendBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (p *SendPacer) chat(key chatKey) *sendBucket {
+	bucket, found := p.chats[key]
+	if !found {
+		// Topik DM adalah percakapan pribadi dengan satu user
+		interval := privateSendInterval
+		if key.ChatID < 0 && key.TopicID == 0 {
+			interval = groupSendInterval
+		}
+		bucket = &sendBucket{interval: interval, burst: chatSendBurst}
+		p.chats[key] = bucket
+	}
+	return bucket
+}
+
+// reserveChat memesan slot pengiriman ke key dan mengembalikan waktunya. Slot
+// yang lebih jauh dari sendScheduleMax tidak dipesan dan menghasilkan
+// ErrSendBacklog.
+func (p *SendPacer) reserveChat(key chatKey, now time.Time) (time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if now.Sub(p.lastSweep) > chatBucketSweep {
+		for k, bucket := range p.chats {
+			if now.Sub(bucket.tat) > chatBucketIdle {
+				delete(p.chats, k)
+			}
+		}
+		p.lastSweep = now
+	}
+
+	bucket := p.chat(key)
+	at := bucket.next(now)
+	if at.Sub(now) > sendScheduleMax {
+		return time.Time{}, ErrSendBacklog
+	}
+	bucket.take(at)
+	return at, nil
+}
+
+// reserveGlobal memesan slot dari batas global. Slot ini baru dipesan setelah
+// slot chat tiba, agar chat yang harus menunggu lama (misalnya setelah 429)
+// tidak memesan slot global jauh ke depan dan menahan semua chat lain.
+func (p *SendPacer) reserveGlobal(now time.Time) (time.Time, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	at := p.global.next(now)
+	if at.Sub(now) > sendScheduleMax {
+		return time.Time{}, ErrSendBacklog
+	}
+	p.global.take(at)
+	return at, nil
+}
+
+// Wait menahan pemanggil sampai pengiriman ke key diizinkan, paling lama
+// sekitar sendScheduleMax.
+func (p *SendPacer) Wait(ctx context.Context, key chatKey) error {
+	at, err := p.reserveChat(key, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := p.sleepUntil(ctx, at); err != nil {
+		return err
+	}
+	at, err = p.reserveGlobal(time.Now())
+	if err != nil {
+		return err
+	}
+	return p.sleepUntil(ctx, at)
+}
+
+func (p *SendPacer) sleepUntil(ctx context.Context, at time.Time) error {
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+	p.waiting.Add(1)
+	defer p.waiting.Add(-1)
+	return sleepContext(ctx, delay)
+}
+
+// Pause menunda semua pengiriman ke key sampai until, misalnya setelah
+// Telegram menjawab 429 dengan retry_after.
+func (p *SendPacer) Pause(key chatKey, until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	bucket := p.chat(key)
+	// Bucket dianggap penuh tepat pada until, jadi pengiriman berikutnya baru boleh saat itu
+	full := until.Add(time.Duration(bucket.burst-1) * bucket.interval)
+	if bucket.tat.Before(full) {
+		bucket.tat = full
+	}
+}
+
+// Depth adalah jumlah pengiriman yang sedang menunggu giliran.
+func (p *SendPacer) Depth() int {
+	return int(p.waiting.Load())
+}
+
+// retryBackoff menghitung jeda sebelum percobaan kirim ke-attempt (mulai dari 1).
+func retryBackoff(attempt int) time.Duration {
+	return jitteredBackoff(attempt, sendBackoffBase, sendBackoffMax)
+}
+
+// jitteredBackoff adalah backoff eksponensial dengan jitter penuh, dibatasi max.
+func jitteredBackoff(attempt int, base, max time.Duration) time.Duration {
+	backoff := base << (attempt - 1)
+	if backoff > max || backoff <= 0 {
+		backoff = max
+	}
+	return time.Duration(rand.Int63n(int64(backoff))) + time.Millisecond
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSendBucket(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	bucket := sendBucket{interval: time.Second, burst: 3}
+
+	// Tiga pesan pertama langsung boleh dikirim, yang keempat menunggu satu interval
+	for i := 0; i < 3; i++ {
+		if at := bucket.next(start); !at.Equal(start) {
+			t.Fatalf("send %d scheduled at %s, want immediately", i+1, at.Sub(start))
+		}
+		bucket.take(start)
+	}
+	if at := bucket.next(start); at.Sub(start) != time.Second {
+		t.Errorf("fourth send scheduled after %s, want 1s", at.Sub(start))
+	}
+
+	// Setelah diam cukup lama bucket kembali penuh
+	later := start.Add(time.Minute)
+	if at := bucket.next(later); !at.Equal(later) {
+		t.Errorf("send after idling scheduled after %s, want immediately", at.Sub(later))
+	}
+}
+
+func TestSendPacer(t *testing.T) {
+	now := time.Now()
+
+	t.Run("DM topics of one channel do not share a bucket", func(t *testing.T) {
+		p := NewSendPacer()
+		for topic := 1; topic <= 20; topic++ {
+			at, err := p.reserveChat(chatKey{ChatID: testDMChatID, TopicID: topic}, now)
+			if err != nil {
+				t.Fatalf("topic %d: %v", topic, err)
+			}
+			if !at.Equal(now) {
+				t.Fatalf("topic %d scheduled after %s, want immediately", topic, at.Sub(now))
+			}
+		}
+	})
+
+	t.Run("global limit", func(t *testing.T) {
+		p := NewSendPacer()
+		var at time.Time
+		for i := 0; i < globalSendBurst+1; i++ {
+			var err error
+			if at, err = p.reserveGlobal(now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := at.Sub(now); got != globalSendInterval {
+			t.Errorf("send after the global burst scheduled after %s, want %s", got, globalSendInterval)
+		}
+	})
+
+	t.Run("group chat without topic uses the group interval", func(t *testing.T) {
+		p := NewSendPacer()
+		key := chatKey{ChatID: testChannelID}
+		var last time.Time
+		for i := 0; i < chatSendBurst+1; i++ {
+			at, err := p.reserveChat(key, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			last = at
+		}
+		if got := last.Sub(now); got != groupSendInterval {
+			t.Errorf("send after the burst scheduled after %s, want %s", got, groupSendInterval)
+		}
+	})
+
+	t.Run("slots too far ahead are refused and not booked", func(t *testing.T) {
+		p := NewSendPacer()
+		key := chatKey{ChatID: testUserID}
+		var err error
+		booked := 0
+		for i := 0; i < 20 && err == nil; i++ {
+			if _, err = p.reserveChat(key, now); err == nil {
+				booked++
+			}
+		}
+		if !errors.Is(err, ErrSendBacklog) {
+			t.Fatalf("err = %v, want ErrSendBacklog", err)
+		}
+		// chatSendBurst langsung, lalu satu per detik sampai sendScheduleMax
+		if want := chatSendBurst + int(sendScheduleMax/privateSendInterval); booked != want {
+			t.Errorf("booked %d sends, want %d", booked, want)
+		}
+		if at, err := p.reserveChat(key, now.Add(sendScheduleMax)); err != nil || at.Sub(now) > 2*sendScheduleMax {
+			t.Errorf("refused sends were booked: next slot at %s, err %v", at.Sub(now), err)
+		}
+	})
+
+	t.Run("pause delays the chat until retry_after", func(t *testing.T) {
+		p := NewSendPacer()
+		key := chatKey{ChatID: testUserID}
+		p.Pause(key, now.Add(3*time.Second))
+		at, err := p.reserveChat(key, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := at.Sub(now); got != 3*time.Second {
+			t.Errorf("send after pause scheduled after %s, want 3s", got)
+		}
+		if other, _ := p.reserveChat(chatKey{ChatID: 7}, now); !other.Equal(now) {
+			t.Errorf("other chat was delayed by %s", other.Sub(now))
+		}
+		if global, _ := p.reserveGlobal(now); !global.Equal(now) {
+			t.Errorf("paused chat delayed the global limit by %s", global.Sub(now))
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+const revisionHistoryLimit = 10
+
+// saveTrigger menyimpan trigger lalu mencatat revisinya, sehingga isi lama
+// tetap bisa dipulihkan ketika upsert menimpa balasan yang sudah ada.
+// action adalah jenis event audit; /learn yang menimpa trigger lama dicatat
+// sebagai AuditEdit.
+func (b *Bot) saveTrigger(ctx context.Context, record storage.TriggerRecord, userID int64, action string) error {
+	previous, existed, err := b.store.Get(ctx, record.ChannelID, record.TriggerText)
+	if err != nil {
+		log.Printf("could not load previous value of trigger '%s' for audit: %v", record.TriggerText, err)
+	}
+
+	if existed {
+		b.preserveOriginalRevision(ctx, previous)
+	}
+
+	if err := b.store.Set(ctx, record); err != nil {
+		return err
+	}
+	b.triggers.Invalidate(record.ChannelID)
+
+	if err := b.store.AddTriggerRevision(ctx, triggerRevision(record, userID)); err != nil {
+		// Trigger sudah tersimpan; gagal mencatat riwayat tidak perlu menggagalkan operasi
+		log.Printf("failed to record revision for trigger '%s' in channel %d: %v", record.TriggerText, record.ChannelID, err)
+	}
+
+	before := ""
+	if existed {
+		before = auditTriggerValue(previous)
+		if action == storage.AuditLearn {
+			action = storage.AuditEdit
+		}
+	}
+	b.recordAudit(ctx, record.ChannelID, userID, action, record.TriggerText, before, auditTriggerValue(record))
+
+	// Pertanyaan yang kini sudah punya jawaban tidak perlu tampil di /unanswered lagi
+	if err := b.store.DeleteUnansweredQuery(ctx, record.ChannelID, normalizeUnanswered(record.TriggerText)); err != nil {
+		log.Printf("failed to clear unanswered query for trigger '%s': %v", record.TriggerText, err)
+	}
+	return nil
+}
+
+func triggerRevision(record storage.TriggerRecord, userID int64) storage.TriggerRevision {
+	return storage.TriggerRevision{
+		ChannelID:      record.ChannelID,
+		TriggerText:    record.TriggerText,
+		ResponseType:   record.ResponseType,
+		ResponseText:   record.ResponseText,
+		ResponseFileID: record.ResponseFileID,
+		EditedBy:       userID,
+	}
+}
+
+// preserveOriginalRevision mencatat isi trigger yang dibuat sebelum fitur
+// revisi ada, agar balasan lamanya tidak hilang saat pertama kali ditimpa.
+// Pengubahnya tidak diketahui, jadi EditedBy dibiarkan 0.
+func (b *Bot) preserveOriginalRevision(ctx context.Context, previous storage.TriggerRecord) {
+	revs, err := b.store.GetTriggerRevisions(ctx, previous.ChannelID, previous.TriggerText, 1)
+	if err != nil {
+		log.Printf("could not check revisions of trigger '%s': %v", previous.TriggerText, err)
+		return
+	}
+	if len(revs) > 0 {
+		return
+	}
+	if err := b.store.AddTriggerRevision(ctx, triggerRevision(previous, 0)); err != nil {
+		log.Printf("failed to record original revision of trigger '%s' in channel %d: %v", previous.TriggerText, previous.ChannelID, err)
+	}
+}
+
+// handleRevisionListCallback menampilkan riwayat sebuah trigger.
+func (b *Bot) handleRevisionListCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	record, found, err := b.store.GetTriggerByID(ctx, p.TriggerID)
+	if err != nil || !found {
+		return err
+	}
+	return b.sendTriggerHistory(ctx, cb.Message.Chat.ID, cb.Message.ID, lang, record, p.Page)
+}
+
+// handleRevisionRestoreCallback memulihkan isi trigger dari sebuah revisi (rollback).
+func (b *Bot) handleRevisionRestoreCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	userID := cb.From.ID
+	chatID := cb.Message.Chat.ID
+	messageID := cb.Message.ID
+
+	rev, found, err := b.store.GetTriggerRevisionByID(ctx, p.RevisionID)
+	if err != nil || !found {
+		return err
+	}
+
+	record := storage.TriggerRecord{
+		ChannelID:      rev.ChannelID,
+		TriggerText:    rev.TriggerText,
+		ResponseType:   rev.ResponseType,
+		ResponseText:   rev.ResponseText,
+		ResponseFileID: rev.ResponseFileID,
+	}
+	if err := b.saveTrigger(ctx, record, userID, storage.AuditEdit); err != nil {
+		log.Printf("failed to restore revision %d: %v", p.RevisionID, err)
+		return err
+	}
+	log.Printf("user %d restored revision %d of trigger '%s' in channel %d", userID, p.RevisionID, rev.TriggerText, rev.ChannelID)
+
+	alertText := i18n.GetMessage(lang, "history_restored_alert", struct{ Trigger string }{rev.TriggerText})
+	b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{CallbackQueryID: cb.ID, Text: alertText, ShowAlert: true})
+
+	current, found, err := b.store.Get(ctx, rev.ChannelID, rev.TriggerText)
+	if err != nil || !found {
+		return b.sendManagementDashboard(ctx, chatID, messageID, userID, lang, rev.ChannelID, p.Page)
+	}
+	return b.sendTriggerHistory(ctx, chatID, messageID, lang, current, p.Page)
+}
+
+// sendTriggerHistory menampilkan revisi terakhir sebuah trigger. Revisi teratas
+// adalah isi yang sedang aktif; revisi lainnya bisa dipulihkan dengan satu klik.
+func (b *Bot) sendTriggerHistory(ctx context.Context, chatID int64, messageID int, lang string, record storage.TriggerRecord, page int) error {
+	revisions, err := b.store.GetTriggerRevisions(ctx, record.ChannelID, record.TriggerText, revisionHistoryLimit)
+	if err != nil {
+		return err
+	}
+
+	var textBuilder strings.Builder
+	textBuilder.WriteString(i18n.GetMessage(lang, "history_title", struct{ Trigger string }{record.TriggerText}))
+	textBuilder.WriteString("\n\n")
+
+	if len(revisions) == 0 {
+		textBuilder.WriteString(i18n.GetMessage(lang, "history_empty", nil))
+	}
+
+	var keyboard [][]InlineKeyboardButton
+	var restoreRow []InlineKeyboardButton
+	for i, rev := range revisions {
+		number := len(revisions) - i
+		entryData := struct {
+			Number  int
+			Date    string
+			UserID  int64
+			Type    string
+			Preview string
+			Current bool
+		}{
+			Number:  number,
+			Date:    rev.CreatedAt.Format("2006-01-02 15:04"),
+			UserID:  rev.EditedBy,
+			Type:    rev.ResponseType,
+			Preview: revisionPreview(rev),
+			Current: i == 0,
+		}
+		textBuilder.WriteString(i18n.GetMessage(lang, "history_entry", entryData))
+		textBuilder.WriteString("\n\n")
+
+		if i == 0 {
+			continue
+		}
+		restoreRow = append(restoreRow, InlineKeyboardButton{
+			Text:         fmt.Sprintf("↩️ #%d", number),
+			CallbackData: b.callbackData("rev_restore", callbackParams{RevisionID: rev.ID, Page: page}),
+		})
+		if len(restoreRow) == 4 {
+			keyboard = append(keyboard, restoreRow)
+			restoreRow = nil
+		}
+	}
+	if len(restoreRow) > 0 {
+		keyboard = append(keyboard, restoreRow)
+	}
+
+	keyboard = append(keyboard, []InlineKeyboardButton{
+		{Text: i18n.GetMessage(lang, "back_button", nil), CallbackData: b.callbackData("manage", callbackParams{ChannelID: record.ChannelID, Page: page})},
+	})
+
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{
+		ChatID: chatID, MessageID: messageID, Text: textBuilder.String(), ParseMode: "Markdown", ReplyMarkup: &InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+}
+
+// revisionPreview memotong isi balasan agar muat di daftar riwayat.
+func revisionPreview(rev storage.TriggerRevision) string {
+	preview := rev.ResponseText
+	if preview == "" {
+		preview = rev.ResponseFileID
+	}
+	preview = strings.ReplaceAll(preview, "`", "'")
+	preview = strings.ReplaceAll(preview, "\n", " ")
+	runes := []rune(preview)
+	if len(runes) > 60 {
+		preview = string(runes[:57]) + "..."
+	}
+	if preview == "" {
+		return "-"
+	}
+	return "`" + preview + "`"
+}
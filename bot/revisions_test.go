@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"context"
+	"testing"
+
+	"telegram-dm-bot/storage"
+)
+
+func TestSaveTriggerKeepsOriginalRevision(t *testing.T) {
+	old := storage.TriggerRecord{ChannelID: testChannelID, TriggerText: "price", ResponseType: "text", ResponseText: "$5"}
+	updated := storage.TriggerRecord{ChannelID: testChannelID, TriggerText: "price", ResponseType: "text", ResponseText: "$6"}
+
+	tests := []struct {
+		name          string
+		existing      *storage.TriggerRecord
+		oldRevisions  []storage.TriggerRevision
+		wantRevisions []string
+	}{
+		{
+			name:          "new trigger",
+			wantRevisions: []string{"$6"},
+		},
+		{
+			name:          "trigger from before revisions existed",
+			existing:      &old,
+			wantRevisions: []string{"$5", "$6"},
+		},
+		{
+			name:          "trigger that already has revisions",
+			existing:      &old,
+			oldRevisions:  []storage.TriggerRevision{triggerRevision(old, 7)},
+			wantRevisions: []string{"$5", "$6"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			b, _, store := newTestBot(t)
+			if tt.existing != nil {
+				store.Set(ctx, *tt.existing)
+			}
+			store.revisions = tt.oldRevisions
+
+			if err := b.saveTrigger(ctx, updated, testUserID, storage.AuditLearn); err != nil {
+				t.Fatalf("saveTrigger: %v", err)
+			}
+
+			var got []string
+			for _, rev := range store.revisions {
+				got = append(got, rev.ResponseText)
+			}
+			if !equalStrings(got, tt.wantRevisions) {
+				t.Errorf("revisions = %v, want %v", got, tt.wantRevisions)
+			}
+			if record, _, _ := store.Get(ctx, testChannelID, "price"); record.ResponseText != "$6" {
+				t.Errorf("stored reply = %q, want $6", record.ResponseText)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+const (
+	invitePrefix   = "inv_"
+	inviteLifetime = 7 * 24 * time.Hour
+)
+
+// Handler menu kolaborator milik pemilik channel.
+
+func (b *Bot) handleRolesMenuCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	return b.sendRolesMenu(ctx, cb.Message.Chat.ID, cb.Message.ID, lang, p.ChannelID)
+}
+
+// handleRolesInviteCallback membuat tautan undangan untuk peran p.Value.
+func (b *Bot) handleRolesInviteCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	channelID := p.ChannelID
+	role := p.Value
+	if role != storage.RoleEditor && role != storage.RoleViewer {
+		return nil
+	}
+	token, err := newInviteToken()
+	if err != nil {
+		return err
+	}
+	invite := storage.ChannelInvite{
+		Token:     token,
+		ChannelID: channelID,
+		Role:      role,
+		CreatedBy: cb.From.ID,
+		CreatedAt: time.Now(),
+	}
+	if err := b.store.CreateInvite(ctx, invite); err != nil {
+		log.Printf("failed to create invite for channel %d: %v", channelID, err)
+		return err
+	}
+	b.recordAudit(ctx, channelID, cb.From.ID, storage.AuditInvite, role, "", "")
+
+	textData := struct {
+		ChannelTitle string
+		Role         string
+		Link         string
+	}{
+		ChannelTitle: b.channelTitle(ctx, channelID),
+		Role:         i18n.GetMessage(lang, "role_"+role, nil),
+		Link:         fmt.Sprintf("https://t.me/%s?start=%s%s", b.botUsername, invitePrefix, token),
+	}
+	text := i18n.GetMessage(lang, "roles_invite_created", textData)
+	keyboard := InlineKeyboardMarkup{
+		InlineKeyboard: [][]InlineKeyboardButton{
+			{{Text: i18n.GetMessage(lang, "back_button", nil), CallbackData: b.callbackData("roles", callbackParams{ChannelID: channelID})}},
+		},
+	}
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: cb.Message.Chat.ID, MessageID: cb.Message.ID, Text: text, ReplyMarkup: &keyboard})
+}
+
+func (b *Bot) handleRolesRemoveCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	previous, found, err := b.store.GetChannelRole(ctx, p.ChannelID, p.MemberID)
+	if err != nil {
+		return err
+	}
+	if err := b.store.RemoveChannelRole(ctx, p.ChannelID, p.MemberID); err != nil {
+		log.Printf("failed to remove role of user %d in channel %d: %v", p.MemberID, p.ChannelID, err)
+		return err
+	}
+	if found {
+		log.Printf("user %d removed collaborator %d from channel %d", cb.From.ID, p.MemberID, p.ChannelID)
+		b.recordAudit(ctx, p.ChannelID, cb.From.ID, storage.AuditRoleRemove, strconv.FormatInt(p.MemberID, 10), previous, "")
+	}
+	return b.sendRolesMenu(ctx, cb.Message.Chat.ID, cb.Message.ID, lang, p.ChannelID)
+}
+
+func (b *Bot) sendRolesMenu(ctx context.Context, chatID int64, messageID int, lang string, channelID int64) error {
+	roles, err := b.store.GetChannelRoles(ctx, channelID)
+	if err != nil {
+		return err
+	}
+
+	var textBuilder strings.Builder
+	textBuilder.WriteString(i18n.GetMessage(lang, "roles_title", struct{ ChannelTitle string }{b.channelTitle(ctx, channelID)}))
+	textBuilder.WriteString("\n\n")
+	if len(roles) == 0 {
+		textBuilder.WriteString(i18n.GetMessage(lang, "roles_empty", nil))
+	}
+
+	var keyboard [][]InlineKeyboardButton
+	for _, r := range roles {
+		roleName := i18n.GetMessage(lang, "role_"+r.Role, nil)
+		textBuilder.WriteString(fmt.Sprintf("• %d: %s\n", r.UserID, roleName))
+		keyboard = append(keyboard, []InlineKeyboardButton{
+			{Text: fmt.Sprintf("❌ %d (%s)", r.UserID, roleName), CallbackData: b.callbackData("roles_remove", callbackParams{ChannelID: channelID, MemberID: r.UserID})},
+		})
+	}
+
+	keyboard = append(keyboard,
+		[]InlineKeyboardButton{
+			{Text: i18n.GetMessage(lang, "roles_invite_editor_button", nil), CallbackData: b.callbackData("roles_invite", callbackParams{ChannelID: channelID, Value: storage.RoleEditor})},
+			{Text: i18n.GetMessage(lang, "roles_invite_viewer_button", nil), CallbackData: b.callbackData("roles_invite", callbackParams{ChannelID: channelID, Value: storage.RoleViewer})},
+		},
+		[]InlineKeyboardButton{
+			{Text: i18n.GetMessage(lang, "back_button", nil), CallbackData: b.callbackData("manage", callbackParams{ChannelID: channelID, Page: 1})},
+		},
+	)
+
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{
+		ChatID: chatID, MessageID: messageID, Text: textBuilder.String(), ReplyMarkup: &InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+}
+
+// handleInviteStart memproses deep link "/start inv_<token>".
+func (b *Bot) handleInviteStart(ctx context.Context, msg *Message, lang, token string) error {
+	invite, found, err := b.store.ConsumeInvite(ctx, token, msg.From.ID)
+	if err != nil {
+		log.Printf("failed to consume invite for user %d: %v", msg.From.ID, err)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: "An error occurred."})
+	}
+	if !found || time.Since(invite.CreatedAt) > inviteLifetime {
+		text := i18n.GetMessage(lang, "roles_invite_invalid", nil)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+	}
+	b.recordAudit(ctx, invite.ChannelID, msg.From.ID, storage.AuditInviteUse, invite.Role, "", "")
+
+	previous, _, err := b.store.GetChannelRole(ctx, invite.ChannelID, msg.From.ID)
+	if err != nil {
+		log.Printf("failed to get current role of user %d: %v", msg.From.ID, err)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: "An error occurred."})
+	}
+	role := storage.ChannelRole{ChannelID: invite.ChannelID, UserID: msg.From.ID, Role: invite.Role}
+	if err := b.store.SetChannelRole(ctx, role); err != nil {
+		log.Printf("failed to grant role from invite: %v", err)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: "An error occurred."})
+	}
+	log.Printf("user %d joined channel %d as %s via invite from %d", msg.From.ID, invite.ChannelID, invite.Role, invite.CreatedBy)
+	// Peran diberikan oleh pembuat undangan, jadi dia yang dicatat sebagai pelaku
+	b.recordAudit(ctx, invite.ChannelID, invite.CreatedBy, storage.AuditRoleGrant, strconv.FormatInt(msg.From.ID, 10), previous, invite.Role)
+
+	textData := struct {
+		ChannelTitle string
+		Role         string
+	}{b.channelTitle(ctx, invite.ChannelID), i18n.GetMessage(lang, "role_"+invite.Role, nil)}
+	text := i18n.GetMessage(lang, "roles_invite_accepted", textData)
+	return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+}
+
+func newInviteToken() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate invite token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
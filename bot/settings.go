@@ -0,0 +1,331 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+// Urutan nilai yang dilalui ketika tombol mode ditekan berulang kali
+var (
+	parseModeCycle = []string{"Markdown", "MarkdownV2", "HTML", ""}
+	matchModeCycle = []string{storage.MatchModeExact, storage.MatchModeContains, storage.MatchModePrefix}
+)
+
+func nextInCycle(cycle []string, current string) string {
+	for i, value := range cycle {
+		if value == current {
+			return cycle[(i+1)%len(cycle)]
+		}
+	}
+	return cycle[0]
+}
+
+func (b *Bot) handleSettingsCommand(ctx context.Context, msg *Message, lang string) error {
+	return b.sendChannelPicker(ctx, msg, lang, "settings", storage.RoleEditor, "settings_prompt")
+}
+
+// handleSettingsCallback menangani tombol menu /settings; p.Value berisi aksinya.
+func (b *Bot) handleSettingsCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	userID := cb.From.ID
+	chatID := cb.Message.Chat.ID
+	messageID := cb.Message.ID
+	channelID := p.ChannelID
+
+	settings, err := b.store.GetChannelSettings(ctx, channelID)
+	if err != nil {
+		log.Printf("error getting settings for channel %d: %v", channelID, err)
+		return err
+	}
+
+	before := settings
+	switch p.Value {
+	case "":
+		// Tombol dari pemilih channel /settings
+		return b.sendSettingsMenu(ctx, chatID, messageID, lang, settings)
+	case "auto":
+		settings.AutoReply = !settings.AutoReply
+	case "parse":
+		settings.ParseMode = nextInCycle(parseModeCycle, settings.ParseMode)
+	case "match":
+		settings.MatchMode = nextInCycle(matchModeCycle, settings.MatchMode)
+	case "notify":
+		settings.NotifyUnmatched = !settings.NotifyUnmatched
+	case "fbclear":
+		settings.FallbackReply = ""
+	case "fallback":
+		b.states.SetState(userID, &UserState{Step: "awaiting_fallback_reply", ChannelID: channelID})
+		text := i18n.GetMessage(lang, "settings_awaiting_fallback", nil)
+		return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: chatID, MessageID: messageID, Text: text, ParseMode: "Markdown"})
+	case "digest":
+		settings.DigestSchedule = nextInCycle(digestPresetCycle, settings.DigestSchedule)
+	case "digestcustom":
+		b.states.SetState(userID, &UserState{Step: "awaiting_digest_schedule", ChannelID: channelID})
+		text := i18n.GetMessage(lang, "settings_awaiting_digest_schedule", nil)
+		return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: chatID, MessageID: messageID, Text: text})
+	case "tz":
+		b.states.SetState(userID, &UserState{Step: "awaiting_timezone", ChannelID: channelID})
+		text := i18n.GetMessage(lang, "settings_awaiting_timezone", nil)
+		return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: chatID, MessageID: messageID, Text: text})
+	default:
+		return nil
+	}
+
+	if err := b.store.SetChannelSettings(ctx, settings); err != nil {
+		log.Printf("failed to save settings for channel %d: %v", channelID, err)
+		return err
+	}
+	b.recordSettingsAudit(ctx, userID, before, settings)
+	return b.sendSettingsMenu(ctx, chatID, messageID, lang, settings)
+}
+
+// handleFallbackReplyMessage menyimpan teks balasan cadangan dari sesi /settings.
+func (b *Bot) handleFallbackReplyMessage(ctx context.Context, msg *Message, state *UserState, lang string) error {
+	if msg.Text == "" {
+		data := struct{ ExpectedType string }{"text"}
+		text := i18n.GetMessage(lang, "learn_wrong_file_type", data)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+	}
+
+	return b.updateSettingsFromSession(ctx, msg, state, lang, func(settings *storage.ChannelSettings) {
+		settings.FallbackReply = msg.Text
+	})
+}
+
+// handleTimezoneMessage menyimpan zona waktu channel dari sesi /settings.
+func (b *Bot) handleTimezoneMessage(ctx context.Context, msg *Message, state *UserState, lang string) error {
+	name := strings.TrimSpace(msg.Text)
+	if _, err := time.LoadLocation(name); err != nil || name == "" || strings.EqualFold(name, "local") {
+		text := i18n.GetMessage(lang, "settings_invalid_timezone", nil)
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+	}
+	return b.updateSettingsFromSession(ctx, msg, state, lang, func(settings *storage.ChannelSettings) {
+		settings.Timezone = name
+	})
+}
+
+// handleDigestScheduleMessage menyimpan jadwal digest berupa ekspresi cron.
+func (b *Bot) handleDigestScheduleMessage(ctx context.Context, msg *Message, state *UserState, lang string) error {
+	expr := strings.Join(strings.Fields(msg.Text), " ")
+	if _, err := parseCron(expr); err != nil {
+		text := i18n.GetMessage(lang, "settings_invalid_digest_schedule", struct{ Error string }{err.Error()})
+		return b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: text})
+	}
+	return b.updateSettingsFromSession(ctx, msg, state, lang, func(settings *storage.ChannelSettings) {
+		settings.DigestSchedule = expr
+	})
+}
+
+// updateSettingsFromSession menerapkan perubahan dari sesi teks /settings,
+// mencatat audit-nya, lalu menampilkan menu pengaturan lagi.
+func (b *Bot) updateSettingsFromSession(ctx context.Context, msg *Message, state *UserState, lang string, apply func(*storage.ChannelSettings)) error {
+	settings, err := b.store.GetChannelSettings(ctx, state.ChannelID)
+	if err != nil {
+		log.Printf("error getting settings for channel %d: %v", state.ChannelID, err)
+		return err
+	}
+	before := settings
+	apply(&settings)
+	if err := b.store.SetChannelSettings(ctx, settings); err != nil {
+		log.Printf("failed to save settings for channel %d: %v", state.ChannelID, err)
+		b.api.SendMessage(ctx, SendMessagePayload{ChatID: msg.Chat.ID, Text: "An error occurred."})
+		return err
+	}
+	b.recordSettingsAudit(ctx, msg.From.ID, before, settings)
+	b.states.ClearState(msg.From.ID)
+
+	return b.sendSettingsMenu(ctx, msg.Chat.ID, 0, lang, settings)
+}
+
+// sendSettingsMenu mengedit pesan yang ada, atau mengirim pesan baru jika messageID 0.
+func (b *Bot) sendSettingsMenu(ctx context.Context, chatID int64, messageID int, lang string, settings storage.ChannelSettings) error {
+	channelID := settings.ChannelID
+
+	onOff := func(enabled bool) string {
+		if enabled {
+			return i18n.GetMessage(lang, "settings_on", nil)
+		}
+		return i18n.GetMessage(lang, "settings_off", nil)
+	}
+	parseMode := settings.ParseMode
+	if parseMode == "" {
+		parseMode = i18n.GetMessage(lang, "settings_parse_none", nil)
+	}
+	fallback := i18n.GetMessage(lang, "settings_fallback_none", nil)
+	if settings.FallbackReply != "" {
+		fallback = settings.FallbackReply
+	}
+	timezone := settings.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	digest := i18n.GetMessage(lang, "settings_off", nil)
+	if settings.DigestSchedule != "" {
+		digest = settings.DigestSchedule
+	}
+
+	textData := struct {
+		ChannelTitle    string
+		AutoReply       string
+		ParseMode       string
+		MatchMode       string
+		FallbackReply   string
+		NotifyUnmatched string
+		Timezone        string
+		Digest          string
+	}{
+		ChannelTitle:    b.channelTitle(ctx, channelID),
+		AutoReply:       onOff(settings.AutoReply),
+		ParseMode:       parseMode,
+		MatchMode:       i18n.GetMessage(lang, "test_mode_"+settings.MatchMode, nil),
+		FallbackReply:   fallback,
+		NotifyUnmatched: onOff(settings.NotifyUnmatched),
+		Timezone:        timezone,
+		Digest:          digest,
+	}
+	text := i18n.GetMessage(lang, "settings_title", textData)
+
+	fallbackRow := []InlineKeyboardButton{
+		{Text: i18n.GetMessage(lang, "settings_fallback_button", nil), CallbackData: b.callbackData("settings", callbackParams{ChannelID: channelID, Value: "fallback"})},
+	}
+	if settings.FallbackReply != "" {
+		fallbackRow = append(fallbackRow, InlineKeyboardButton{
+			Text: i18n.GetMessage(lang, "settings_fallback_clear_button", nil), CallbackData: b.callbackData("settings", callbackParams{ChannelID: channelID, Value: "fbclear"}),
+		})
+	}
+
+	keyboard := InlineKeyboardMarkup{
+		InlineKeyboard: [][]InlineKeyboardButton{
+			{{Text: i18n.GetMessage(lang, "settings_auto_button", textData), CallbackData: b.callbackData("settings", callbackParams{ChannelID: channelID, Value: "auto"})}},
+			{{Text: i18n.GetMessage(lang, "settings_parse_button", textData), CallbackData: b.callbackData("settings", callbackParams{ChannelID: channelID, Value: "parse"})}},
+			{{Text: i18n.GetMessage(lang, "settings_match_button", textData), CallbackData: b.callbackData("settings", callbackParams{ChannelID: channelID, Value: "match"})}},
+			fallbackRow,
+			{{Text: i18n.GetMessage(lang, "settings_notify_button", textData), CallbackData: b.callbackData("settings", callbackParams{ChannelID: channelID, Value: "notify"})}},
+			{
+				{Text: i18n.GetMessage(lang, "settings_digest_button", textData), CallbackData: b.callbackData("settings", callbackParams{ChannelID: channelID, Value: "digest"})},
+				{Text: i18n.GetMessage(lang, "settings_digest_custom_button", nil), CallbackData: b.callbackData("settings", callbackParams{ChannelID: channelID, Value: "digestcustom"})},
+			},
+			{{Text: i18n.GetMessage(lang, "settings_tz_button", textData), CallbackData: b.callbackData("settings", callbackParams{ChannelID: channelID, Value: "tz"})}},
+			{{Text: i18n.GetMessage(lang, "back_to_main_menu_button", nil), CallbackData: "help_main"}},
+		},
+	}
+
+	return b.sendPlainText(ctx, chatID, messageID, text, &keyboard)
+}
+
+// notifyAdminsUnmatched memberi tahu admin channel tentang pesan yang tidak
+// terjawab, dalam bahasa masing-masing admin.
+func (b *Bot) notifyAdminsUnmatched(ctx context.Context, channelID int64, msg *Message) {
+	if !b.notifier.Allow(channelID, time.Now()) {
+		return
+	}
+	admins, err := b.channelAdministrators(ctx, channelID)
+	if err != nil {
+		log.Printf("could not get admins to notify for channel %d: %v", channelID, err)
+		return
+	}
+
+	title := b.channelTitle(ctx, channelID)
+	for _, admin := range admins {
+		if admin.User.IsBot {
+			continue
+		}
+		adminLang := b.getUserLang(ctx, admin.User.ID, admin.User.LangCode)
+		data := struct {
+			ChannelTitle string
+			UserName     string
+			Text         string
+		}{title, msg.From.FirstName, msg.Text}
+		text := i18n.GetMessage(adminLang, "settings_unmatched_notification", data)
+		keyboard := InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{{
+			{Text: i18n.GetMessage(adminLang, "block_button", nil), CallbackData: b.callbackData("block_user", callbackParams{ChannelID: channelID, UserID: msg.From.ID, Value: userLabel(msg.From)})},
+		}}}
+		if err := b.api.SendMessage(ctx, SendMessagePayload{ChatID: admin.User.ID, Text: text, ReplyMarkup: &keyboard}); err != nil {
+			log.Printf("could not notify admin %d about unmatched message: %v", admin.User.ID, err)
+		}
+	}
+}
+
+// flushUnmatchedNotifications mengirim ringkasan pesan tak terjawab yang
+// ditahan oleh UnmatchedNotifier ke admin channel.
+func (b *Bot) flushUnmatchedNotifications(ctx context.Context) {
+	for channelID, count := range b.notifier.drain(time.Now()) {
+		admins, err := b.channelAdministrators(ctx, channelID)
+		if err != nil {
+			log.Printf("could not get admins to notify for channel %d: %v", channelID, err)
+			continue
+		}
+		title := b.channelTitle(ctx, channelID)
+		for _, admin := range admins {
+			if admin.User.IsBot {
+				continue
+			}
+			adminLang := b.getUserLang(ctx, admin.User.ID, admin.User.LangCode)
+			text := i18n.GetMessage(adminLang, "settings_unmatched_summary", struct {
+				ChannelTitle string
+				Count        int
+			}{title, count})
+			if err := b.api.SendMessage(ctx, SendMessagePayload{ChatID: admin.User.ID, Text: text}); err != nil {
+				log.Printf("could not notify admin %d about unmatched messages: %v", admin.User.ID, err)
+			}
+		}
+	}
+}
+
+// unmatchedNotifyInterval adalah jarak minimum antar notifikasi pesan tak
+// terjawab per channel.
+const unmatchedNotifyInterval = time.Minute
+
+type unmatchedWindow struct {
+	started    time.Time
+	suppressed int
+}
+
+// UnmatchedNotifier membatasi notifikasi pesan tak terjawab: pesan pertama
+// diteruskan langsung ke admin, pesan berikutnya dalam unmatchedNotifyInterval
+// hanya dihitung lalu dikirim sebagai satu ringkasan. Tanpa ini channel yang
+// ramai memanggil getChatAdministrators dan mengirim ke semua admin per pesan.
+type UnmatchedNotifier struct {
+	mu       sync.Mutex
+	channels map[int64]*unmatchedWindow
+}
+
+func NewUnmatchedNotifier() *UnmatchedNotifier {
+	return &UnmatchedNotifier{channels: make(map[int64]*unmatchedWindow)}
+}
+
+// Allow melaporkan apakah pesan boleh langsung diteruskan ke admin.
+func (n *UnmatchedNotifier) Allow(channelID int64, at time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	// Jendela yang masih menahan pesan tetap aktif sampai ringkasannya terkirim
+	if w, found := n.channels[channelID]; found && (at.Sub(w.started) < unmatchedNotifyInterval || w.suppressed > 0) {
+		w.suppressed++
+		return false
+	}
+	n.channels[channelID] = &unmatchedWindow{started: at}
+	return true
+}
+
+// drain mengembalikan jumlah pesan yang ditahan per channel yang jendelanya
+// sudah lewat, dan menutup jendela tersebut.
+func (n *UnmatchedNotifier) drain(at time.Time) map[int64]int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	counts := make(map[int64]int)
+	for channelID, w := range n.channels {
+		if at.Sub(w.started) < unmatchedNotifyInterval {
+			continue
+		}
+		if w.suppressed > 0 {
+			counts[channelID] = w.suppressed
+		}
+		delete(n.channels, channelID)
+	}
+	return counts
+}
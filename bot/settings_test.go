@@ -0,0 +1,38 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUnmatchedNotifier(t *testing.T) {
+	n := NewUnmatchedNotifier()
+	start := time.Now()
+
+	if !n.Allow(testChannelID, start) {
+		t.Fatal("first unmatched message was not forwarded")
+	}
+	for i := 1; i <= 3; i++ {
+		if n.Allow(testChannelID, start.Add(time.Duration(i)*time.Second)) {
+			t.Fatalf("message %d inside the interval was forwarded", i)
+		}
+	}
+	if !n.Allow(-1002, start) {
+		t.Error("another channel was throttled")
+	}
+
+	if counts := n.drain(start.Add(time.Second)); len(counts) != 0 {
+		t.Errorf("drain inside the interval = %v, want nothing", counts)
+	}
+	// Pesan setelah jendela lewat tetap ditahan sampai ringkasan terkirim
+	if n.Allow(testChannelID, start.Add(2*unmatchedNotifyInterval)) {
+		t.Error("message was forwarded before the summary was sent")
+	}
+	counts := n.drain(start.Add(2 * unmatchedNotifyInterval))
+	if counts[testChannelID] != 4 || len(counts) != 1 {
+		t.Errorf("drain = %v, want 4 held messages for channel %d", counts, testChannelID)
+	}
+	if !n.Allow(testChannelID, start.Add(2*unmatchedNotifyInterval)) {
+		t.Error("message after the summary was not forwarded")
+	}
+}
@@ -2,6 +2,8 @@ package bot
 
 import (
 	"sync"
+
+	"telegram-dm-bot/storage"
 )
 
 type UserState struct {
@@ -10,6 +12,18 @@ type UserState struct {
 	ChannelTitle string
 	Trigger      string
 	ResponseType string
+
+	// Dipakai oleh alur salin trigger antar channel
+	TargetChannelID int64
+	SelectedIDs     []int64
+
+	// Draf pesan alur /broadcast yang menunggu konfirmasi
+	Draft storage.TriggerRecord
+
+	// Subscriber yang catatan/tag-nya sedang diubah di direktori
+	SubscriberID int64
+	// Pencarian direktori yang sedang aktif, untuk kembali ke halaman yang sama
+	Query string
 }
 
 type StateManager struct {
@@ -0,0 +1,432 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+const (
+	statsFlushInterval = time.Minute
+	statsTopLimit      = 10
+	statsDayFormat     = "2006-01-02"
+	// statsNeverHitChars membatasi panjang daftar trigger yang belum pernah
+	// cocok agar pesan tetap di bawah batas 4096 karakter Telegram.
+	statsNeverHitChars = 1000
+)
+
+type hitKey struct {
+	ChannelID int64
+	TriggerID int64
+	Day       string
+	Lang      string
+}
+
+type hitUserKey struct {
+	ChannelID int64
+	TriggerID int64
+	Day       string
+	UserID    int64
+}
+
+// HitCounter mengumpulkan hitungan trigger di memori agar balasan DM tidak
+// perlu menulis ke database untuk setiap pesan. Isinya di-flush berkala.
+type HitCounter struct {
+	mu      sync.Mutex
+	hits    map[hitKey]int
+	users   map[hitUserKey]struct{}
+	flushMu sync.Mutex // hanya satu flush yang boleh berjalan
+}
+
+func NewHitCounter() *HitCounter {
+	return &HitCounter{
+		hits:  make(map[hitKey]int),
+		users: make(map[hitUserKey]struct{}),
+	}
+}
+
+// Record mencatat satu kecocokan trigger.
+func (c *HitCounter) Record(channelID, triggerID, userID int64, lang string, at time.Time) {
+	if lang == "" {
+		lang = "unknown"
+	}
+	day := at.UTC().Format(statsDayFormat)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hits[hitKey{channelID, triggerID, day, lang}]++
+	c.users[hitUserKey{channelID, triggerID, day, userID}] = struct{}{}
+}
+
+// drain mengosongkan penampung dan mengembalikan isinya.
+func (c *HitCounter) drain() (map[hitKey]int, map[hitUserKey]struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hits, users := c.hits, c.users
+	c.hits = make(map[hitKey]int)
+	c.users = make(map[hitUserKey]struct{})
+	return hits, users
+}
+
+// requeue mengembalikan hitungan yang gagal disimpan agar dicoba lagi di flush berikutnya.
+func (c *HitCounter) requeue(key hitKey, hits int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hits[key] += hits
+}
+
+func (c *HitCounter) requeueUsers(users map[hitUserKey]struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range users {
+		c.users[key] = struct{}{}
+	}
+}
+
+// pending mengembalikan salinan hitungan channel yang belum disimpan, mulai
+// dari hari sinceDay (kosong berarti semua).
+func (c *HitCounter) pending(channelID int64, sinceDay string) ([]storage.TriggerHitCount, []storage.TriggerHitUser) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var hits []storage.TriggerHitCount
+	for key, n := range c.hits {
+		if key.ChannelID == channelID && key.Day >= sinceDay {
+			hits = append(hits, storage.TriggerHitCount{ChannelID: key.ChannelID, TriggerID: key.TriggerID, Day: key.Day, Lang: key.Lang, Hits: n})
+		}
+	}
+	var users []storage.TriggerHitUser
+	for key := range c.users {
+		if key.ChannelID == channelID && key.Day >= sinceDay {
+			users = append(users, storage.TriggerHitUser{ChannelID: key.ChannelID, TriggerID: key.TriggerID, Day: key.Day, UserID: key.UserID})
+		}
+	}
+	return hits, users
+}
+
+func (b *Bot) runStatsFlusher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastPrune := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			// Penyimpanan terakhir dilakukan oleh shutdown
+			return
+		case <-ticker.C:
+			b.flushStats(ctx)
+			b.flushUnanswered(ctx)
+			b.flushActivity(ctx)
+			b.flushCallbacks(ctx)
+			b.flushUnmatchedNotifications(ctx)
+			if time.Since(lastPrune) >= processedUpdatePruneEvery {
+				b.pruneProcessedUpdates(ctx)
+				b.pruneCallbackTokens(ctx)
+				lastPrune = time.Now()
+			}
+		}
+	}
+}
+
+// flushStats menyimpan semua hitungan yang tertunda ke storage.
+func (b *Bot) flushStats(ctx context.Context) {
+	b.hits.flushMu.Lock()
+	defer b.hits.flushMu.Unlock()
+
+	hits, users := b.hits.drain()
+	failed := 0
+	for key, n := range hits {
+		count := storage.TriggerHitCount{ChannelID: key.ChannelID, TriggerID: key.TriggerID, Day: key.Day, Lang: key.Lang, Hits: n}
+		if err := b.store.AddTriggerHits(ctx, count); err != nil {
+			b.hits.requeue(key, n)
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Printf("failed to flush %d of %d trigger hit counters, will retry", failed, len(hits))
+	}
+
+	if len(users) == 0 {
+		return
+	}
+	var rows []storage.TriggerHitUser
+	for key := range users {
+		rows = append(rows, storage.TriggerHitUser{ChannelID: key.ChannelID, TriggerID: key.TriggerID, Day: key.Day, UserID: key.UserID})
+	}
+	if err := b.store.AddTriggerHitUsers(ctx, rows); err != nil {
+		log.Printf("failed to flush trigger hit users, will retry: %v", err)
+		b.hits.requeueUsers(users)
+	}
+}
+
+// channelTriggerHits menggabungkan hitungan yang sudah tersimpan dengan yang
+// masih di memori, tanpa memaksa flush untuk setiap tampilan.
+func (b *Bot) channelTriggerHits(ctx context.Context, channelID int64, since time.Time) ([]storage.TriggerHitCount, error) {
+	counts, err := b.store.GetTriggerHits(ctx, channelID, since)
+	if err != nil {
+		return nil, err
+	}
+	pending, _ := b.hits.pending(channelID, statsSinceDay(since))
+	return append(counts, pending...), nil
+}
+
+// channelTriggerHitUsers sama seperti channelTriggerHits untuk user unik.
+func (b *Bot) channelTriggerHitUsers(ctx context.Context, channelID int64, since time.Time) ([]storage.TriggerHitUser, error) {
+	users, err := b.store.GetTriggerHitUsers(ctx, channelID, since)
+	if err != nil {
+		return nil, err
+	}
+	_, pending := b.hits.pending(channelID, statsSinceDay(since))
+	return append(users, pending...), nil
+}
+
+func statsSinceDay(since time.Time) string {
+	if since.IsZero() {
+		return ""
+	}
+	return since.UTC().Format(statsDayFormat)
+}
+
+// triggerHitTotals menjumlahkan semua hit per trigger sejak awal pencatatan.
+func (b *Bot) triggerHitTotals(ctx context.Context, channelID int64) (map[int64]int, error) {
+	counts, err := b.channelTriggerHits(ctx, channelID, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	totals := make(map[int64]int)
+	for _, c := range counts {
+		totals[c.TriggerID] += c.Hits
+	}
+	return totals, nil
+}
+
+func (b *Bot) handleStatsCommand(ctx context.Context, msg *Message, lang string) error {
+	return b.sendChannelPicker(ctx, msg, lang, "stats", storage.RoleViewer, "stats_prompt")
+}
+
+func (b *Bot) handleStatsCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	days := p.Days
+	if days != 7 && days != 30 {
+		days = 7
+	}
+	return b.sendStats(ctx, cb.Message.Chat.ID, cb.Message.ID, lang, p.ChannelID, days)
+}
+
+type triggerStat struct {
+	TriggerID int64
+	Trigger   string
+	Hits      int
+	Users     int
+}
+
+// sendStats menampilkan trigger teratas, tren harian, pembagian bahasa dan
+// trigger yang belum pernah cocok untuk rentang hari tertentu.
+func (b *Bot) sendStats(ctx context.Context, chatID int64, messageID int, lang string, channelID int64, days int) error {
+	triggers, err := b.store.GetTriggersByChannel(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	// Semua hitungan diambil agar trigger yang belum pernah cocok bisa diketahui
+	counts, err := b.channelTriggerHits(ctx, channelID, time.Time{})
+	if err != nil {
+		log.Printf("error getting trigger hits for channel %d: %v", channelID, err)
+		return err
+	}
+
+	now := time.Now().UTC()
+	since := now.AddDate(0, 0, -(days - 1))
+	sinceDay := since.Format(statsDayFormat)
+	hitUsers, err := b.channelTriggerHitUsers(ctx, channelID, since)
+	if err != nil {
+		log.Printf("error getting trigger hit users for channel %d: %v", channelID, err)
+		return err
+	}
+
+	everHit := make(map[int64]bool)
+	perTrigger := make(map[int64]*triggerStat)
+	perDay := make(map[string]int)
+	perLang := make(map[string]int)
+	total := 0
+	for _, c := range counts {
+		everHit[c.TriggerID] = true
+		if c.Day < sinceDay {
+			continue
+		}
+		total += c.Hits
+		perDay[c.Day] += c.Hits
+		perLang[c.Lang] += c.Hits
+		if perTrigger[c.TriggerID] == nil {
+			perTrigger[c.TriggerID] = &triggerStat{TriggerID: c.TriggerID}
+		}
+		perTrigger[c.TriggerID].Hits += c.Hits
+	}
+
+	uniqueUsers := make(map[int64]bool)
+	triggerUsers := make(map[int64]map[int64]bool)
+	for _, u := range hitUsers {
+		uniqueUsers[u.UserID] = true
+		if triggerUsers[u.TriggerID] == nil {
+			triggerUsers[u.TriggerID] = make(map[int64]bool)
+		}
+		triggerUsers[u.TriggerID][u.UserID] = true
+	}
+
+	triggerText := make(map[int64]string)
+	var neverHit []string
+	for _, t := range triggers {
+		triggerText[t.ID] = t.TriggerText
+		if !everHit[t.ID] {
+			neverHit = append(neverHit, t.TriggerText)
+		}
+	}
+
+	var top []triggerStat
+	for id, stat := range perTrigger {
+		text, exists := triggerText[id]
+		if !exists {
+			// Trigger sudah dihapus; hitungannya tetap masuk total
+			continue
+		}
+		stat.Trigger = text
+		stat.Users = len(triggerUsers[id])
+		top = append(top, *stat)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Hits != top[j].Hits {
+			return top[i].Hits > top[j].Hits
+		}
+		return top[i].Trigger < top[j].Trigger
+	})
+	if len(top) > statsTopLimit {
+		top = top[:statsTopLimit]
+	}
+
+	var series []int
+	for d := since; !d.After(now); d = d.AddDate(0, 0, 1) {
+		series = append(series, perDay[d.Format(statsDayFormat)])
+	}
+
+	var textBuilder strings.Builder
+	textBuilder.WriteString(i18n.GetMessage(lang, "stats_title", struct {
+		ChannelTitle string
+		Days         int
+	}{b.channelTitle(ctx, channelID), days}))
+	textBuilder.WriteString("\n\n")
+	textBuilder.WriteString(i18n.GetMessage(lang, "stats_totals", struct{ Hits, Users int }{total, len(uniqueUsers)}))
+	textBuilder.WriteString("\n")
+	textBuilder.WriteString(i18n.GetMessage(lang, "stats_trend", struct {
+		Sparkline string
+		From, To  string
+	}{sparkline(series), since.Format("01-02"), now.Format("01-02")}))
+	textBuilder.WriteString("\n\n")
+
+	textBuilder.WriteString(i18n.GetMessage(lang, "stats_top_header", nil))
+	textBuilder.WriteString("\n")
+	if len(top) == 0 {
+		textBuilder.WriteString(i18n.GetMessage(lang, "stats_no_hits", nil))
+		textBuilder.WriteString("\n")
+	}
+	for i, stat := range top {
+		textBuilder.WriteString(i18n.GetMessage(lang, "stats_top_entry", struct {
+			Rank    int
+			Trigger string
+			Hits    int
+			Users   int
+		}{i + 1, stat.Trigger, stat.Hits, stat.Users}))
+		textBuilder.WriteString("\n")
+	}
+
+	if len(perLang) > 0 {
+		var langs []string
+		for l := range perLang {
+			langs = append(langs, l)
+		}
+		sort.Slice(langs, func(i, j int) bool { return perLang[langs[i]] > perLang[langs[j]] })
+		var parts []string
+		for _, l := range langs {
+			parts = append(parts, fmt.Sprintf("%s %d", l, perLang[l]))
+		}
+		textBuilder.WriteString("\n")
+		textBuilder.WriteString(i18n.GetMessage(lang, "stats_languages", struct{ Languages string }{strings.Join(parts, ", ")}))
+		textBuilder.WriteString("\n")
+	}
+
+	if len(neverHit) > 0 {
+		shown, rest := joinLimited(neverHit, ", ", statsNeverHitChars)
+		textBuilder.WriteString("\n")
+		textBuilder.WriteString(i18n.GetMessage(lang, "stats_never_hit", struct {
+			Count    int
+			Triggers string
+		}{len(neverHit), shown}))
+		if rest > 0 {
+			textBuilder.WriteString(" ")
+			textBuilder.WriteString(i18n.GetMessage(lang, "stats_never_hit_more", struct{ Count int }{rest}))
+		}
+	}
+
+	otherDays := 30
+	if days == 30 {
+		otherDays = 7
+	}
+	keyboard := InlineKeyboardMarkup{
+		InlineKeyboard: [][]InlineKeyboardButton{
+			{{Text: i18n.GetMessage(lang, "stats_range_button", struct{ Days int }{otherDays}), CallbackData: b.callbackData("stats", callbackParams{ChannelID: channelID, Days: otherDays})}},
+			{{Text: i18n.GetMessage(lang, "back_button", nil), CallbackData: b.callbackData("manage", callbackParams{ChannelID: channelID, Page: 1})}},
+		},
+	}
+
+	return b.sendPlainText(ctx, chatID, messageID, textBuilder.String(), &keyboard)
+}
+
+// sparkline menggambar deret angka sebagai satu baris batang Unicode.
+func sparkline(values []int) string {
+	bars := []rune("▁▂▃▄▅▆▇█")
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	var sb strings.Builder
+	for _, v := range values {
+		if max == 0 {
+			sb.WriteRune(bars[0])
+			continue
+		}
+		sb.WriteRune(bars[v*(len(bars)-1)/max])
+	}
+	return sb.String()
+}
+
+// joinLimited menggabungkan item selama hasilnya tidak melebihi maxChars
+// karakter, dan mengembalikan jumlah item yang tidak ikut ditampilkan.
+func joinLimited(items []string, sep string, maxChars int) (string, int) {
+	var builder strings.Builder
+	length := 0
+	for i, item := range items {
+		add := utf8.RuneCountInString(item)
+		if i > 0 {
+			add += utf8.RuneCountInString(sep)
+		}
+		if length+add > maxChars {
+			if i == 0 {
+				// Item pertama tetap ditampilkan meski harus dipotong
+				return string([]rune(item)[:maxChars]) + "...", len(items) - 1
+			}
+			return builder.String(), len(items) - i
+		}
+		if i > 0 {
+			builder.WriteString(sep)
+		}
+		builder.WriteString(item)
+		length += add
+	}
+	return builder.String(), 0
+}
@@ -0,0 +1,29 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJoinLimited(t *testing.T) {
+	tests := []struct {
+		name     string
+		items    []string
+		maxChars int
+		want     string
+		wantRest int
+	}{
+		{name: "fits", items: []string{"a", "b", "c"}, maxChars: 10, want: "a, b, c"},
+		{name: "cut between items", items: []string{"hello", "world", "again"}, maxChars: 12, want: "hello, world", wantRest: 1},
+		{name: "first item too long", items: []string{strings.Repeat("x", 8), "y"}, maxChars: 5, want: "xxxxx...", wantRest: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest := joinLimited(tt.items, ", ", tt.maxChars)
+			if got != tt.want || rest != tt.wantRest {
+				t.Errorf("joinLimited() = %q, %d; want %q, %d", got, rest, tt.want, tt.wantRest)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ type Update struct {
 	ID            int           `json:"update_id"`
 	Message       *Message      `json:"message,omitempty"`
 	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
+	MyChatMember  *ChatMemberUpdated `json:"my_chat_member,omitempty"`
 }
 
 type Message struct {
@@ -17,6 +18,8 @@ type Message struct {
 	Text                string              `json:"text"`
 	Caption             string              `json:"caption,omitempty"`
 	ForwardFromChat     *Chat               `json:"forward_from_chat,omitempty"` // <-- TAMBAHKAN INI // <-- TAMBAHKAN INI
+	ForwardFrom         *User               `json:"forward_from,omitempty"`
+	ForwardOrigin       *MessageOrigin      `json:"forward_origin,omitempty"`
 	Photo               []*PhotoSize        `json:"photo,omitempty"` // Tambahkan ini
 	Sticker             *Sticker            `json:"sticker,omitempty"`
 	Document            *Document           `json:"document,omitempty"`
@@ -42,14 +45,32 @@ type Chat struct {
 	IsDirectMessages bool   `json:"is_direct_messages,omitempty"`
 }
 
+// MessageOrigin menjelaskan pengirim asli pesan yang diteruskan. Untuk
+// "hidden_user" hanya nama pengirim yang tersedia.
+type MessageOrigin struct {
+	Type           string `json:"type"`
+	SenderUser     *User  `json:"sender_user,omitempty"`
+	SenderUserName string `json:"sender_user_name,omitempty"`
+}
+
 type DirectMessagesTopic struct {
 	TopicID int  `json:"topic_id"`
 	User    User `json:"user,omitempty"`
 }
 
 type ApiResponse struct {
-	Ok     bool            `json:"ok"`
-	Result json.RawMessage `json:"result"`
+	Ok          bool                `json:"ok"`
+	Result      json.RawMessage     `json:"result"`
+	ErrorCode   int                 `json:"error_code,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Parameters  *ResponseParameters `json:"parameters,omitempty"`
+}
+
+// ResponseParameters menjelaskan kenapa permintaan gagal, misalnya berapa detik
+// harus menunggu setelah terkena batas kecepatan (429).
+type ResponseParameters struct {
+	RetryAfter      int   `json:"retry_after,omitempty"`
+	MigrateToChatID int64 `json:"migrate_to_chat_id,omitempty"`
 }
 
 type ChatMember struct {
@@ -57,6 +78,15 @@ type ChatMember struct {
 	Status string `json:"status"`
 }
 
+// ChatMemberUpdated dikirim Telegram ketika status bot di sebuah chat berubah
+type ChatMemberUpdated struct {
+	Chat          Chat       `json:"chat"`
+	From          User       `json:"from"`
+	Date          int        `json:"date"`
+	OldChatMember ChatMember `json:"old_chat_member"`
+	NewChatMember ChatMember `json:"new_chat_member"`
+}
+
 type GetChatResponse struct {
 	ID         int64       `json:"id"`
 	Title      string      `json:"title"` // Tambahkan Title
@@ -103,6 +133,16 @@ type EditMessageTextPayload struct {
 	ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
 }
 
+type SetWebhookPayload struct {
+	URL            string   `json:"url"`
+	SecretToken    string   `json:"secret_token,omitempty"`
+	AllowedUpdates []string `json:"allowed_updates,omitempty"`
+}
+
+type DeleteWebhookPayload struct {
+	DropPendingUpdates bool `json:"drop_pending_updates,omitempty"`
+}
+
 type AnswerCallbackQueryPayload struct {
 	CallbackQueryID string `json:"callback_query_id"`
 	Text            string `json:"text,omitempty"`
@@ -135,6 +175,7 @@ type SendDocumentPayload struct {
 	ChatID                int64  `json:"chat_id"`
 	Document              string `json:"document"`
 	Caption               string `json:"caption,omitempty"`
+	ParseMode             string `json:"parse_mode,omitempty"`
 	DirectMessagesTopicID int    `json:"direct_messages_topic_id,omitempty"`
 }
 
@@ -142,6 +183,7 @@ type SendAnimationPayload struct {
 	ChatID                int64  `json:"chat_id"`
 	Animation             string `json:"animation"`
 	Caption               string `json:"caption,omitempty"`
+	ParseMode             string `json:"parse_mode,omitempty"`
 	DirectMessagesTopicID int    `json:"direct_messages_topic_id,omitempty"`
 }
 
@@ -149,6 +191,7 @@ type SendAudioPayload struct {
 	ChatID                int64  `json:"chat_id"`
 	Audio                 string `json:"audio"`
 	Caption               string `json:"caption,omitempty"`
+	ParseMode             string `json:"parse_mode,omitempty"`
 	DirectMessagesTopicID int    `json:"direct_messages_topic_id,omitempty"`
 }
 
@@ -0,0 +1,187 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+const unansweredPageSize = 8
+
+type unansweredKey struct {
+	ChannelID  int64
+	Normalized string
+}
+
+// UnansweredBuffer menampung pesan yang tidak terjawab di memori sampai
+// di-flush bersama statistik trigger.
+type UnansweredBuffer struct {
+	mu      sync.Mutex
+	queries map[unansweredKey]storage.UnansweredQuery
+	flushMu sync.Mutex // hanya satu flush yang boleh berjalan
+}
+
+func NewUnansweredBuffer() *UnansweredBuffer {
+	return &UnansweredBuffer{queries: make(map[unansweredKey]storage.UnansweredQuery)}
+}
+
+// Record menambahkan satu pesan; pesan dengan bentuk normal yang sama digabung.
+func (u *UnansweredBuffer) Record(channelID int64, text string, at time.Time) {
+	normalized := normalizeUnanswered(text)
+	if normalized == "" {
+		return
+	}
+	key := unansweredKey{channelID, normalized}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	query, found := u.queries[key]
+	if !found {
+		query = storage.UnansweredQuery{ChannelID: channelID, Normalized: normalized, FirstSeen: at}
+	}
+	query.SampleText = text
+	query.Count++
+	query.LastSeen = at
+	u.queries[key] = query
+}
+
+func (u *UnansweredBuffer) drain() map[unansweredKey]storage.UnansweredQuery {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	queries := u.queries
+	u.queries = make(map[unansweredKey]storage.UnansweredQuery)
+	return queries
+}
+
+// requeue mengembalikan query yang gagal disimpan tanpa menimpa pesan yang
+// masuk selama flush berlangsung.
+func (u *UnansweredBuffer) requeue(key unansweredKey, query storage.UnansweredQuery) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if newer, found := u.queries[key]; found {
+		query.Count += newer.Count
+		query.SampleText = newer.SampleText
+		query.LastSeen = newer.LastSeen
+	}
+	u.queries[key] = query
+}
+
+func (b *Bot) flushUnanswered(ctx context.Context) {
+	b.unanswered.flushMu.Lock()
+	defer b.unanswered.flushMu.Unlock()
+
+	queries := b.unanswered.drain()
+	failed := 0
+	for key, query := range queries {
+		if err := b.store.AddUnansweredQuery(ctx, query); err != nil {
+			b.unanswered.requeue(key, query)
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Printf("failed to flush %d of %d unanswered queries, will retry", failed, len(queries))
+	}
+}
+
+// normalizeUnanswered menyamakan variasi penulisan sederhana: huruf besar/kecil,
+// tanda baca dan spasi berlebih.
+func normalizeUnanswered(text string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return ' '
+		}
+		return unicode.ToLower(r)
+	}, text)
+	return strings.Join(strings.Fields(cleaned), " ")
+}
+
+func (b *Bot) handleUnansweredCommand(ctx context.Context, msg *Message, lang string) error {
+	return b.sendChannelPicker(ctx, msg, lang, "unanswered", storage.RoleEditor, "unanswered_prompt")
+}
+
+func (b *Bot) handleUnansweredCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	return b.sendUnanswered(ctx, cb.Message.Chat.ID, cb.Message.ID, lang, p.ChannelID, p.Page)
+}
+
+// handleUnansweredLearnCallback memulai alur /learn dengan teks pesan yang sudah
+// dinormalisasi sebagai triggernya, sehingga semua varian dalam grup ikut cocok.
+func (b *Bot) handleUnansweredLearnCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	b.states.SetState(cb.From.ID, &UserState{
+		Step: "awaiting_response_type", ChannelID: p.ChannelID, Trigger: p.Value,
+	})
+	b.api.AnswerCallbackQuery(ctx, AnswerCallbackQueryPayload{CallbackQueryID: cb.ID})
+	return b.sendResponseTypePrompt(ctx, cb.Message.Chat.ID, lang, p.Value)
+}
+
+func (b *Bot) handleUnansweredDismissCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	if err := b.store.DeleteUnansweredQuery(ctx, p.ChannelID, p.Value); err != nil {
+		log.Printf("failed to dismiss unanswered query in channel %d: %v", p.ChannelID, err)
+		return err
+	}
+	return b.sendUnanswered(ctx, cb.Message.Chat.ID, cb.Message.ID, lang, p.ChannelID, p.Page)
+}
+
+// sendUnanswered menampilkan pesan yang tidak terjawab, yang paling sering lebih dulu.
+func (b *Bot) sendUnanswered(ctx context.Context, chatID int64, messageID int, lang string, channelID int64, page int) error {
+	b.flushUnanswered(ctx)
+
+	if page < 1 {
+		page = 1
+	}
+	queries, err := b.store.GetUnansweredQueries(ctx, channelID, (page-1)*unansweredPageSize, unansweredPageSize+1)
+	if err != nil {
+		log.Printf("error getting unanswered queries for channel %d: %v", channelID, err)
+		return err
+	}
+	hasNext := len(queries) > unansweredPageSize
+	if hasNext {
+		queries = queries[:unansweredPageSize]
+	}
+
+	var textBuilder strings.Builder
+	textBuilder.WriteString(i18n.GetMessage(lang, "unanswered_title", struct {
+		ChannelTitle string
+		Page         int
+	}{b.channelTitle(ctx, channelID), page}))
+	textBuilder.WriteString("\n\n")
+	if len(queries) == 0 {
+		textBuilder.WriteString(i18n.GetMessage(lang, "unanswered_empty", nil))
+	}
+
+	var keyboard [][]InlineKeyboardButton
+	for i, query := range queries {
+		number := (page-1)*unansweredPageSize + i + 1
+		textBuilder.WriteString(i18n.GetMessage(lang, "unanswered_entry", struct {
+			Number   int
+			Text     string
+			Count    int
+			LastSeen string
+		}{number, query.SampleText, query.Count, query.LastSeen.Format("2006-01-02 15:04")}))
+		textBuilder.WriteString("\n")
+
+		keyboard = append(keyboard, []InlineKeyboardButton{
+			{Text: fmt.Sprintf("➕ #%d", number), CallbackData: b.callbackData("unanswered_learn", callbackParams{ChannelID: channelID, Value: query.Normalized})},
+			{Text: fmt.Sprintf("🗑 #%d", number), CallbackData: b.callbackData("unanswered_dismiss", callbackParams{ChannelID: channelID, Value: query.Normalized, Page: page})},
+		})
+	}
+
+	var navRow []InlineKeyboardButton
+	if page > 1 {
+		navRow = append(navRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "prev_button", nil), CallbackData: b.callbackData("unanswered", callbackParams{ChannelID: channelID, Page: page - 1})})
+	}
+	if hasNext {
+		navRow = append(navRow, InlineKeyboardButton{Text: i18n.GetMessage(lang, "next_button", nil), CallbackData: b.callbackData("unanswered", callbackParams{ChannelID: channelID, Page: page + 1})})
+	}
+	if len(navRow) > 0 {
+		keyboard = append(keyboard, navRow)
+	}
+
+	return b.sendPlainText(ctx, chatID, messageID, textBuilder.String(), &InlineKeyboardMarkup{InlineKeyboard: keyboard})
+}
@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"telegram-dm-bot/i18n"
+	"telegram-dm-bot/storage"
+)
+
+func (b *Bot) handleUnregisterCommand(ctx context.Context, msg *Message, lang string) error {
+	return b.sendChannelPicker(ctx, msg, lang, "unreg", storage.RoleOwner, "unregister_prompt")
+}
+
+func (b *Bot) handleUnregisterCancelCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	text := i18n.GetMessage(lang, "cancel_message", nil)
+	return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: cb.Message.Chat.ID, MessageID: cb.Message.ID, Text: text})
+}
+
+// handleUnregisterCallback menangani konfirmasi (Value kosong dari pemilih channel) serta pilihan "keep"
+// dan "purge"; aksinya ada di p.Value.
+func (b *Bot) handleUnregisterCallback(ctx context.Context, cb *CallbackQuery, lang string, p callbackParams) error {
+	userID := cb.From.ID
+	chatID := cb.Message.Chat.ID
+	messageID := cb.Message.ID
+	action := p.Value
+	channelID := p.ChannelID
+
+	title := b.channelTitle(ctx, channelID)
+	textData := struct{ ChannelTitle string }{title}
+
+	switch action {
+	case "":
+		text := i18n.GetMessage(lang, "unregister_confirm", textData)
+		keyboard := InlineKeyboardMarkup{
+			InlineKeyboard: [][]InlineKeyboardButton{
+				{{Text: i18n.GetMessage(lang, "unregister_keep_button", nil), CallbackData: b.callbackData("unreg", callbackParams{ChannelID: channelID, Value: "keep"})}},
+				{{Text: i18n.GetMessage(lang, "unregister_purge_button", nil), CallbackData: b.callbackData("unreg", callbackParams{ChannelID: channelID, Value: "purge"})}},
+				{{Text: i18n.GetMessage(lang, "cancel_delete_button", nil), CallbackData: "unreg_cancel"}},
+			},
+		}
+		return b.api.EditMessageText(ctx, EditMessageTextPayload{
+			ChatID: chatID, MessageID: messageID, Text: text, ParseMode: "Markdown", ReplyMarkup: &keyboard,
+		})
+
+	case "keep", "purge":
+		if err := b.unregisterChannel(ctx, channelID, userID, action == "purge"); err != nil {
+			log.Printf("failed to unregister channel %d: %v", channelID, err)
+			return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: chatID, MessageID: messageID, Text: "An error occurred."})
+		}
+		log.Printf("user %d unregistered channel %d (purge: %t)", userID, channelID, action == "purge")
+
+		text := i18n.GetMessage(lang, "unregister_success_"+action, textData)
+		return b.api.EditMessageText(ctx, EditMessageTextPayload{ChatID: chatID, MessageID: messageID, Text: text, ParseMode: "Markdown"})
+	}
+
+	return nil
+}
+
+// unregisterChannel menghapus pendaftaran channel, dan jika purge bernilai true
+// juga semua trigger serta data lain milik channel tersebut. Log audit
+// sengaja tidak ikut dihapus.
+func (b *Bot) unregisterChannel(ctx context.Context, channelID, actorID int64, purge bool) error {
+	title := strconv.FormatInt(channelID, 10)
+	if channel, found, err := b.store.GetRegisteredChannel(ctx, channelID); err == nil && found {
+		title = channel.Title
+	}
+
+	if purge {
+		if err := b.store.PurgeChannelData(ctx, channelID); err != nil {
+			return err
+		}
+	}
+	if err := b.store.UnregisterChannel(ctx, channelID); err != nil {
+		return err
+	}
+	b.cache.RemoveChannel(channelID)
+	b.triggers.Invalidate(channelID)
+
+	after := "keep"
+	if purge {
+		after = "purge"
+	}
+	b.recordAudit(ctx, channelID, actorID, storage.AuditUnregister, title, "", after)
+	return nil
+}
+
+// channelAdministrators mengambil admin channel. Jika Telegram menjawab 403,
+// bot sudah tidak punya akses ke channel itu, jadi channel di-unregister seperti
+// saat bot dikeluarkan; trigger tetap disimpan.
+func (b *Bot) channelAdministrators(ctx context.Context, channelID int64) ([]ChatMember, error) {
+	admins, err := b.api.GetChatAdministrators(ctx, channelID)
+	if err == nil || !IsForbidden(err) {
+		return admins, err
+	}
+	registered, checkErr := b.store.IsChannelRegistered(ctx, channelID)
+	if checkErr != nil || !registered {
+		return nil, err
+	}
+	log.Printf("bot lost access to channel %d (%v), unregistering it", channelID, err)
+	if unregErr := b.unregisterChannel(ctx, channelID, 0, false); unregErr != nil {
+		log.Printf("failed to unregister channel %d after losing access: %v", channelID, unregErr)
+	}
+	return nil, err
+}
+
+// handleMyChatMember otomatis meng-unregister channel ketika bot dikeluarkan.
+// Trigger tetap disimpan agar tidak hilang jika bot ditambahkan kembali.
+func (b *Bot) handleMyChatMember(ctx context.Context, update *ChatMemberUpdated) error {
+	if update.Chat.Type != "channel" {
+		return nil
+	}
+	status := update.NewChatMember.Status
+	if status != "left" && status != "kicked" {
+		return nil
+	}
+
+	// Bot juga bisa dikeluarkan dari channel yang tidak pernah didaftarkan;
+	// channel itu tidak perlu dihapus dan tidak dicatat di log audit
+	registered, err := b.store.IsChannelRegistered(ctx, update.Chat.ID)
+	if err != nil || !registered {
+		return err
+	}
+	log.Printf("bot was removed from channel %d (status: %s), unregistering it", update.Chat.ID, status)
+	return b.unregisterChannel(ctx, update.Chat.ID, update.From.ID, false)
+}
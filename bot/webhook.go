@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	webhookSecretHeader   = "X-Telegram-Bot-Api-Secret-Token"
+	webhookMaxBodyBytes   = 1 << 20
+	webhookShutdownPeriod = 10 * time.Second
+)
+
+// webhookAllowedUpdates adalah jenis update yang ditangani handleUpdate.
+var webhookAllowedUpdates = []string{"message", "callback_query", "my_chat_member"}
+
+// webhookHandler menerima update dari Telegram lewat HTTP dan meneruskannya ke
+// dispatcher yang sama dengan mode polling. Permintaan tanpa secret token yang
+// benar ditolak.
+func (b *Bot) webhookHandler(secret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(webhookSecretHeader)), []byte(secret)) != 1 {
+			log.Printf("rejected webhook request from %s: invalid secret token", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, webhookMaxBodyBytes))
+		if err != nil {
+			http.Error(w, "could not read body", http.StatusBadRequest)
+			return
+		}
+		var update Update
+		if err := json.Unmarshal(body, &update); err != nil {
+			log.Printf("rejected webhook request: invalid update: %v", err)
+			http.Error(w, "invalid update", http.StatusBadRequest)
+			return
+		}
+
+		// Jawab setelah update masuk antrean; jika gagal, Telegram mengirim ulang nanti
+		if !b.dispatch(r.Context(), update) {
+			http.Error(w, "update queue unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// runWebhook menjalankan server HTTP dan mendaftarkan webhook ke Telegram
+// sampai ctx selesai, lalu menghapus webhook dan menunggu permintaan yang
+// sedang diterima.
+func (b *Bot) runWebhook(ctx context.Context) error {
+	path := "/"
+	if parsed, err := url.Parse(b.cfg.WebhookURL); err == nil && parsed.Path != "" {
+		path = parsed.Path
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, b.webhookHandler(b.cfg.WebhookSecret))
+	mux.Handle("/healthz", b.healthHandler())
+	server := &http.Server{
+		Addr:              b.cfg.WebhookListenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		// Permintaan yang masih menunggu antrean ikut batal saat bot berhenti;
+		// Shutdown sendiri tidak membatalkan context permintaan
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	err := b.api.SetWebhook(ctx, SetWebhookPayload{
+		URL: b.cfg.WebhookURL, SecretToken: b.cfg.WebhookSecret, AllowedUpdates: webhookAllowedUpdates,
+	})
+	if err != nil {
+		server.Close()
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+	log.Printf("webhook registered, listening on %s%s", b.cfg.WebhookListenAddr, path)
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("webhook server failed: %w", err)
+		}
+	case <-ctx.Done():
+		log.Println("stopping webhook server")
+	}
+
+	// ctx sudah selesai, jadi pembersihan memakai context baru dengan batas waktu
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), webhookShutdownPeriod)
+	defer cancel()
+	if err := b.api.DeleteWebhook(cleanupCtx, DeleteWebhookPayload{}); err != nil {
+		log.Printf("failed to delete webhook: %v", err)
+	}
+	return server.Shutdown(cleanupCtx)
+}
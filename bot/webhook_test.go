@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	const secret = "s3cret"
+	update := `{"update_id": 7, "message": {"message_id": 1, "from": {"id": 42}, "chat": {"id": 42, "type": "private"}, "text": "hi"}}`
+
+	tests := []struct {
+		name       string
+		method     string
+		secret     string
+		body       string
+		closePool  bool
+		wantStatus int
+		wantQueued bool
+	}{
+		{name: "valid secret", method: http.MethodPost, secret: secret, body: update, wantStatus: http.StatusOK, wantQueued: true},
+		{name: "missing secret", method: http.MethodPost, body: update, wantStatus: http.StatusForbidden},
+		{name: "wrong secret", method: http.MethodPost, secret: "guess", body: update, wantStatus: http.StatusForbidden},
+		{name: "not a POST", method: http.MethodGet, secret: secret, wantStatus: http.StatusMethodNotAllowed},
+		{name: "invalid update", method: http.MethodPost, secret: secret, body: "{", wantStatus: http.StatusBadRequest},
+		{name: "pool already closed", method: http.MethodPost, secret: secret, body: update, closePool: true, wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _, _ := newTestBot(t)
+			queued := make(chan Update, 1)
+			b.updates.Run(func(u Update) { queued <- u })
+			if tt.closePool {
+				b.updates.Close()
+			} else {
+				defer b.updates.Close()
+			}
+
+			server := httptest.NewServer(b.webhookHandler(secret))
+			defer server.Close()
+
+			req, err := http.NewRequest(tt.method, server.URL, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.secret != "" {
+				req.Header.Set(webhookSecretHeader, tt.secret)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			select {
+			case u := <-queued:
+				if !tt.wantQueued {
+					t.Errorf("update %d was queued, want it rejected", u.ID)
+				} else if u.ID != 7 || u.Message == nil || u.Message.Text != "hi" {
+					t.Errorf("queued update = %+v, want update 7 with text hi", u)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.wantQueued {
+					t.Error("update was not queued")
+				}
+			}
+		})
+	}
+}
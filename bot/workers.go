@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"context"
+	"sync"
+
+	"telegram-dm-bot/config"
+)
+
+// UpdatePool memproses update dengan sejumlah worker tetap. Setiap update
+// diarahkan ke worker berdasarkan user (atau chat) pengirimnya, sehingga pesan
+// dari user yang sama diproses berurutan, misalnya trigger dan respons pada
+// sesi /learn, sementara user yang berbeda tetap diproses paralel.
+type UpdatePool struct {
+	shards  []chan Update
+	workers sync.WaitGroup
+
+	// closing membangunkan Submit yang sedang menunggu antrean penuh, closed
+	// dijaga mu agar tidak ada pengiriman ke antrean yang sudah ditutup
+	closing chan struct{}
+	mu      sync.RWMutex
+	closed  bool
+}
+
+// NewUpdatePool membuat pool dengan workers worker, masing-masing dengan
+// antrean sepanjang queueLength. Nilai yang tidak positif diganti default.
+func NewUpdatePool(workers, queueLength int) *UpdatePool {
+	if workers <= 0 {
+		workers = config.DefaultWorkerCount
+	}
+	if queueLength <= 0 {
+		queueLength = config.DefaultUpdateQueueLength
+	}
+	shards := make([]chan Update, workers)
+	for i := range shards {
+		shards[i] = make(chan Update, queueLength)
+	}
+	return &UpdatePool{shards: shards, closing: make(chan struct{})}
+}
+
+// Run menjalankan semua worker. handle dipanggil satu per satu untuk setiap
+// update di antrean worker tersebut.
+func (p *UpdatePool) Run(handle func(Update)) {
+	for _, shard := range p.shards {
+		p.workers.Add(1)
+		go func(queue <-chan Update) {
+			defer p.workers.Done()
+			for update := range queue {
+				handle(update)
+			}
+		}(shard)
+	}
+}
+
+// Submit memasukkan update ke antrean workernya. Jika antrean penuh, Submit
+// menunggu sampai ada tempat, ctx selesai atau pool ditutup; false berarti
+// update tidak masuk.
+func (p *UpdatePool) Submit(ctx context.Context, update Update) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+	shard := p.shards[uint64(updateShardKey(update))%uint64(len(p.shards))]
+	select {
+	case shard <- update:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-p.closing:
+		return false
+	}
+}
+
+// Close menutup antrean dan menunggu worker menyelesaikan update yang tersisa.
+// Submit yang masih menunggu atau dipanggil setelahnya mengembalikan false.
+func (p *UpdatePool) Close() {
+	close(p.closing)
+	p.mu.Lock()
+	p.closed = true
+	for _, shard := range p.shards {
+		close(shard)
+	}
+	p.mu.Unlock()
+	p.workers.Wait()
+}
+
+// updateShardKey memilih user pengirim sebagai kunci, karena sesi disimpan per
+// user; chat dipakai jika update tidak punya pengirim.
+func updateShardKey(update Update) int64 {
+	switch {
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.From.ID
+	case update.Message != nil:
+		if update.Message.From.ID != 0 {
+			return update.Message.From.ID
+		}
+		return update.Message.Chat.ID
+	case update.MyChatMember != nil:
+		return update.MyChatMember.Chat.ID
+	}
+	return int64(update.ID)
+}
@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUpdatePoolSubmitAfterClose(t *testing.T) {
+	pool := NewUpdatePool(1, 1)
+	// Antrean dibiarkan penuh tanpa worker agar Submit berikutnya menunggu
+	if !pool.Submit(context.Background(), Update{ID: 1}) {
+		t.Fatal("first submit was rejected")
+	}
+	result := make(chan bool)
+	go func() { result <- pool.Submit(context.Background(), Update{ID: 2}) }()
+
+	time.Sleep(20 * time.Millisecond)
+	pool.Run(func(Update) {})
+	pool.Close()
+
+	// Submit yang menunggu boleh berhasil atau ditolak, asalkan tidak panic
+	select {
+	case <-result:
+	case <-time.After(time.Second):
+		t.Fatal("blocked submit did not return after Close")
+	}
+	if pool.Submit(context.Background(), Update{ID: 3}) {
+		t.Error("submit after Close was accepted")
+	}
+}
+
+func TestNewUpdatePoolDefaults(t *testing.T) {
+	pool := NewUpdatePool(0, -1)
+	pool.Run(func(Update) {})
+	defer pool.Close()
+	if !pool.Submit(context.Background(), Update{ID: 1, Message: &Message{From: User{ID: 42}}}) {
+		t.Fatal("submit to a pool with default size was rejected")
+	}
+}
+
+func TestProcessUpdateSkipsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	b, client, store := newTestBot(t)
+	update := textUpdate(5, testUserID, "/start")
+
+	// Pengiriman pertama gagal: klaim dilepas agar pengiriman ulang diproses
+	client.errs["sendMessage"] = errors.New("network down")
+	b.processUpdate(ctx, update)
+	if store.processed[update.ID] {
+		t.Fatal("failed update is still claimed")
+	}
+
+	delete(client.errs, "sendMessage")
+	b.processUpdate(ctx, update)
+	sent := len(client.sent("sendMessage"))
+	if !store.processed[update.ID] {
+		t.Fatal("handled update was not claimed")
+	}
+
+	// Update yang sudah diklaim (misalnya oleh instance lain) tidak dibalas lagi
+	b.processUpdate(ctx, update)
+	if got := len(client.sent("sendMessage")); got != sent {
+		t.Errorf("duplicate update sent %d more messages", got-sent)
+	}
+}
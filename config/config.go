@@ -2,15 +2,53 @@ package config
 
 import (
 	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+const (
+	UpdateModePolling = "polling"
+	UpdateModeWebhook = "webhook"
+)
+
+const DefaultTelegramAPIURL = "https://api.telegram.org"
+
+const (
+	DefaultWorkerCount       = 8
+	DefaultUpdateQueueLength = 100
+)
+
 type Config struct {
 	BotToken    string
 	SupabaseURL string
 	SupabaseKey string
+
+	// TelegramAPIURL bisa diarahkan ke server telegram-bot-api sendiri.
+	TelegramAPIURL string
+	RequestTimeout time.Duration // batas waktu setiap permintaan HTTP ke Bot API
+	PollTimeout    time.Duration // lama long polling getUpdates, harus di bawah RequestTimeout
+	HTTPClient     *http.Client  // opsional, misalnya untuk pengujian; default memakai RequestTimeout
+
+	// UpdateMode memilih cara menerima update: "polling" (default) atau "webhook".
+	UpdateMode        string
+	WebhookURL        string // URL publik yang didaftarkan lewat setWebhook
+	WebhookListenAddr string // alamat server HTTP lokal, default ":8080"
+	WebhookSecret     string // dicocokkan dengan header X-Telegram-Bot-Api-Secret-Token
+
+	// Update diproses oleh WorkerCount worker; update dari user yang sama
+	// selalu ke worker yang sama. Setiap worker punya antrean UpdateQueueLength.
+	WorkerCount       int
+	UpdateQueueLength int
+
+	// HealthListenAddr mengaktifkan endpoint /healthz jika diisi. Pada mode
+	// webhook endpoint ini juga tersedia di server webhook.
+	HealthListenAddr string
 }
 
 func LoadConfig() (*Config, error) {
@@ -33,9 +71,84 @@ func LoadConfig() (*Config, error) {
 		log.Fatal("environment variable SUPABASE_KEY is required")
 	}
 
+	telegramAPIURL := strings.TrimRight(os.Getenv("TELEGRAM_API_URL"), "/")
+	if telegramAPIURL == "" {
+		telegramAPIURL = DefaultTelegramAPIURL
+	}
+	if parsed, err := url.Parse(telegramAPIURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		log.Fatalf("environment variable TELEGRAM_API_URL must be an http(s) URL, got %q", telegramAPIURL)
+	}
+	requestTimeout := durationEnv("TELEGRAM_REQUEST_TIMEOUT", 60*time.Second)
+	pollTimeout := durationEnv("TELEGRAM_POLL_TIMEOUT", 30*time.Second)
+	if pollTimeout < time.Second || pollTimeout >= requestTimeout {
+		log.Fatalf("TELEGRAM_POLL_TIMEOUT (%s) must be at least 1s and shorter than TELEGRAM_REQUEST_TIMEOUT (%s)", pollTimeout, requestTimeout)
+	}
+
+	updateMode := os.Getenv("UPDATE_MODE")
+	if updateMode == "" {
+		updateMode = UpdateModePolling
+	}
+	if updateMode != UpdateModePolling && updateMode != UpdateModeWebhook {
+		log.Fatalf("environment variable UPDATE_MODE must be %q or %q, got %q", UpdateModePolling, UpdateModeWebhook, updateMode)
+	}
+
+	webhookURL := os.Getenv("WEBHOOK_URL")
+	webhookSecret := os.Getenv("WEBHOOK_SECRET")
+	webhookListenAddr := os.Getenv("WEBHOOK_LISTEN_ADDR")
+	if webhookListenAddr == "" {
+		webhookListenAddr = ":8080"
+	}
+	if updateMode == UpdateModeWebhook {
+		if parsed, err := url.Parse(webhookURL); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			log.Fatal("environment variable WEBHOOK_URL must be a public https URL in webhook mode")
+		}
+		if webhookSecret == "" {
+			log.Fatal("environment variable WEBHOOK_SECRET is required in webhook mode")
+		}
+	}
+
+	workerCount := positiveIntEnv("WORKER_COUNT", DefaultWorkerCount)
+	updateQueueLength := positiveIntEnv("UPDATE_QUEUE_LENGTH", DefaultUpdateQueueLength)
+
 	return &Config{
-		BotToken:    botToken,
-		SupabaseURL: supabaseURL,
-		SupabaseKey: supabaseKey,
+		BotToken:          botToken,
+		SupabaseURL:       supabaseURL,
+		SupabaseKey:       supabaseKey,
+		TelegramAPIURL:    telegramAPIURL,
+		RequestTimeout:    requestTimeout,
+		PollTimeout:       pollTimeout,
+		UpdateMode:        updateMode,
+		WebhookURL:        webhookURL,
+		WebhookListenAddr: webhookListenAddr,
+		WebhookSecret:     webhookSecret,
+		WorkerCount:       workerCount,
+		UpdateQueueLength: updateQueueLength,
+		HealthListenAddr:  os.Getenv("HEALTH_LISTEN_ADDR"),
 	}, nil
-}
\ No newline at end of file
+}
+
+// positiveIntEnv membaca bilangan bulat positif dari environment, atau def jika kosong.
+func positiveIntEnv(name string, def int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		log.Fatalf("environment variable %s must be a positive integer, got %q", name, raw)
+	}
+	return value
+}
+
+// durationEnv membaca durasi positif seperti "30s" dari environment, atau def jika kosong.
+func durationEnv(name string, def time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil || value <= 0 {
+		log.Fatalf("environment variable %s must be a positive duration such as \"30s\", got %q", name, raw)
+	}
+	return value
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"telegram-dm-bot/bot"
 	"telegram-dm-bot/config"
@@ -24,7 +28,13 @@ func main() {
 		log.Fatalf("could not initialize supabase storage: %v", err)
 	}
 
-	telegramBot := bot.NewBot(cfg, store)
+	// ctx selesai saat SIGINT/SIGTERM diterima; Start lalu berhenti dengan rapi
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	telegramBot.Start()
+	telegramBot := bot.NewBot(ctx, cfg, store)
+
+	if err := telegramBot.Start(ctx); err != nil {
+		log.Fatalf("bot stopped: %v", err)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,196 @@
+-- Skema database bot. Jalankan seluruh file ini di SQL Editor Supabase.
+-- Semua perintah idempoten, jadi file yang sama bisa dijalankan ulang setelah
+-- upgrade untuk menambahkan tabel dan kolom baru.
+
+create table if not exists channels (
+    channel_id bigint primary key,
+    title text not null default '',
+    registered_by_user_id bigint not null
+);
+
+create table if not exists triggers (
+    id bigint generated by default as identity primary key,
+    channel_id bigint not null,
+    trigger_text text not null,
+    response_type text not null default 'text',
+    response_text text not null default '',
+    response_file_id text not null default '',
+    unique (channel_id, trigger_text)
+);
+
+create table if not exists users (
+    user_id bigint primary key,
+    lang_code text not null
+);
+
+-- Riwayat isi trigger untuk /history dan rollback
+create table if not exists trigger_revisions (
+    id bigint generated by default as identity primary key,
+    channel_id bigint not null,
+    trigger_text text not null,
+    response_type text not null,
+    response_text text not null default '',
+    response_file_id text not null default '',
+    edited_by_user_id bigint not null,
+    created_at timestamptz not null default now()
+);
+
+create index if not exists trigger_revisions_trigger_idx
+    on trigger_revisions (channel_id, trigger_text, created_at desc);
+
+-- Pengaturan per channel; channel tanpa baris memakai DefaultChannelSettings
+create table if not exists channel_settings (
+    channel_id bigint primary key,
+    auto_reply boolean not null default true,
+    parse_mode text not null default 'Markdown',
+    match_mode text not null default 'exact',
+    fallback_reply text not null default '',
+    notify_unmatched boolean not null default false
+);
+
+-- Peran editor/viewer; pemilik channel adalah channels.registered_by_user_id
+create table if not exists channel_roles (
+    channel_id bigint not null,
+    user_id bigint not null,
+    role text not null check (role in ('owner', 'editor', 'viewer')),
+    primary key (channel_id, user_id)
+);
+
+create index if not exists channel_roles_user_idx on channel_roles (user_id);
+
+-- Undangan sekali pakai; used_by_user_id null berarti belum dipakai
+create table if not exists channel_invites (
+    token text primary key,
+    channel_id bigint not null,
+    role text not null check (role in ('editor', 'viewer')),
+    created_by_user_id bigint not null,
+    created_at timestamptz not null default now(),
+    used_by_user_id bigint
+);
+
+-- Aksi dan parameter tombol inline, agar tombol lama tetap berfungsi
+create table if not exists callback_tokens (
+    token text primary key,
+    action text not null,
+    params text not null default '',
+    expires_at timestamptz not null
+);
+
+create index if not exists callback_tokens_expires_idx on callback_tokens (expires_at);
+
+-- Log audit tindakan admin per channel
+create table if not exists audit_events (
+    id bigint generated by default as identity primary key,
+    channel_id bigint not null,
+    actor_user_id bigint not null,
+    action text not null,
+    target text not null default '',
+    before_value text not null default '',
+    after_value text not null default '',
+    created_at timestamptz not null default now()
+);
+
+create index if not exists audit_events_channel_idx
+    on audit_events (channel_id, created_at desc, id desc);
+
+-- Statistik trigger per hari (UTC) dan bahasa; ditulis oleh flusher statistik
+create table if not exists trigger_hit_counts (
+    channel_id bigint not null,
+    trigger_id bigint not null,
+    day date not null,
+    lang text not null default '',
+    hits integer not null default 0,
+    primary key (channel_id, trigger_id, day, lang)
+);
+
+-- User unik per trigger per hari
+create table if not exists trigger_hit_users (
+    channel_id bigint not null,
+    trigger_id bigint not null,
+    day date not null,
+    user_id bigint not null,
+    primary key (channel_id, trigger_id, day, user_id)
+);
+
+-- Pesan DM yang tidak cocok dengan trigger, digabung per bentuk normalnya
+create table if not exists unanswered_queries (
+    channel_id bigint not null,
+    normalized_text text not null,
+    sample_text text not null default '',
+    hits integer not null default 0,
+    first_seen_at timestamptz not null default now(),
+    last_seen_at timestamptz not null default now(),
+    primary key (channel_id, normalized_text)
+);
+
+-- Jadwal digest; digest_schedule kosong berarti digest mati
+alter table channel_settings add column if not exists timezone text not null default 'UTC';
+alter table channel_settings add column if not exists digest_schedule text not null default '';
+
+-- Ringkasan aktivitas DM per channel per jam (UTC)
+create table if not exists channel_activity (
+    channel_id bigint not null,
+    hour timestamptz not null,
+    dms integer not null default 0,
+    matched integer not null default 0,
+    unmatched integer not null default 0,
+    failed_sends integer not null default 0,
+    primary key (channel_id, hour)
+);
+
+-- User yang pernah mengirim DM ke channel; first_seen_at hanya diisi default
+create table if not exists channel_subscribers (
+    channel_id bigint not null,
+    user_id bigint not null,
+    first_name text not null default '',
+    username text not null default '',
+    lang_code text not null default '',
+    first_seen_at timestamptz not null default now(),
+    last_seen_at timestamptz not null default now(),
+    primary key (channel_id, user_id)
+);
+
+create index if not exists channel_subscribers_first_seen_idx
+    on channel_subscribers (channel_id, first_seen_at);
+
+-- Chat DM channel dan topik milik subscriber, tujuan broadcast
+alter table channel_subscribers add column if not exists chat_id bigint not null default 0;
+alter table channel_subscribers add column if not exists topic_id integer not null default 0;
+
+-- User yang DM-nya ke channel diabaikan bot
+create table if not exists channel_blocked_users (
+    channel_id bigint not null,
+    user_id bigint not null,
+    name text not null default '',
+    blocked_by bigint not null,
+    created_at timestamptz not null default now(),
+    primary key (channel_id, user_id)
+);
+
+-- Direktori subscriber: jumlah pesan serta catatan dan tag dari admin
+alter table channel_subscribers add column if not exists message_count integer not null default 0;
+alter table channel_subscribers add column if not exists notes text not null default '';
+alter table channel_subscribers add column if not exists tags text[] not null default '{}';
+
+create index if not exists channel_subscribers_last_seen_idx
+    on channel_subscribers (channel_id, last_seen_at desc);
+
+-- Nilai tunggal milik bot, misalnya offset getUpdates terakhir
+create table if not exists bot_state (
+    key text primary key,
+    value bigint not null,
+    updated_at timestamptz not null default now()
+);
+
+-- Klaim update_id untuk mencegah update diproses dua kali; primary key
+-- membuat insert kedua gagal dengan 23505
+create table if not exists processed_updates (
+    update_id bigint primary key,
+    processed_at timestamptz not null default now()
+);
+
+create index if not exists processed_updates_processed_at_idx on processed_updates (processed_at);
+
+-- Jadwal digest terakhir yang dikirim, agar beberapa instance tidak mengirim
+-- digest yang sama dua kali
+alter table channel_settings add column if not exists last_digest_at timestamptz;
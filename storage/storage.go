@@ -2,23 +2,249 @@
 // FUNGSI LENGKAP YANG DIPERBARUI
 package storage
 
+import (
+	"context"
+	"time"
+)
+
 type RegisteredChannel struct {
 	ChannelID int64
 	Title     string
+	OwnerID   int64
+}
+
+// Peran bot per channel. Pemilik adalah user yang mendaftarkan channel.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+type ChannelRole struct {
+	ChannelID int64  `json:"channel_id"`
+	UserID    int64  `json:"user_id"`
+	Role      string `json:"role"`
+}
+
+// ChannelInvite adalah undangan sekali pakai yang dibagikan lewat deep link.
+type ChannelInvite struct {
+	Token     string    `json:"token"`
+	ChannelID int64     `json:"channel_id"`
+	Role      string    `json:"role"`
+	CreatedBy int64     `json:"created_by_user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UsedBy    int64     `json:"used_by_user_id,omitempty"`
+}
+
+// Jenis tindakan yang dicatat di log audit.
+const (
+	AuditRegister   = "register"
+	AuditUnregister = "unregister"
+	AuditLearn      = "learn"
+	AuditEdit       = "edit"
+	AuditDelete     = "delete"
+	AuditImport     = "import"
+	AuditSettings   = "settings"
+	AuditBroadcast  = "broadcast"
+	AuditBlock      = "block"
+	AuditUnblock    = "unblock"
+	AuditInvite     = "invite"
+	AuditInviteUse  = "invite_use"
+	AuditRoleGrant  = "role_grant"
+	AuditRoleRemove = "role_remove"
+)
+
+// AuditEvent mencatat satu tindakan admin pada sebuah channel beserta nilai
+// sebelum dan sesudahnya.
+type AuditEvent struct {
+	ID        int64     `json:"id"`
+	ChannelID int64     `json:"channel_id"`
+	ActorID   int64     `json:"actor_user_id"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Before    string    `json:"before_value"`
+	After     string    `json:"after_value"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TriggerHitCount adalah jumlah kecocokan sebuah trigger per hari (UTC,
+// format YYYY-MM-DD) dan per bahasa subscriber.
+type TriggerHitCount struct {
+	ChannelID int64  `json:"channel_id"`
+	TriggerID int64  `json:"trigger_id"`
+	Day       string `json:"day"`
+	Lang      string `json:"lang"`
+	Hits      int    `json:"hits"`
+}
+
+// TriggerHitUser menandai bahwa seorang user memicu trigger pada hari tertentu,
+// untuk menghitung jumlah user unik.
+type TriggerHitUser struct {
+	ChannelID int64  `json:"channel_id"`
+	TriggerID int64  `json:"trigger_id"`
+	Day       string `json:"day"`
+	UserID    int64  `json:"user_id"`
+}
+
+// UnansweredQuery adalah pesan DM yang tidak cocok dengan trigger mana pun.
+// Pesan dengan bentuk normal yang sama digabung dan dihitung bersama.
+type UnansweredQuery struct {
+	ChannelID  int64     `json:"channel_id"`
+	Normalized string    `json:"normalized_text"`
+	SampleText string    `json:"sample_text"`
+	Count      int       `json:"hits"`
+	FirstSeen  time.Time `json:"first_seen_at"`
+	LastSeen   time.Time `json:"last_seen_at"`
+}
+
+// ChannelActivity adalah ringkasan aktivitas DM sebuah channel per jam (UTC).
+type ChannelActivity struct {
+	ChannelID   int64     `json:"channel_id"`
+	Hour        time.Time `json:"hour"`
+	DMs         int       `json:"dms"`
+	Matched     int       `json:"matched"`
+	Unmatched   int       `json:"unmatched"`
+	FailedSends int       `json:"failed_sends"`
+}
+
+// Subscriber adalah user yang pernah mengirim DM ke sebuah channel. ChatID dan
+// TopicID adalah chat DM channel dan topik milik user tersebut, tempat broadcast dikirim.
+// Notes dan Tags hanya diisi admin dan tidak pernah terlihat oleh user.
+type Subscriber struct {
+	ChannelID    int64     `json:"channel_id"`
+	UserID       int64     `json:"user_id"`
+	ChatID       int64     `json:"chat_id"`
+	TopicID      int       `json:"topic_id"`
+	FirstName    string    `json:"first_name"`
+	Username     string    `json:"username"`
+	LangCode     string    `json:"lang_code"`
+	FirstSeen    time.Time `json:"first_seen_at"`
+	LastSeen     time.Time `json:"last_seen_at"`
+	MessageCount int       `json:"message_count"`
+	Notes        string    `json:"notes"`
+	Tags         []string  `json:"tags"`
+}
+
+// CallbackToken adalah aksi dan parameter sebuah tombol inline. Disimpan agar
+// tombol pada pesan lama tetap berfungsi setelah restart dan di instance lain.
+type CallbackToken struct {
+	Token     string    `json:"token"`
+	Action    string    `json:"action"`
+	Params    string    `json:"params"` // parameter tombol dalam JSON
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// BlockedUser adalah user yang DM-nya ke sebuah channel diabaikan bot.
+type BlockedUser struct {
+	ChannelID int64     `json:"channel_id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	BlockedBy int64     `json:"blocked_by"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
+
+// TriggerRevision adalah salinan isi sebuah trigger setiap kali disimpan,
+// beserta siapa yang mengubahnya dan kapan.
+type TriggerRevision struct {
+	ID             int64     `json:"id"`
+	ChannelID      int64     `json:"channel_id"`
+	TriggerText    string    `json:"trigger_text"`
+	ResponseType   string    `json:"response_type"`
+	ResponseText   string    `json:"response_text"`
+	ResponseFileID string    `json:"response_file_id,omitempty"`
+	EditedBy       int64     `json:"edited_by_user_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ChannelSettings menyimpan perilaku bot yang bisa diatur per channel.
+type ChannelSettings struct {
+	ChannelID       int64  `json:"channel_id"`
+	AutoReply       bool   `json:"auto_reply"`
+	ParseMode       string `json:"parse_mode"`
+	MatchMode       string `json:"match_mode"`
+	FallbackReply   string `json:"fallback_reply"`
+	NotifyUnmatched bool   `json:"notify_unmatched"`
+	Timezone        string `json:"timezone"`        // nama zona IANA, kosong berarti UTC
+	DigestSchedule  string `json:"digest_schedule"` // ekspresi cron lima kolom, kosong berarti mati
+}
+
+const (
+	MatchModeExact    = "exact"
+	MatchModeContains = "contains"
+	MatchModePrefix   = "prefix"
+)
+
+// DefaultChannelSettings mengembalikan perilaku bawaan untuk channel yang
+// belum pernah mengubah pengaturannya.
+func DefaultChannelSettings(channelID int64) ChannelSettings {
+	return ChannelSettings{
+		ChannelID: channelID,
+		AutoReply: true,
+		ParseMode: "Markdown",
+		MatchMode: MatchModeExact,
+		Timezone:  "UTC",
+	}
 }
 
 type Storage interface {
 	// BEFORE
 	// Set(channelID int64, trigger, response string) error
 	// AFTER
-	Set(record TriggerRecord) error
-	Get(channelID int64, trigger string) (TriggerRecord, bool, error)
-	GetTriggersByChannel(channelID int64) ([]TriggerRecord, error)
-	GetTriggerByID(triggerID int64) (TriggerRecord, bool, error) // <-- TAMBAHKAN FUNGSI BARU INI
-	DeleteTriggerByID(triggerID int64) error
-	SetUserLanguage(userID int64, langCode string) error
-	GetUserLanguage(userID int64) (string, bool, error)
-	RegisterChannel(channelID int64, title string, userID int64) error
-	GetRegisteredChannels() ([]RegisteredChannel, error)
+	Set(ctx context.Context, record TriggerRecord) error
+	Get(ctx context.Context, channelID int64, trigger string) (TriggerRecord, bool, error)
+	GetTriggersByChannel(ctx context.Context, channelID int64) ([]TriggerRecord, error)
+	GetTriggerByID(ctx context.Context, triggerID int64) (TriggerRecord, bool, error) // <-- TAMBAHKAN FUNGSI BARU INI
+	DeleteTriggerByID(ctx context.Context, triggerID int64) error
+	SetUserLanguage(ctx context.Context, userID int64, langCode string) error
+	GetUserLanguage(ctx context.Context, userID int64) (string, bool, error)
+	RegisterChannel(ctx context.Context, channelID int64, title string, userID int64) error
+	GetRegisteredChannels(ctx context.Context) ([]RegisteredChannel, error)
+	IsChannelRegistered(ctx context.Context, channelID int64) (bool, error)
+	GetRegisteredChannel(ctx context.Context, channelID int64) (RegisteredChannel, bool, error)
+	UnregisterChannel(ctx context.Context, channelID int64) error
+	PurgeChannelData(ctx context.Context, channelID int64) error
+	AddTriggerRevision(ctx context.Context, rev TriggerRevision) error
+	GetTriggerRevisions(ctx context.Context, channelID int64, trigger string, limit int) ([]TriggerRevision, error)
+	GetTriggerRevisionByID(ctx context.Context, revisionID int64) (TriggerRevision, bool, error)
+	GetChannelSettings(ctx context.Context, channelID int64) (ChannelSettings, error)
+	SetChannelSettings(ctx context.Context, settings ChannelSettings) error
+	SetChannelRole(ctx context.Context, role ChannelRole) error
+	GetChannelRole(ctx context.Context, channelID, userID int64) (string, bool, error)
+	GetChannelRoles(ctx context.Context, channelID int64) ([]ChannelRole, error)
+	GetUserChannelRoles(ctx context.Context, userID int64) ([]ChannelRole, error)
+	RemoveChannelRole(ctx context.Context, channelID, userID int64) error
+	CreateInvite(ctx context.Context, invite ChannelInvite) error
+	ConsumeInvite(ctx context.Context, token string, userID int64) (ChannelInvite, bool, error)
+	AddAuditEvent(ctx context.Context, event AuditEvent) error
+	GetAuditEvents(ctx context.Context, channelID int64, offset, limit int) ([]AuditEvent, error)
+	AddTriggerHits(ctx context.Context, count TriggerHitCount) error
+	AddTriggerHitUsers(ctx context.Context, users []TriggerHitUser) error
+	GetTriggerHits(ctx context.Context, channelID int64, since time.Time) ([]TriggerHitCount, error)
+	GetTriggerHitUsers(ctx context.Context, channelID int64, since time.Time) ([]TriggerHitUser, error)
+	AddUnansweredQuery(ctx context.Context, query UnansweredQuery) error
+	GetUnansweredQueries(ctx context.Context, channelID int64, offset, limit int) ([]UnansweredQuery, error)
+	DeleteUnansweredQuery(ctx context.Context, channelID int64, normalized string) error
+	GetScheduledChannelSettings(ctx context.Context) ([]ChannelSettings, error)
+	MarkDigestSent(ctx context.Context, channelID int64, scheduledAt time.Time) (bool, error)
+	AddChannelActivity(ctx context.Context, activity ChannelActivity) error
+	GetChannelActivity(ctx context.Context, channelID int64, from, to time.Time) ([]ChannelActivity, error)
+	UpsertSubscribers(ctx context.Context, subscribers []Subscriber) error
+	CountNewSubscribers(ctx context.Context, channelID int64, from, to time.Time) (int, error)
+	GetSubscribers(ctx context.Context, channelID int64) ([]Subscriber, error)
+	SearchSubscribers(ctx context.Context, channelID int64, query string, offset, limit int) ([]Subscriber, error)
+	GetSubscriber(ctx context.Context, channelID, userID int64) (Subscriber, bool, error)
+	SetSubscriberNotes(ctx context.Context, channelID, userID int64, notes string) error
+	SetSubscriberTags(ctx context.Context, channelID, userID int64, tags []string) error
+	BlockUser(ctx context.Context, blocked BlockedUser) error
+	UnblockUser(ctx context.Context, channelID, userID int64) error
+	GetBlockedUsers(ctx context.Context, channelID int64) ([]BlockedUser, error)
+	GetUpdateOffset(ctx context.Context) (int, error)
+	SetUpdateOffset(ctx context.Context, offset int) error
+	ClaimUpdate(ctx context.Context, updateID int) (bool, error)
+	ReleaseUpdate(ctx context.Context, updateID int) error
+	PruneProcessedUpdates(ctx context.Context, before time.Time) error
+	SaveCallbackTokens(ctx context.Context, tokens []CallbackToken) error
+	GetCallbackToken(ctx context.Context, token string) (CallbackToken, bool, error)
+	PruneCallbackTokens(ctx context.Context, before time.Time) error
 }
 // --- AKHIR PERUBAHAN ---
\ No newline at end of file
@@ -1,13 +1,19 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
+	"github.com/supabase-community/postgrest-go"
 	supa "github.com/supabase-community/supabase-go"
 )
 
+// SupabaseStorage menyimpan data di Supabase lewat postgrest-go. Klien itu belum
+// mendukung context, jadi ctx hanya diperiksa sebelum setiap query dikirim;
+// query yang sudah berjalan tetap diselesaikan.
 type SupabaseStorage struct {
 	client *supa.Client
 }
@@ -35,7 +41,10 @@ func NewSupabaseStorage(url, key string) (*SupabaseStorage, error) {
 	return &SupabaseStorage{client: client}, nil
 }
 
-func (s *SupabaseStorage) Set(record TriggerRecord) error {
+func (s *SupabaseStorage) Set(ctx context.Context, record TriggerRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	data := map[string]interface{}{
 		"channel_id":       record.ChannelID,
 		"trigger_text":     strings.ToLower(record.TriggerText),
@@ -57,7 +66,10 @@ func (s *SupabaseStorage) Set(record TriggerRecord) error {
 	return nil
 }
 
-func (s *SupabaseStorage) Get(channelID int64, trigger string) (TriggerRecord, bool, error) {
+func (s *SupabaseStorage) Get(ctx context.Context, channelID int64, trigger string) (TriggerRecord, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return TriggerRecord{}, false, err
+	}
 	lowerTrigger := strings.ToLower(trigger)
 	var results []TriggerRecord
 	var emptyRecord TriggerRecord
@@ -79,7 +91,10 @@ func (s *SupabaseStorage) Get(channelID int64, trigger string) (TriggerRecord, b
 
 // ----- FUNGSI BARU -----
 // Mengambil semua data trigger yang ada di database.
-func (s *SupabaseStorage) GetTriggersByChannel(channelID int64) ([]TriggerRecord, error) {
+func (s *SupabaseStorage) GetTriggersByChannel(ctx context.Context, channelID int64) ([]TriggerRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var results []TriggerRecord
 	_, err := s.client.From("triggers").
 		Select("*", "0", false).
@@ -92,7 +107,10 @@ func (s *SupabaseStorage) GetTriggersByChannel(channelID int64) ([]TriggerRecord
 	return results, nil
 }
 
-func (s *SupabaseStorage) DeleteTriggerByID(triggerID int64) error {
+func (s *SupabaseStorage) DeleteTriggerByID(ctx context.Context, triggerID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	_, _, err := s.client.From("triggers").
 		Delete("", "").
 		Eq("id", fmt.Sprintf("%d", triggerID)).
@@ -104,7 +122,10 @@ func (s *SupabaseStorage) DeleteTriggerByID(triggerID int64) error {
 	return nil
 }
 
-func (s *SupabaseStorage) SetUserLanguage(userID int64, langCode string) error {
+func (s *SupabaseStorage) SetUserLanguage(ctx context.Context, userID int64, langCode string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	record := UserRecord{
 		UserID:   userID,
 		LangCode: langCode,
@@ -116,7 +137,10 @@ func (s *SupabaseStorage) SetUserLanguage(userID int64, langCode string) error {
 	return nil
 }
 
-func (s *SupabaseStorage) GetUserLanguage(userID int64) (string, bool, error) {
+func (s *SupabaseStorage) GetUserLanguage(ctx context.Context, userID int64) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
 	var results []UserRecord
 	_, err := s.client.From("users").
 		Select("lang_code", "0", false).
@@ -137,9 +161,13 @@ func (s *SupabaseStorage) GetUserLanguage(userID int64) (string, bool, error) {
 type RegisteredChannelRecord struct {
 	ChannelID int64  `json:"channel_id"`
 	Title     string `json:"title"`
+	OwnerID   int64  `json:"registered_by_user_id"`
 }
 
-func (s *SupabaseStorage) RegisterChannel(channelID int64, title string, userID int64) error {
+func (s *SupabaseStorage) RegisterChannel(ctx context.Context, channelID int64, title string, userID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	record := map[string]interface{}{
 		"channel_id":            channelID,
 		"title":                 title,
@@ -152,9 +180,12 @@ func (s *SupabaseStorage) RegisterChannel(channelID int64, title string, userID
 	return nil
 }
 
-func (s *SupabaseStorage) GetRegisteredChannels() ([]RegisteredChannel, error) {
+func (s *SupabaseStorage) GetRegisteredChannels(ctx context.Context) ([]RegisteredChannel, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	var results []RegisteredChannelRecord
-	_, err := s.client.From("channels").Select("channel_id, title", "0", false).ExecuteTo(&results)
+	_, err := s.client.From("channels").Select("channel_id, title, registered_by_user_id", "0", false).ExecuteTo(&results)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get registered channels: %w", err)
 	}
@@ -165,14 +196,90 @@ func (s *SupabaseStorage) GetRegisteredChannels() ([]RegisteredChannel, error) {
 		channels = append(channels, RegisteredChannel{
 			ChannelID: rec.ChannelID,
 			Title:     rec.Title,
+			OwnerID:   rec.OwnerID,
 		})
 	}
 	return channels, nil
 }
 
+func (s *SupabaseStorage) IsChannelRegistered(ctx context.Context, channelID int64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	var results []RegisteredChannelRecord
+	_, err := s.client.From("channels").
+		Select("channel_id", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		ExecuteTo(&results)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to check channel registration: %w", err)
+	}
+	return len(results) > 0, nil
+}
+
+func (s *SupabaseStorage) GetRegisteredChannel(ctx context.Context, channelID int64) (RegisteredChannel, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return RegisteredChannel{}, false, err
+	}
+	var results []RegisteredChannelRecord
+	_, err := s.client.From("channels").
+		Select("channel_id, title, registered_by_user_id", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		ExecuteTo(&results)
+
+	if err != nil {
+		return RegisteredChannel{}, false, fmt.Errorf("failed to get registered channel: %w", err)
+	}
+	if len(results) == 0 {
+		return RegisteredChannel{}, false, nil
+	}
+	return RegisteredChannel{ChannelID: results[0].ChannelID, Title: results[0].Title, OwnerID: results[0].OwnerID}, true, nil
+}
+
+func (s *SupabaseStorage) UnregisterChannel(ctx context.Context, channelID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, _, err := s.client.From("channels").
+		Delete("", "").
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		Execute()
+
+	if err != nil {
+		return fmt.Errorf("failed to delete channel: %w", err)
+	}
+	return nil
+}
+
+// PurgeChannelData menghapus semua data milik channel (trigger, riwayat, pengaturan, peran)
+// tanpa menyentuh pendaftaran channel itu sendiri.
+func (s *SupabaseStorage) PurgeChannelData(ctx context.Context, channelID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, table := range []string{"triggers", "trigger_revisions", "channel_settings", "channel_roles", "channel_invites", "trigger_hit_counts", "trigger_hit_users", "unanswered_queries", "channel_activity", "channel_subscribers", "channel_blocked_users"} {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, _, err := s.client.From(table).
+			Delete("", "").
+			Eq("channel_id", fmt.Sprintf("%d", channelID)).
+			Execute()
+
+		if err != nil {
+			return fmt.Errorf("failed to purge %s for channel: %w", table, err)
+		}
+	}
+	return nil
+}
+
 // --- AWAL PERUBAHAN ---
 // Tambahkan fungsi baru ini di akhir file
-func (s *SupabaseStorage) GetTriggerByID(triggerID int64) (TriggerRecord, bool, error) {
+func (s *SupabaseStorage) GetTriggerByID(ctx context.Context, triggerID int64) (TriggerRecord, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return TriggerRecord{}, false, err
+	}
 	var results []TriggerRecord
 	var emptyRecord TriggerRecord
 
@@ -190,4 +297,935 @@ func (s *SupabaseStorage) GetTriggerByID(triggerID int64) (TriggerRecord, bool,
 	}
 	return results[0], true, nil
 }
-// --- AKHIR PERUBAHAN ---
\ No newline at end of file
+// --- AKHIR PERUBAHAN ---
+func (s *SupabaseStorage) AddTriggerRevision(ctx context.Context, rev TriggerRevision) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"channel_id":        rev.ChannelID,
+		"trigger_text":      strings.ToLower(rev.TriggerText),
+		"response_type":     rev.ResponseType,
+		"response_text":     rev.ResponseText,
+		"response_file_id":  rev.ResponseFileID,
+		"edited_by_user_id": rev.EditedBy,
+		"created_at":        time.Now().UTC(),
+	}
+	_, _, err := s.client.From("trigger_revisions").Insert(data, false, "", "", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to insert trigger revision: %w", err)
+	}
+	return nil
+}
+
+// GetTriggerRevisions mengambil revisi sebuah trigger, yang terbaru lebih dulu.
+func (s *SupabaseStorage) GetTriggerRevisions(ctx context.Context, channelID int64, trigger string, limit int) ([]TriggerRevision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var results []TriggerRevision
+	_, err := s.client.From("trigger_revisions").
+		Select("*", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		Eq("trigger_text", strings.ToLower(trigger)).
+		Order("created_at", &postgrest.OrderOpts{Ascending: false}).
+		Limit(limit, "").
+		ExecuteTo(&results)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trigger revisions: %w", err)
+	}
+	return results, nil
+}
+
+func (s *SupabaseStorage) GetTriggerRevisionByID(ctx context.Context, revisionID int64) (TriggerRevision, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return TriggerRevision{}, false, err
+	}
+	var results []TriggerRevision
+	var emptyRevision TriggerRevision
+
+	_, err := s.client.From("trigger_revisions").
+		Select("*", "0", false).
+		Eq("id", fmt.Sprintf("%d", revisionID)).
+		ExecuteTo(&results)
+
+	if err != nil {
+		return emptyRevision, false, fmt.Errorf("failed to get trigger revision by id: %w", err)
+	}
+	if len(results) == 0 {
+		return emptyRevision, false, nil
+	}
+	return results[0], true, nil
+}
+
+// GetChannelSettings mengembalikan pengaturan bawaan jika channel belum punya baris sendiri.
+func (s *SupabaseStorage) GetChannelSettings(ctx context.Context, channelID int64) (ChannelSettings, error) {
+	if err := ctx.Err(); err != nil {
+		return ChannelSettings{}, err
+	}
+	var results []ChannelSettings
+	_, err := s.client.From("channel_settings").
+		Select("*", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		ExecuteTo(&results)
+
+	if err != nil {
+		return DefaultChannelSettings(channelID), fmt.Errorf("failed to get channel settings: %w", err)
+	}
+	if len(results) == 0 {
+		return DefaultChannelSettings(channelID), nil
+	}
+	return results[0], nil
+}
+
+func (s *SupabaseStorage) SetChannelSettings(ctx context.Context, settings ChannelSettings) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, _, err := s.client.From("channel_settings").Upsert(settings, "channel_id", "", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to upsert channel settings: %w", err)
+	}
+	return nil
+}
+
+func (s *SupabaseStorage) SetChannelRole(ctx context.Context, role ChannelRole) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, _, err := s.client.From("channel_roles").Upsert(role, "channel_id,user_id", "", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to upsert channel role: %w", err)
+	}
+	return nil
+}
+
+func (s *SupabaseStorage) GetChannelRole(ctx context.Context, channelID, userID int64) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	var results []ChannelRole
+	_, err := s.client.From("channel_roles").
+		Select("*", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		Eq("user_id", fmt.Sprintf("%d", userID)).
+		ExecuteTo(&results)
+
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get channel role: %w", err)
+	}
+	if len(results) == 0 {
+		return "", false, nil
+	}
+	return results[0].Role, true, nil
+}
+
+func (s *SupabaseStorage) GetChannelRoles(ctx context.Context, channelID int64) ([]ChannelRole, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var results []ChannelRole
+	_, err := s.client.From("channel_roles").
+		Select("*", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		ExecuteTo(&results)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel roles: %w", err)
+	}
+	return results, nil
+}
+
+func (s *SupabaseStorage) GetUserChannelRoles(ctx context.Context, userID int64) ([]ChannelRole, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var results []ChannelRole
+	_, err := s.client.From("channel_roles").
+		Select("*", "0", false).
+		Eq("user_id", fmt.Sprintf("%d", userID)).
+		ExecuteTo(&results)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user channel roles: %w", err)
+	}
+	return results, nil
+}
+
+func (s *SupabaseStorage) RemoveChannelRole(ctx context.Context, channelID, userID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, _, err := s.client.From("channel_roles").
+		Delete("", "").
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		Eq("user_id", fmt.Sprintf("%d", userID)).
+		Execute()
+
+	if err != nil {
+		return fmt.Errorf("failed to delete channel role: %w", err)
+	}
+	return nil
+}
+
+func (s *SupabaseStorage) CreateInvite(ctx context.Context, invite ChannelInvite) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"token":              invite.Token,
+		"channel_id":         invite.ChannelID,
+		"role":               invite.Role,
+		"created_by_user_id": invite.CreatedBy,
+		"created_at":         invite.CreatedAt.UTC(),
+	}
+	_, _, err := s.client.From("channel_invites").Insert(data, false, "", "", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to insert invite: %w", err)
+	}
+	return nil
+}
+
+// ConsumeInvite menandai undangan sebagai terpakai. Filter "used_by_user_id is null"
+// membuat operasi ini atomik: undangan yang sama tidak bisa dipakai dua kali.
+func (s *SupabaseStorage) ConsumeInvite(ctx context.Context, token string, userID int64) (ChannelInvite, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return ChannelInvite{}, false, err
+	}
+	var results []ChannelInvite
+	_, err := s.client.From("channel_invites").
+		Update(map[string]interface{}{"used_by_user_id": userID}, "representation", "").
+		Eq("token", token).
+		Is("used_by_user_id", "null").
+		ExecuteTo(&results)
+
+	if err != nil {
+		return ChannelInvite{}, false, fmt.Errorf("failed to consume invite: %w", err)
+	}
+	if len(results) == 0 {
+		return ChannelInvite{}, false, nil
+	}
+	return results[0], true, nil
+}
+
+func (s *SupabaseStorage) AddAuditEvent(ctx context.Context, event AuditEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"channel_id":    event.ChannelID,
+		"actor_user_id": event.ActorID,
+		"action":        event.Action,
+		"target":        event.Target,
+		"before_value":  event.Before,
+		"after_value":   event.After,
+		"created_at":    time.Now().UTC(),
+	}
+	_, _, err := s.client.From("audit_events").Insert(data, false, "", "", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to insert audit event: %w", err)
+	}
+	return nil
+}
+
+// GetAuditEvents mengambil log audit sebuah channel, yang terbaru lebih dulu.
+// limit 0 berarti semua event, diambil per halaman karena batas baris PostgREST.
+func (s *SupabaseStorage) GetAuditEvents(ctx context.Context, channelID int64, offset, limit int) ([]AuditEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if limit > 0 {
+		return s.getAuditEventsPage(channelID, offset, limit)
+	}
+	var all []AuditEvent
+	for pageOffset := offset; ; pageOffset += subscriberPageSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page, err := s.getAuditEventsPage(channelID, pageOffset, subscriberPageSize)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if len(page) < subscriberPageSize {
+			return all, nil
+		}
+	}
+}
+
+func (s *SupabaseStorage) getAuditEventsPage(channelID int64, offset, limit int) ([]AuditEvent, error) {
+	var results []AuditEvent
+	_, err := s.client.From("audit_events").
+		Select("*", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		Order("created_at", &postgrest.OrderOpts{Ascending: false}).
+		Order("id", &postgrest.OrderOpts{Ascending: false}).
+		Range(offset, offset+limit-1, "").
+		ExecuteTo(&results)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit events: %w", err)
+	}
+	return results, nil
+}
+
+// AddTriggerHits menambahkan hitungan ke baris yang sudah ada. PostgREST tidak
+// bisa menambah nilai kolom secara atomik, jadi pemanggil harus memastikan
+// hanya ada satu penulis (flusher statistik).
+func (s *SupabaseStorage) AddTriggerHits(ctx context.Context, count TriggerHitCount) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var existing []TriggerHitCount
+	_, err := s.client.From("trigger_hit_counts").
+		Select("*", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", count.ChannelID)).
+		Eq("trigger_id", fmt.Sprintf("%d", count.TriggerID)).
+		Eq("day", count.Day).
+		Eq("lang", count.Lang).
+		ExecuteTo(&existing)
+	if err != nil {
+		return fmt.Errorf("failed to get trigger hit count: %w", err)
+	}
+	if len(existing) > 0 {
+		count.Hits += existing[0].Hits
+	}
+
+	_, _, err = s.client.From("trigger_hit_counts").Upsert(count, "channel_id,trigger_id,day,lang", "", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to upsert trigger hit count: %w", err)
+	}
+	return nil
+}
+
+func (s *SupabaseStorage) AddTriggerHitUsers(ctx context.Context, users []TriggerHitUser) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return nil
+	}
+	_, _, err := s.client.From("trigger_hit_users").Upsert(users, "channel_id,trigger_id,day,user_id", "", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to upsert trigger hit users: %w", err)
+	}
+	return nil
+}
+
+// GetTriggerHits mengambil hitungan sejak tanggal tertentu; since kosong berarti semua.
+// Hasil diambil per halaman karena PostgREST membatasi jumlah baris per permintaan.
+func (s *SupabaseStorage) GetTriggerHits(ctx context.Context, channelID int64, since time.Time) ([]TriggerHitCount, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var all []TriggerHitCount
+	for offset := 0; ; offset += subscriberPageSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var page []TriggerHitCount
+		query := s.client.From("trigger_hit_counts").
+			Select("*", "0", false).
+			Eq("channel_id", fmt.Sprintf("%d", channelID))
+		if !since.IsZero() {
+			query = query.Gte("day", since.UTC().Format("2006-01-02"))
+		}
+		_, err := query.
+			Order("day", &postgrest.OrderOpts{Ascending: true}).
+			Order("trigger_id", &postgrest.OrderOpts{Ascending: true}).
+			Order("lang", &postgrest.OrderOpts{Ascending: true}).
+			Range(offset, offset+subscriberPageSize-1, "").
+			ExecuteTo(&page)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get trigger hits: %w", err)
+		}
+		all = append(all, page...)
+		if len(page) < subscriberPageSize {
+			return all, nil
+		}
+	}
+}
+
+func (s *SupabaseStorage) GetTriggerHitUsers(ctx context.Context, channelID int64, since time.Time) ([]TriggerHitUser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var all []TriggerHitUser
+	for offset := 0; ; offset += subscriberPageSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var page []TriggerHitUser
+		query := s.client.From("trigger_hit_users").
+			Select("*", "0", false).
+			Eq("channel_id", fmt.Sprintf("%d", channelID))
+		if !since.IsZero() {
+			query = query.Gte("day", since.UTC().Format("2006-01-02"))
+		}
+		_, err := query.
+			Order("day", &postgrest.OrderOpts{Ascending: true}).
+			Order("trigger_id", &postgrest.OrderOpts{Ascending: true}).
+			Order("user_id", &postgrest.OrderOpts{Ascending: true}).
+			Range(offset, offset+subscriberPageSize-1, "").
+			ExecuteTo(&page)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get trigger hit users: %w", err)
+		}
+		all = append(all, page...)
+		if len(page) < subscriberPageSize {
+			return all, nil
+		}
+	}
+}
+
+// AddUnansweredQuery menggabungkan query dengan baris yang sudah ada: hitungan
+// dijumlahkan, contoh teks dan waktu terakhir diperbarui. Sama seperti
+// AddTriggerHits, hanya flusher yang boleh memanggilnya.
+func (s *SupabaseStorage) AddUnansweredQuery(ctx context.Context, query UnansweredQuery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var existing []UnansweredQuery
+	_, err := s.client.From("unanswered_queries").
+		Select("*", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", query.ChannelID)).
+		Eq("normalized_text", query.Normalized).
+		ExecuteTo(&existing)
+	if err != nil {
+		return fmt.Errorf("failed to get unanswered query: %w", err)
+	}
+	if len(existing) > 0 {
+		query.Count += existing[0].Count
+		query.FirstSeen = existing[0].FirstSeen
+	}
+
+	data := map[string]interface{}{
+		"channel_id":      query.ChannelID,
+		"normalized_text": query.Normalized,
+		"sample_text":     query.SampleText,
+		"hits":            query.Count,
+		"first_seen_at":   query.FirstSeen.UTC(),
+		"last_seen_at":    query.LastSeen.UTC(),
+	}
+	_, _, err = s.client.From("unanswered_queries").Upsert(data, "channel_id,normalized_text", "", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to upsert unanswered query: %w", err)
+	}
+	return nil
+}
+
+// GetUnansweredQueries mengambil query yang paling sering muncul lebih dulu.
+func (s *SupabaseStorage) GetUnansweredQueries(ctx context.Context, channelID int64, offset, limit int) ([]UnansweredQuery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var results []UnansweredQuery
+	_, err := s.client.From("unanswered_queries").
+		Select("*", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		Order("hits", &postgrest.OrderOpts{Ascending: false}).
+		Range(offset, offset+limit-1, "").
+		ExecuteTo(&results)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unanswered queries: %w", err)
+	}
+	return results, nil
+}
+
+func (s *SupabaseStorage) DeleteUnansweredQuery(ctx context.Context, channelID int64, normalized string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, _, err := s.client.From("unanswered_queries").
+		Delete("", "").
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		Eq("normalized_text", normalized).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to delete unanswered query: %w", err)
+	}
+	return nil
+}
+
+// GetScheduledChannelSettings mengambil pengaturan semua channel yang punya jadwal digest.
+func (s *SupabaseStorage) GetScheduledChannelSettings(ctx context.Context) ([]ChannelSettings, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var results []ChannelSettings
+	_, err := s.client.From("channel_settings").
+		Select("*", "0", false).
+		Neq("digest_schedule", "").
+		ExecuteTo(&results)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled channel settings: %w", err)
+	}
+	return results, nil
+}
+
+// MarkDigestSent menyimpan jadwal digest terakhir yang dikirim untuk channel dan
+// mengembalikan false jika jadwal itu (atau yang lebih baru) sudah ditandai,
+// misalnya oleh instance lain. Filter pada UPDATE membuat penandaan ini atomik.
+func (s *SupabaseStorage) MarkDigestSent(ctx context.Context, channelID int64, scheduledAt time.Time) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	slot := scheduledAt.UTC().Format(time.RFC3339)
+	var results []ChannelSettings
+	_, err := s.client.From("channel_settings").
+		Update(map[string]interface{}{"last_digest_at": slot}, "representation", "").
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		Or(fmt.Sprintf("last_digest_at.is.null,last_digest_at.lt.%s", slot), "").
+		ExecuteTo(&results)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to mark digest as sent: %w", err)
+	}
+	return len(results) > 0, nil
+}
+
+// AddChannelActivity menambahkan hitungan ke baris jam yang sama. Sama seperti
+// AddTriggerHits, hanya flusher yang boleh memanggilnya.
+func (s *SupabaseStorage) AddChannelActivity(ctx context.Context, activity ChannelActivity) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	hour := activity.Hour.UTC().Format(time.RFC3339)
+	var existing []ChannelActivity
+	_, err := s.client.From("channel_activity").
+		Select("*", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", activity.ChannelID)).
+		Eq("hour", hour).
+		ExecuteTo(&existing)
+	if err != nil {
+		return fmt.Errorf("failed to get channel activity: %w", err)
+	}
+	if len(existing) > 0 {
+		activity.DMs += existing[0].DMs
+		activity.Matched += existing[0].Matched
+		activity.Unmatched += existing[0].Unmatched
+		activity.FailedSends += existing[0].FailedSends
+	}
+
+	_, _, err = s.client.From("channel_activity").Upsert(activity, "channel_id,hour", "", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to upsert channel activity: %w", err)
+	}
+	return nil
+}
+
+// timeRange membuat filter and=(...) untuk rentang [from, to) pada satu kolom.
+// postgrest-go menyimpan filter per nama kolom, jadi Gte lalu Lt pada kolom yang
+// sama akan saling menimpa dan batas bawahnya hilang.
+func timeRange(column string, from, to time.Time) string {
+	return fmt.Sprintf("%s.gte.%s,%s.lt.%s", column, from.UTC().Format(time.RFC3339), column, to.UTC().Format(time.RFC3339))
+}
+
+// GetChannelActivity mengambil aktivitas per jam dalam rentang [from, to).
+func (s *SupabaseStorage) GetChannelActivity(ctx context.Context, channelID int64, from, to time.Time) ([]ChannelActivity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var results []ChannelActivity
+	_, err := s.client.From("channel_activity").
+		Select("*", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		And(timeRange("hour", from, to), "").
+		ExecuteTo(&results)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel activity: %w", err)
+	}
+	return results, nil
+}
+
+// UpsertSubscribers memperbarui data subscriber dan menambahkan MessageCount ke
+// jumlah yang sudah tersimpan. first_seen_at, notes dan tags sengaja tidak dikirim
+// agar nilai yang ada tidak tertimpa; first_seen_at terisi default kolom (now())
+// saat baris pertama dibuat. Sama seperti AddTriggerHits, hanya flusher yang
+// boleh memanggilnya.
+func (s *SupabaseStorage) UpsertSubscribers(ctx context.Context, subscribers []Subscriber) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(subscribers) == 0 {
+		return nil
+	}
+
+	byChannel := make(map[int64][]string)
+	for _, sub := range subscribers {
+		byChannel[sub.ChannelID] = append(byChannel[sub.ChannelID], fmt.Sprintf("%d", sub.UserID))
+	}
+	existingCounts := make(map[[2]int64]int)
+	for channelID, userIDs := range byChannel {
+		var existing []Subscriber
+		_, err := s.client.From("channel_subscribers").
+			Select("channel_id,user_id,message_count", "0", false).
+			Eq("channel_id", fmt.Sprintf("%d", channelID)).
+			In("user_id", userIDs).
+			ExecuteTo(&existing)
+		if err != nil {
+			return fmt.Errorf("failed to get subscriber counts: %w", err)
+		}
+		for _, sub := range existing {
+			existingCounts[[2]int64{sub.ChannelID, sub.UserID}] = sub.MessageCount
+		}
+	}
+
+	var data []map[string]interface{}
+	for _, sub := range subscribers {
+		data = append(data, map[string]interface{}{
+			"message_count": sub.MessageCount + existingCounts[[2]int64{sub.ChannelID, sub.UserID}],
+			"channel_id":   sub.ChannelID,
+			"user_id":      sub.UserID,
+			"chat_id":      sub.ChatID,
+			"topic_id":     sub.TopicID,
+			"first_name":   sub.FirstName,
+			"username":     sub.Username,
+			"lang_code":    sub.LangCode,
+			"last_seen_at": sub.LastSeen.UTC(),
+		})
+	}
+	_, _, err := s.client.From("channel_subscribers").Upsert(data, "channel_id,user_id", "", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to upsert subscribers: %w", err)
+	}
+	return nil
+}
+
+// CountNewSubscribers menghitung subscriber yang pertama kali terlihat dalam rentang [from, to).
+func (s *SupabaseStorage) CountNewSubscribers(ctx context.Context, channelID int64, from, to time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	_, count, err := s.client.From("channel_subscribers").
+		Select("user_id", "exact", true).
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		And(timeRange("first_seen_at", from, to), "").
+		Execute()
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to count new subscribers: %w", err)
+	}
+	return int(count), nil
+}
+
+// subscriberPageSize mengikuti batas baris default PostgREST per permintaan.
+const subscriberPageSize = 1000
+
+// GetSubscribers mengambil semua subscriber channel, dibaca per halaman.
+func (s *SupabaseStorage) GetSubscribers(ctx context.Context, channelID int64) ([]Subscriber, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var all []Subscriber
+	for offset := 0; ; offset += subscriberPageSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var page []Subscriber
+		_, err := s.client.From("channel_subscribers").
+			Select("*", "0", false).
+			Eq("channel_id", fmt.Sprintf("%d", channelID)).
+			Order("user_id", &postgrest.OrderOpts{Ascending: true}).
+			Range(offset, offset+subscriberPageSize-1, "").
+			ExecuteTo(&page)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get subscribers: %w", err)
+		}
+		all = append(all, page...)
+		if len(page) < subscriberPageSize {
+			return all, nil
+		}
+	}
+}
+
+func (s *SupabaseStorage) BlockUser(ctx context.Context, blocked BlockedUser) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"channel_id": blocked.ChannelID,
+		"user_id":    blocked.UserID,
+		"name":       blocked.Name,
+		"blocked_by": blocked.BlockedBy,
+	}
+	_, _, err := s.client.From("channel_blocked_users").Upsert(data, "channel_id,user_id", "", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+	return nil
+}
+
+func (s *SupabaseStorage) UnblockUser(ctx context.Context, channelID, userID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, _, err := s.client.From("channel_blocked_users").
+		Delete("", "").
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		Eq("user_id", fmt.Sprintf("%d", userID)).
+		Execute()
+
+	if err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+	return nil
+}
+
+// GetBlockedUsers mengambil daftar blokir channel, yang terbaru lebih dulu.
+func (s *SupabaseStorage) GetBlockedUsers(ctx context.Context, channelID int64) ([]BlockedUser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var results []BlockedUser
+	_, err := s.client.From("channel_blocked_users").
+		Select("*", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		Order("created_at", &postgrest.OrderOpts{Ascending: false}).
+		ExecuteTo(&results)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blocked users: %w", err)
+	}
+	return results, nil
+}
+
+// SearchSubscribers mengambil satu halaman direktori subscriber, yang terakhir
+// aktif lebih dulu. query "#tag" mencari tag; selain itu dicocokkan dengan nama
+// depan atau username.
+func (s *SupabaseStorage) SearchSubscribers(ctx context.Context, channelID int64, query string, offset, limit int) ([]Subscriber, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var results []Subscriber
+	builder := s.client.From("channel_subscribers").
+		Select("*", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", channelID))
+
+	query = strings.TrimSpace(query)
+	if strings.HasPrefix(query, "#") {
+		builder = builder.Contains("tags", []string{strings.ToLower(strings.TrimPrefix(query, "#"))})
+	} else if query != "" {
+		// Karakter ini punya arti khusus di filter or PostgREST
+		pattern := strings.NewReplacer(",", " ", "(", " ", ")", " ", "*", " ").Replace(strings.TrimPrefix(query, "@"))
+		builder = builder.Or(fmt.Sprintf("first_name.ilike.*%s*,username.ilike.*%s*", pattern, pattern), "")
+	}
+
+	_, err := builder.
+		Order("last_seen_at", &postgrest.OrderOpts{Ascending: false}).
+		Range(offset, offset+limit-1, "").
+		ExecuteTo(&results)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to search subscribers: %w", err)
+	}
+	return results, nil
+}
+
+func (s *SupabaseStorage) GetSubscriber(ctx context.Context, channelID, userID int64) (Subscriber, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Subscriber{}, false, err
+	}
+	var results []Subscriber
+	_, err := s.client.From("channel_subscribers").
+		Select("*", "0", false).
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		Eq("user_id", fmt.Sprintf("%d", userID)).
+		ExecuteTo(&results)
+
+	if err != nil {
+		return Subscriber{}, false, fmt.Errorf("failed to get subscriber: %w", err)
+	}
+	if len(results) == 0 {
+		return Subscriber{}, false, nil
+	}
+	return results[0], true, nil
+}
+
+func (s *SupabaseStorage) SetSubscriberNotes(ctx context.Context, channelID, userID int64, notes string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.updateSubscriber(ctx, channelID, userID, map[string]interface{}{"notes": notes})
+}
+
+func (s *SupabaseStorage) SetSubscriberTags(ctx context.Context, channelID, userID int64, tags []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	return s.updateSubscriber(ctx, channelID, userID, map[string]interface{}{"tags": tags})
+}
+
+func (s *SupabaseStorage) updateSubscriber(ctx context.Context, channelID, userID int64, fields map[string]interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, _, err := s.client.From("channel_subscribers").
+		Update(fields, "representation", "").
+		Eq("channel_id", fmt.Sprintf("%d", channelID)).
+		Eq("user_id", fmt.Sprintf("%d", userID)).
+		Execute()
+
+	if err != nil {
+		return fmt.Errorf("failed to update subscriber: %w", err)
+	}
+	return nil
+}
+
+// updateOffsetKey adalah baris bot_state yang menyimpan offset getUpdates.
+const updateOffsetKey = "update_offset"
+
+type botStateRecord struct {
+	Key   string `json:"key"`
+	Value int64  `json:"value"`
+}
+
+// GetUpdateOffset mengembalikan offset getUpdates yang terakhir disimpan, atau
+// 0 jika belum pernah ada.
+func (s *SupabaseStorage) GetUpdateOffset(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	var results []botStateRecord
+	_, err := s.client.From("bot_state").
+		Select("key,value", "0", false).
+		Eq("key", updateOffsetKey).
+		ExecuteTo(&results)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get update offset: %w", err)
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return int(results[0].Value), nil
+}
+
+func (s *SupabaseStorage) SetUpdateOffset(ctx context.Context, offset int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"key":        updateOffsetKey,
+		"value":      offset,
+		"updated_at": time.Now().UTC(),
+	}
+	_, _, err := s.client.From("bot_state").Upsert(data, "key", "", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to store update offset: %w", err)
+	}
+	return nil
+}
+
+// ClaimUpdate mencatat update_id sebelum handler-nya dijalankan dan
+// mengembalikan false jika instance lain (atau pengiriman ulang webhook) sudah
+// mengklaimnya. Insert ke primary key membuat klaim ini atomik.
+func (s *SupabaseStorage) ClaimUpdate(ctx context.Context, updateID int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	data := map[string]interface{}{"update_id": updateID}
+	_, _, err := s.client.From("processed_updates").Insert(data, false, "", "minimal", "").Execute()
+	if err != nil {
+		// 23505 adalah unique_violation di PostgreSQL
+		if strings.HasPrefix(err.Error(), "(23505)") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to claim update: %w", err)
+	}
+	return true, nil
+}
+
+// ReleaseUpdate menghapus klaim update yang handler-nya gagal, agar update itu
+// boleh diproses lagi jika dikirim ulang.
+func (s *SupabaseStorage) ReleaseUpdate(ctx context.Context, updateID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, _, err := s.client.From("processed_updates").
+		Delete("", "").
+		Eq("update_id", fmt.Sprintf("%d", updateID)).
+		Execute()
+
+	if err != nil {
+		return fmt.Errorf("failed to release update: %w", err)
+	}
+	return nil
+}
+
+// PruneProcessedUpdates menghapus catatan update yang lebih lama dari before;
+// Telegram tidak mengirim ulang update setelah 24 jam.
+func (s *SupabaseStorage) PruneProcessedUpdates(ctx context.Context, before time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, _, err := s.client.From("processed_updates").
+		Delete("", "").
+		Lt("processed_at", before.UTC().Format(time.RFC3339)).
+		Execute()
+
+	if err != nil {
+		return fmt.Errorf("failed to prune processed updates: %w", err)
+	}
+	return nil
+}
+
+// SaveCallbackTokens menyimpan atau memperpanjang token tombol inline.
+func (s *SupabaseStorage) SaveCallbackTokens(ctx context.Context, tokens []CallbackToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	_, _, err := s.client.From("callback_tokens").Upsert(tokens, "token", "", "").Execute()
+	if err != nil {
+		return fmt.Errorf("failed to save callback tokens: %w", err)
+	}
+	return nil
+}
+
+func (s *SupabaseStorage) GetCallbackToken(ctx context.Context, token string) (CallbackToken, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return CallbackToken{}, false, err
+	}
+	var results []CallbackToken
+	_, err := s.client.From("callback_tokens").
+		Select("*", "0", false).
+		Eq("token", token).
+		ExecuteTo(&results)
+
+	if err != nil {
+		return CallbackToken{}, false, fmt.Errorf("failed to get callback token: %w", err)
+	}
+	if len(results) == 0 {
+		return CallbackToken{}, false, nil
+	}
+	return results[0], true, nil
+}
+
+// PruneCallbackTokens menghapus token yang kedaluwarsa sebelum before.
+func (s *SupabaseStorage) PruneCallbackTokens(ctx context.Context, before time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, _, err := s.client.From("callback_tokens").
+		Delete("", "").
+		Lt("expires_at", before.UTC().Format(time.RFC3339)).
+		Execute()
+
+	if err != nil {
+		return fmt.Errorf("failed to prune callback tokens: %w", err)
+	}
+	return nil
+}
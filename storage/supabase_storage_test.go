@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestStorage menjalankan SupabaseStorage terhadap server PostgREST palsu
+// yang mencatat query setiap permintaan dan menjawab dengan body.
+func newTestStorage(t *testing.T, body string) (*SupabaseStorage, func() []url.Values) {
+	t.Helper()
+	var mu sync.Mutex
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Range", "0-0/3")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	s, err := NewSupabaseStorage(server.URL, "test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() []url.Values {
+		mu.Lock()
+		defer mu.Unlock()
+		return queries
+	}
+}
+
+func TestTimeRangeKeepsBothBounds(t *testing.T) {
+	from := time.Date(2026, 10, 11, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+
+	tests := []struct {
+		name   string
+		column string
+		call   func(s *SupabaseStorage) error
+	}{
+		{
+			name:   "channel activity",
+			column: "hour",
+			call: func(s *SupabaseStorage) error {
+				_, err := s.GetChannelActivity(context.Background(), -1001, from, to)
+				return err
+			},
+		},
+		{
+			name:   "new subscribers",
+			column: "first_seen_at",
+			call: func(s *SupabaseStorage) error {
+				_, err := s.CountNewSubscribers(context.Background(), -1001, from, to)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, queries := newTestStorage(t, "[]")
+			if err := tt.call(s); err != nil {
+				t.Fatal(err)
+			}
+
+			got := queries()
+			if len(got) != 1 {
+				t.Fatalf("sent %d requests, want 1", len(got))
+			}
+			want := "(" + tt.column + ".gte.2026-10-11T00:00:00Z," + tt.column + ".lt.2026-10-18T00:00:00Z)"
+			if and := got[0].Get("and"); and != want {
+				t.Errorf("and = %q, want %q", and, want)
+			}
+			if plain := got[0].Get(tt.column); plain != "" {
+				t.Errorf("%s = %q, want the bounds only inside and=()", tt.column, plain)
+			}
+		})
+	}
+}
+
+func TestMarkDigestSent(t *testing.T) {
+	scheduledAt := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"first instance", `[{"channel_id": -1001}]`, true},
+		{"already sent", `[]`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, queries := newTestStorage(t, tt.body)
+			marked, err := s.MarkDigestSent(context.Background(), -1001, scheduledAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if marked != tt.want {
+				t.Errorf("marked = %v, want %v", marked, tt.want)
+			}
+
+			got := queries()
+			if len(got) != 1 {
+				t.Fatalf("sent %d requests, want 1", len(got))
+			}
+			if id := got[0].Get("channel_id"); id != "eq.-1001" {
+				t.Errorf("channel_id = %q, want eq.-1001", id)
+			}
+			want := "(last_digest_at.is.null,last_digest_at.lt.2026-10-18T09:00:00Z)"
+			if or := got[0].Get("or"); or != want {
+				t.Errorf("or = %q, want %q", or, want)
+			}
+		})
+	}
+}